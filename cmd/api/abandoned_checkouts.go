@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	dodopayments "github.com/dodopayments/dodopayments-go"
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// A checkout is abandoned when its payment fails, is cancelled or is not made
+// in time. The checkout fails and its seat hold is released. When the seats
+// are still free the customer is emailed a link to retry with the same seats.
+
+const (
+	paymentFailed    = "payment.failed"
+	paymentCancelled = "payment.cancelled"
+
+	// checkoutPaymentWindow is the longest a checkout waits for its payment
+	// before it is swept, it is swept earlier when its seat hold expires first
+	checkoutPaymentWindow = maxSeatHoldLifetime
+	// checkoutSweepInterval is how often checkouts waiting for a payment
+	// that is overdue are swept
+	checkoutSweepInterval = time.Minute
+)
+
+// awaitingPaymentKey holds the checkouts awaiting payment, scored by the
+// unix millisecond their payment is overdue at
+const awaitingPaymentKey = "checkouts:awaiting-payment"
+
+// checkoutRetryLink links to the retry page with the showtime and the seats of
+// a checkout, "" when no retry page is configured
+func (c *Config) checkoutRetryLink(checkout *Checkout) string {
+	if c.CheckoutRetryURL == "" {
+		return ""
+	}
+
+	seatIDs := make([]string, len(checkout.SeatMatrixIDs))
+
+	for i, seatID := range checkout.SeatMatrixIDs {
+		seatIDs[i] = strconv.Itoa(int(seatID))
+	}
+
+	query := url.Values{}
+	query.Set("movieTimeSlotId", strconv.Itoa(int(checkout.MovieTimeSlotID)))
+	query.Set("venueId", strconv.Itoa(int(checkout.VenueID)))
+	query.Set("seatMatrixIds", strings.Join(seatIDs, ","))
+
+	separator := "?"
+
+	if strings.Contains(c.CheckoutRetryURL, "?") {
+		separator = "&"
+	}
+
+	return c.CheckoutRetryURL + separator + query.Encode()
+}
+
+// abandonCheckout fails a checkout whose payment will not come and emails the
+// customer a retry link when the seats are still free once the hold is
+// released
+func (c *Config) abandonCheckout(ctx context.Context, checkout *Checkout, reason string) error {
+	var retryLink string
+	var retrySeats []string
+
+	if link := c.checkoutRetryLink(checkout); link != "" {
+		seats, err := c.showtimeSeatMap(ctx, checkout.MovieTimeSlotID, checkout.VenueID)
+
+		if err != nil {
+			return err
+		}
+
+		holders, err := c.seatHolders(ctx, checkout.MovieTimeSlotID, checkout.SeatMatrixIDs)
+
+		if err != nil {
+			return err
+		}
+
+		free := seats != nil
+
+		for _, seatID := range checkout.SeatMatrixIDs {
+			if holdID, ok := holders[seatID]; (ok && holdID != checkout.HoldID) || (seats != nil && seats.booked[seatID]) {
+				free = false
+			}
+		}
+
+		if free {
+			retryLink, retrySeats = link, seatNumbersOf(seats, checkout.SeatMatrixIDs)
+		}
+	}
+
+	c.failCheckout(ctx, checkout, reason)
+
+	if err := c.saveCheckout(ctx, checkout); err != nil {
+		return err
+	}
+
+	// the retry email is a courtesy, the checkout has failed either way
+	if retryLink != "" {
+		mail := utils.SendRetryCheckoutMailTemplate(checkout.Customer.Email, checkout.Customer.CustomerName, retryLink, retrySeats)
+
+		if err := c.sendMail(mail); err != nil {
+			log.Error("error sending checkout retry email: ", err)
+		}
+	}
+
+	return nil
+}
+
+// handlePaymentAbandoned fails the checkout of a payment that failed or was
+// cancelled. A checkout that is confirmed or failed already is left alone.
+func (c *Config) handlePaymentAbandoned(ctx context.Context, payment *dodopayments.Payment, reason string) error {
+	key, err := c.checkoutKeyOfPayment(ctx, payment)
+
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		log.Warnf("payment %s belongs to no checkout", payment.PaymentID)
+		return nil
+	}
+
+	unlock, locked, err := c.lockCheckout(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return errCheckoutLocked
+	}
+
+	defer unlock()
+
+	checkout, err := c.checkout(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if checkout == nil || checkout.Status == checkoutConfirmed || checkout.Status == checkoutFailed {
+		return nil
+	}
+
+	return c.abandonCheckout(ctx, checkout, reason)
+}
+
+// SweepCheckouts fails the checkouts whose payment is overdue at now, for
+// payments that never got a webhook. Checkouts that are running or that could
+// not be swept are left for the next sweep.
+func (c *Config) SweepCheckouts(ctx context.Context, now time.Time) error {
+	if c.RedisClient == nil {
+		return nil
+	}
+
+	keys, err := c.RedisClient.ZRangeByScore(ctx, awaitingPaymentKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		unlock, locked, err := c.lockCheckout(ctx, key)
+
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			continue
+		}
+
+		err = c.sweepCheckout(ctx, key)
+		unlock()
+
+		// the checkout is swept again next time, the others go on
+		if err != nil {
+			log.Errorf("error sweeping checkout %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) sweepCheckout(ctx context.Context, key string) error {
+	checkout, err := c.checkout(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if checkout == nil || checkout.Status != checkoutAwaitingPayment {
+		return c.RedisClient.ZRem(ctx, awaitingPaymentKey, key).Err()
+	}
+
+	return c.abandonCheckout(ctx, checkout, "The payment was not made in time")
+}
+
+// StartCheckoutSweeper sweeps checkouts whose payment is overdue until ctx is
+// cancelled
+func (c *Config) StartCheckoutSweeper(ctx context.Context) {
+	ticker := time.NewTicker(checkoutSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+
+			if err := c.SweepCheckouts(sweepCtx, time.Now()); err != nil {
+				log.Error("error sweeping checkouts: ", err)
+			}
+
+			cancel()
+		}
+	}
+}
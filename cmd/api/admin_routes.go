@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// The admin routes forward catalog writes to MovieDB. They go through the same
+// MovieDBServiceClient as the reads so the response cache drops whatever the
+// write made outdated.
+
+type backendResponse interface {
+	GetStatus() int32
+	GetMessage() string
+	GetError() string
+}
+
+// decodeAdminBody unmarshals the request body into req
+func decodeAdminBody(r *http.Request, req any) error {
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("error reading request body: %w", err)
+	}
+
+	if err := utils.UnmarshalJSON(bodyBytes, req); err != nil {
+		return fmt.Errorf("error unmarshalling request body: %w", err)
+	}
+
+	return nil
+}
+
+// urlParamInt32 reads a positive integer url parameter
+func urlParamInt32(r *http.Request, name string) (int32, error) {
+	raw := chi.URLParam(r, name)
+
+	if raw == "" {
+		return 0, fmt.Errorf("missing '%s' parameter in URL", name)
+	}
+
+	value, err := strconv.ParseInt(raw, 10, 32)
+
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid '%s' parameter in URL", name)
+	}
+
+	return int32(value), nil
+}
+
+// refreshCatalog rebuilds the search index in the background after a write
+// changed the catalog
+func (c *Config) refreshCatalog() {
+	if c.SearchIndex == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := c.RefreshSearchIndex(ctx); err != nil {
+			log.Error("error refreshing search index after catalog write: ", err)
+		}
+	}()
+}
+
+// writeAdminResponse writes the MovieDB response of a write back to the client
+func writeAdminResponse[Resp backendResponse](w http.ResponseWriter, action string, resp Resp, err error) bool {
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error %s: %v"}`, action, err), http.StatusInternalServerError)
+		return false
+	}
+
+	if resp.GetError() != "" {
+		status := int(resp.GetStatus())
+
+		if status < 400 {
+			status = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error %s: %s"}`, action, resp.GetError()), status)
+		return false
+	}
+
+	jsonResponse, err := utils.MarshalJSON(resp)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(jsonResponse); err != nil {
+		log.Error("error writing JSON response: ", err)
+	}
+
+	return true
+}
+
+func (c *Config) AdminAddMovie(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.Movie
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Title == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "title cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.AddMovie(ctx, &requestBody)
+
+	if writeAdminResponse(w, "adding movie", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminUpdateMovie(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.Movie
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Id <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "movie id cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.UpdateMovie(ctx, &requestBody)
+
+	if writeAdminResponse(w, "updating movie", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminDeleteMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.DeleteMovie(ctx, &pb.MovieRequest{
+		Movieid: strconv.Itoa(int(id)),
+	})
+
+	if writeAdminResponse(w, "deleting movie", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminAddVenue(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.Venue
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venue name cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.AddVenue(ctx, &requestBody)
+
+	if writeAdminResponse(w, "adding venue", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminUpdateVenue(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.Venue
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Id <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venue id cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.UpdateVenue(ctx, &requestBody)
+
+	if writeAdminResponse(w, "updating venue", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminDeleteVenue(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.DeleteVenue(ctx, &pb.MovieRequest{
+		Venueid: strconv.Itoa(int(id)),
+	})
+
+	if writeAdminResponse(w, "deleting venue", response, err) {
+		c.refreshCatalog()
+	}
+}
+
+func (c *Config) AdminAddMovieTimeSlot(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.MovieTimeSlot
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Movieid <= 0 || requestBody.Venueid <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "movie id and venue id cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.AddMovieTimeSlot(ctx, &requestBody)
+
+	writeAdminResponse(w, "adding movie time slot", response, err)
+}
+
+func (c *Config) AdminUpdateMovieTimeSlot(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.MovieTimeSlotUpdate
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.MovieTimeSlotId <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "movie time slot id cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.UpdateMovieTimeSlot(ctx, &requestBody)
+
+	writeAdminResponse(w, "updating movie time slot", response, err)
+}
+
+func (c *Config) AdminDeleteMovieTimeSlot(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.DeleteMovieTimeSlot(ctx, &pb.MovieTimeSlotDelete{
+		MovieTimeSlotId: id,
+	})
+
+	writeAdminResponse(w, "deleting movie time slot", response, err)
+}
+
+func (c *Config) AdminAddSeatMatrix(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.AddSeatMatrixInput
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Venueid <= 0 || len(requestBody.Seats) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venue id and seats cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.AddSeatMatrix(ctx, &requestBody)
+
+	writeAdminResponse(w, "adding seat matrix", response, err)
+}
+
+func (c *Config) AdminUpdateSeatMatrix(w http.ResponseWriter, r *http.Request) {
+	var requestBody pb.UpdateSeatMatrixRequest
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Venueid <= 0 || len(requestBody.Seats) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venue id and seats cannot be empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.MovieDB_service.UpdateSeatMatrix(ctx, &requestBody)
+
+	writeAdminResponse(w, "updating seat matrix", response, err)
+}
+
+func (c *Config) AdminDeleteSeatMatrix(w http.ResponseWriter, r *http.Request) {
+	venueID, err := urlParamInt32(r, "venueId")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without a seat id the whole seat matrix of the venue is deleted
+	if chi.URLParam(r, "seatId") == "" {
+		response, err := c.MovieDB_service.DeleteEntireSeatMatrix(ctx, &pb.DeleteEntireSeatMatrixRequest{
+			Venueid: venueID,
+		})
+
+		writeAdminResponse(w, "deleting seat matrix", response, err)
+		return
+	}
+
+	seatID, err := urlParamInt32(r, "seatId")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := c.MovieDB_service.DeleteSeatMatrix(ctx, &pb.DeleteSeatMatrixRequest{
+		Venueid:      venueID,
+		SeatMatrixId: seatID,
+	})
+
+	writeAdminResponse(w, "deleting seat", response, err)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// The aggregates of a movie are kept in Redis as counters: the number of
+// reviews, the sum of their ratings, a counter per star, per month and per
+// keyword. They are computed once from the reviews in MovieDB and then moved
+// along by every review the broker adds, edits or deletes. They expire so that
+// changes made to MovieDB behind the broker's back are picked up eventually.
+
+const reviewAggregatesTTL = 6 * time.Hour
+
+const (
+	defaultAggregateKeywords = 10
+	maxAggregateKeywords     = 50
+)
+
+// Fields of the aggregates hash
+const (
+	aggregateCountField  = "count"
+	aggregateSumField    = "sum"
+	aggregateStarsPrefix = "stars:"
+	aggregateMonthPrefix = "month:"
+	aggregateWordPrefix  = "kw:"
+	// aggregateTruncatedField is set when the movie had more reviews than
+	// were read
+	aggregateTruncatedField = "truncated"
+	aggregateComputedField  = "computedAt"
+)
+
+// adjustAggregatesScript applies counter deltas to the aggregates of a movie,
+// aggregates that are not cached are left to be computed on the next read
+var adjustAggregatesScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+for i = 1, #ARGV, 2 do
+	if redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1]) <= 0 and ARGV[i] ~= 'sum' then
+		redis.call('HDEL', KEYS[1], ARGV[i])
+	end
+end
+
+return 1
+`)
+
+func reviewAggregatesKey(movieID int32) string {
+	return fmt.Sprintf("reviews:aggregates:%d", movieID)
+}
+
+type RatingBucket struct {
+	Stars int     `json:"stars"`
+	Count int64   `json:"count"`
+	Share float64 `json:"share"`
+}
+
+type ReviewPeriod struct {
+	// Month is formatted as YYYY-MM
+	Month string `json:"month"`
+	Count int64  `json:"count"`
+}
+
+type KeywordCount struct {
+	Keyword string `json:"keyword"`
+	Count   int64  `json:"count"`
+}
+
+type ReviewAggregates struct {
+	MovieID        int32          `json:"movieId"`
+	ReviewCount    int64          `json:"reviewCount"`
+	AverageRating  float64        `json:"averageRating"`
+	Histogram      []RatingBucket `json:"histogram"`
+	ReviewsByMonth []ReviewPeriod `json:"reviewsByMonth"`
+	Keywords       []KeywordCount `json:"keywords"`
+	// Truncated is set when only the newest reviews of the movie were counted
+	Truncated  bool      `json:"truncated"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// reviewAggregateCounters returns the counters a single review contributes to
+// the aggregates of its movie
+func reviewAggregateCounters(review *pb.Review) map[string]int64 {
+	counters := map[string]int64{
+		aggregateCountField: 1,
+		aggregateSumField:   int64(review.Rating),
+	}
+
+	if review.Rating >= 1 && review.Rating <= 5 {
+		counters[aggregateStarsPrefix+strconv.Itoa(int(review.Rating))] = 1
+	}
+
+	createdAt := time.Now()
+
+	if review.CreatedAt > 0 {
+		createdAt = time.Unix(int64(review.CreatedAt), 0)
+	}
+
+	counters[aggregateMonthPrefix+createdAt.UTC().Format("2006-01")] = 1
+
+	for _, keyword := range search.Keywords(review.Title + " " + review.Comment) {
+		counters[aggregateWordPrefix+keyword] = 1
+	}
+
+	return counters
+}
+
+// computeReviewAggregates counts the reviews of a movie from MovieDB
+func (c *Config) computeReviewAggregates(ctx context.Context, movieID int32) (map[string]int64, error) {
+	reviews, response, err := c.allMovieReviews(ctx, movieID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counters := map[string]int64{aggregateCountField: 0, aggregateSumField: 0}
+
+	for _, review := range reviews {
+		for field, delta := range reviewAggregateCounters(review) {
+			counters[field] += delta
+		}
+	}
+
+	if response != nil && int(response.TotalReviewCount) > len(reviews) {
+		counters[aggregateTruncatedField] = 1
+	}
+
+	counters[aggregateComputedField] = time.Now().Unix()
+
+	return counters, nil
+}
+
+// movieReviewAggregates returns the counters of a movie, from Redis when they
+// are cached
+func (c *Config) movieReviewAggregates(ctx context.Context, movieID int32) (map[string]int64, error) {
+	if c.RedisClient != nil {
+		cached, err := c.RedisClient.HGetAll(ctx, reviewAggregatesKey(movieID)).Result()
+
+		if err != nil {
+			log.Error("error reading review aggregates: ", err)
+		}
+
+		if len(cached) > 0 {
+			counters := make(map[string]int64, len(cached))
+
+			for field, raw := range cached {
+				counters[field], _ = strconv.ParseInt(raw, 10, 64)
+			}
+
+			return counters, nil
+		}
+	}
+
+	counters, err := c.computeReviewAggregates(ctx, movieID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RedisClient != nil {
+		key := reviewAggregatesKey(movieID)
+		values := make(map[string]any, len(counters))
+
+		for field, value := range counters {
+			values[field] = value
+		}
+
+		pipe := c.RedisClient.TxPipeline()
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, values)
+		pipe.Expire(ctx, key, reviewAggregatesTTL)
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Error("error caching review aggregates: ", err)
+		}
+	}
+
+	return counters, nil
+}
+
+// adjustReviewAggregates moves the cached aggregates of a movie from removed
+// to added, either may be nil
+func (c *Config) adjustReviewAggregates(ctx context.Context, movieID int32, removed *pb.Review, added *pb.Review) {
+	if c.RedisClient == nil {
+		return
+	}
+
+	deltas := map[string]int64{}
+
+	if removed != nil {
+		for field, delta := range reviewAggregateCounters(removed) {
+			deltas[field] -= delta
+		}
+	}
+
+	if added != nil {
+		for field, delta := range reviewAggregateCounters(added) {
+			deltas[field] += delta
+		}
+	}
+
+	args := make([]any, 0, 2*len(deltas))
+
+	for field, delta := range deltas {
+		if delta != 0 {
+			args = append(args, field, delta)
+		}
+	}
+
+	if len(args) == 0 {
+		return
+	}
+
+	if err := adjustAggregatesScript.Run(ctx, c.RedisClient, []string{reviewAggregatesKey(movieID)}, args...).Err(); err != nil {
+		log.Error("error adjusting review aggregates: ", err)
+	}
+}
+
+// publishedReview returns the review MovieDB stored, or the one sent to it when
+// the response leaves it out
+func publishedReview(response *pb.ReviewResponse, sent *pb.Review) *pb.Review {
+	if review := response.GetReview(); review != nil && review.Rating != 0 {
+		return review
+	}
+
+	return sent
+}
+
+// summarizeReviewAggregates turns the counters of a movie into the response
+func summarizeReviewAggregates(movieID int32, counters map[string]int64, keywords int) ReviewAggregates {
+	aggregates := ReviewAggregates{
+		MovieID:        movieID,
+		ReviewCount:    counters[aggregateCountField],
+		Histogram:      make([]RatingBucket, 0, 5),
+		ReviewsByMonth: []ReviewPeriod{},
+		Keywords:       []KeywordCount{},
+		Truncated:      counters[aggregateTruncatedField] > 0,
+		ComputedAt:     time.Unix(counters[aggregateComputedField], 0).UTC(),
+	}
+
+	var rated int64
+
+	for stars := 5; stars >= 1; stars-- {
+		count := counters[aggregateStarsPrefix+strconv.Itoa(stars)]
+		rated += count
+		aggregates.Histogram = append(aggregates.Histogram, RatingBucket{Stars: stars, Count: count})
+	}
+
+	if rated > 0 {
+		aggregates.AverageRating = math.Round(float64(counters[aggregateSumField])/float64(rated)*100) / 100
+
+		for i := range aggregates.Histogram {
+			aggregates.Histogram[i].Share = math.Round(float64(aggregates.Histogram[i].Count)/float64(rated)*1000) / 1000
+		}
+	}
+
+	for field, count := range counters {
+		switch {
+		case count <= 0:
+		case strings.HasPrefix(field, aggregateMonthPrefix):
+			aggregates.ReviewsByMonth = append(aggregates.ReviewsByMonth, ReviewPeriod{Month: strings.TrimPrefix(field, aggregateMonthPrefix), Count: count})
+		case strings.HasPrefix(field, aggregateWordPrefix):
+			aggregates.Keywords = append(aggregates.Keywords, KeywordCount{Keyword: strings.TrimPrefix(field, aggregateWordPrefix), Count: count})
+		}
+	}
+
+	sort.Slice(aggregates.ReviewsByMonth, func(i, j int) bool {
+		return aggregates.ReviewsByMonth[i].Month < aggregates.ReviewsByMonth[j].Month
+	})
+
+	sort.Slice(aggregates.Keywords, func(i, j int) bool {
+		if aggregates.Keywords[i].Count != aggregates.Keywords[j].Count {
+			return aggregates.Keywords[i].Count > aggregates.Keywords[j].Count
+		}
+
+		return aggregates.Keywords[i].Keyword < aggregates.Keywords[j].Keyword
+	})
+
+	if len(aggregates.Keywords) > keywords {
+		aggregates.Keywords = aggregates.Keywords[:keywords]
+	}
+
+	return aggregates
+}
+
+func (c *Config) GetMovieReviewAggregates(w http.ResponseWriter, r *http.Request) {
+	movieID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	keywords := defaultAggregateKeywords
+
+	if raw := r.URL.Query().Get("keywords"); raw != "" {
+		keywords, err = strconv.Atoi(raw)
+
+		if err != nil || keywords < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "keywords must be a non negative integer"}`, http.StatusBadRequest)
+			return
+		}
+
+		keywords = min(keywords, maxAggregateKeywords)
+	}
+
+	counters, err := c.movieReviewAggregates(r.Context(), movieID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error computing review aggregates: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse, err := utils.MarshalJSON(summarizeReviewAggregates(movieID, counters, keywords))
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+type contextKey string
+
+const authUserKey contextKey = "authUser"
+
+type AuthUser struct {
+	UserID int32
+	Email  string
+	Role   string
+}
+
+func (u *AuthUser) IsAdmin() bool {
+	return u != nil && u.Role == "admin"
+}
+
+// UserFromContext returns the user attached to the request by OptionalAuth or
+// RequireAuth
+func UserFromContext(ctx context.Context) (*AuthUser, bool) {
+	user, ok := ctx.Value(authUserKey).(*AuthUser)
+
+	return user, ok && user != nil
+}
+
+// requestToken returns the token sent in the Authorization header or, for
+// browsers, in the auth_token cookie set on login
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("Authorization"); token != "" {
+		return token
+	}
+
+	if cookie, err := r.Cookie("auth_token"); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// authenticate validates the request token with the auth service and returns
+// the user it belongs to
+func (c *Config) authenticate(r *http.Request) (*AuthUser, error) {
+	token := requestToken(r)
+
+	if token == "" {
+		return nil, fmt.Errorf("missing authorization token")
+	}
+
+	if c.Auth_Service == nil {
+		return nil, fmt.Errorf("auth service is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := c.Auth_Service.ValidateToken(ctx, &at.ValdateTokenRequest{
+		Token: token,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error validating token: %w", err)
+	}
+
+	if response == nil || !response.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims, err := utils.ParseTokenClaims(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// holds, checkouts, reviews and votes are owned by the user id, users
+	// without one would all be the same user
+	if claims.UserID <= 0 {
+		return nil, fmt.Errorf("token carries no user id")
+	}
+
+	return &AuthUser{
+		UserID: claims.UserID,
+		Email:  claims.Email,
+		Role:   claims.Role,
+	}, nil
+}
+
+// OptionalAuth attaches the user to the request context when a valid token is
+// sent, anonymous requests are let through untouched
+func (c *Config) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := c.authenticate(r)
+
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey, user)))
+	})
+}
+
+// RequireAuth rejects requests without a valid token
+func (c *Config) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := c.authenticate(r)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Unauthorized: %v"}`, err), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey, user)))
+	})
+}
+
+// RequireAdmin rejects requests that are not made by an admin, it must be used
+// after RequireAuth
+func (c *Config) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+
+		if !ok || !user.IsAdmin() {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "Forbidden: admin access required"}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
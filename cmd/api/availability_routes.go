@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// availabilityCacheTTL is kept short on purpose, the summary is only used on
+// listing pages and must not drift too far from the real seat map
+const availabilityCacheTTL = 30 * time.Second
+
+// maxAvailabilityBatch caps how many showtimes can be summarised in one request
+const maxAvailabilityBatch = 50
+
+type ShowtimeRef struct {
+	MovieTimeSlotID int32 `json:"movieTimeSlotId" validate:"required,gt=0"`
+	VenueID         int32 `json:"venueId" validate:"required,gt=0"`
+}
+
+type ShowtimeAvailability struct {
+	MovieTimeSlotID int32          `json:"movieTimeSlotId"`
+	VenueID         int32          `json:"venueId"`
+	TotalSeats      int            `json:"totalSeats"`
+	AvailableSeats  int            `json:"availableSeats"`
+	AvailableByType map[string]int `json:"availableByType"`
+	MinPrice        int32          `json:"minPrice"`
+	MaxPrice        int32          `json:"maxPrice"`
+	Error           string         `json:"error,omitempty"`
+}
+
+func availabilityCacheKey(ref ShowtimeRef) string {
+	return fmt.Sprintf("availability:%d:%d", ref.MovieTimeSlotID, ref.VenueID)
+}
+
+// summariseAvailability builds the per showtime summary from the venue seat
+// matrix and the seats already booked for that showtime. Prices are taken from
+// the seats that are still available so that a sold out category does not
+// widen the advertised range.
+func summariseAvailability(ref ShowtimeRef, seats []*pb.SeatMatrix, booked []*pb.BookedSeats) ShowtimeAvailability {
+	summary := ShowtimeAvailability{
+		MovieTimeSlotID: ref.MovieTimeSlotID,
+		VenueID:         ref.VenueID,
+		TotalSeats:      len(seats),
+		AvailableByType: make(map[string]int),
+	}
+
+	bookedIDs := make(map[int32]bool, len(booked))
+
+	for _, b := range booked {
+		bookedIDs[b.SeatMatrixID] = true
+	}
+
+	for _, seat := range seats {
+		if bookedIDs[seat.Id] {
+			continue
+		}
+
+		seatType := seat.Type.String()
+
+		summary.AvailableSeats++
+		summary.AvailableByType[seatType]++
+
+		// the first available seat sets the range, free seats included
+		if summary.AvailableSeats == 1 || seat.Price < summary.MinPrice {
+			summary.MinPrice = seat.Price
+		}
+
+		if seat.Price > summary.MaxPrice {
+			summary.MaxPrice = seat.Price
+		}
+	}
+
+	return summary
+}
+
+// fetchShowtimeAvailability resolves the summary for every showtime in refs.
+// Cached summaries are served from redis, the rest are computed by fetching the
+// seat matrix of every distinct venue and the booked seats of every showtime
+// concurrently.
+func (c *Config) fetchShowtimeAvailability(ctx context.Context, refs []ShowtimeRef) []ShowtimeAvailability {
+	results := make([]ShowtimeAvailability, len(refs))
+	missing := make([]int, 0, len(refs))
+
+	for i, ref := range refs {
+		if c.RedisClient != nil {
+			cached, err := c.RedisClient.Get(ctx, availabilityCacheKey(ref)).Bytes()
+
+			if err == nil && json.Unmarshal(cached, &results[i]) == nil {
+				continue
+			}
+		}
+
+		missing = append(missing, i)
+	}
+
+	if len(missing) == 0 {
+		return results
+	}
+
+	venueIDs := make(map[int32]bool)
+	slotIDs := make(map[int32]bool)
+
+	for _, i := range missing {
+		venueIDs[refs[i].VenueID] = true
+		slotIDs[refs[i].MovieTimeSlotID] = true
+	}
+
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		seatMatrix  = make(map[int32][]*pb.SeatMatrix)
+		matrixErr   = make(map[int32]error)
+		bookedSeats = make(map[int32][]*pb.BookedSeats)
+		bookedErr   = make(map[int32]error)
+	)
+
+	for venueID := range venueIDs {
+		wg.Add(1)
+
+		go func(venueID int32) {
+			defer wg.Done()
+
+			response, err := c.MovieDB_service.GetSeatMatrix(ctx, &pb.GetSeatMatrixRequest{
+				Venueid: venueID,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				matrixErr[venueID] = err
+				return
+			}
+
+			if response == nil || len(response.Seats) == 0 {
+				matrixErr[venueID] = fmt.Errorf("no seat matrix could be found for venue %d", venueID)
+				return
+			}
+
+			seatMatrix[venueID] = response.Seats
+		}(venueID)
+	}
+
+	for slotID := range slotIDs {
+		wg.Add(1)
+
+		go func(slotID int32) {
+			defer wg.Done()
+
+			response, err := c.MovieDB_service.GetBookedSeats(ctx, &pb.GetBookedSeatsRequest{
+				MovieTimeSlotId: slotID,
+			})
+
+			if err != nil {
+				mu.Lock()
+				bookedErr[slotID] = err
+				mu.Unlock()
+				return
+			}
+
+			// held seats cannot be booked either
+			booked := c.withHeldSeats(ctx, slotID, response.GetBookedSeats())
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			bookedSeats[slotID] = booked
+		}(slotID)
+	}
+
+	wg.Wait()
+
+	for _, i := range missing {
+		ref := refs[i]
+
+		if err := matrixErr[ref.VenueID]; err != nil {
+			results[i] = ShowtimeAvailability{MovieTimeSlotID: ref.MovieTimeSlotID, VenueID: ref.VenueID, Error: err.Error()}
+			continue
+		}
+
+		if err := bookedErr[ref.MovieTimeSlotID]; err != nil {
+			results[i] = ShowtimeAvailability{MovieTimeSlotID: ref.MovieTimeSlotID, VenueID: ref.VenueID, Error: err.Error()}
+			continue
+		}
+
+		results[i] = summariseAvailability(ref, seatMatrix[ref.VenueID], bookedSeats[ref.MovieTimeSlotID])
+
+		if c.RedisClient == nil {
+			continue
+		}
+
+		encoded, err := json.Marshal(results[i])
+
+		if err != nil {
+			continue
+		}
+
+		if err := c.RedisClient.Set(ctx, availabilityCacheKey(ref), encoded, availabilityCacheTTL).Err(); err != nil {
+			log.Error("error caching showtime availability: ", err)
+		}
+	}
+
+	return results
+}
+
+// parseShowtimeRefs reads the showtime query parameters of the GET form,
+// each one is "movieTimeSlotId:venueId" and may list several comma separated
+func parseShowtimeRefs(values []string) ([]ShowtimeRef, error) {
+	var refs []ShowtimeRef
+
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			slot, venue, ok := strings.Cut(strings.TrimSpace(pair), ":")
+
+			if !ok {
+				return nil, fmt.Errorf("%q is not movieTimeSlotId:venueId", pair)
+			}
+
+			slotID, err := strconv.Atoi(slot)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid movie time slot id %q", slot)
+			}
+
+			venueID, err := strconv.Atoi(venue)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid venue id %q", venue)
+			}
+
+			refs = append(refs, ShowtimeRef{MovieTimeSlotID: int32(slotID), VenueID: int32(venueID)})
+		}
+	}
+
+	return refs, nil
+}
+
+type ShowtimeAvailabilityRequest struct {
+	Showtimes []ShowtimeRef `json:"showtimes" validate:"required,min=1,dive"`
+}
+
+func (c *Config) GetShowtimeAvailability(w http.ResponseWriter, r *http.Request) {
+	var requestBody ShowtimeAvailabilityRequest
+
+	var err error
+
+	if r.Method == http.MethodGet {
+		requestBody.Showtimes, err = parseShowtimeRefs(r.URL.Query()["showtime"])
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "error parsing showtime parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		bodyBytes, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "error reading request body", http.StatusBadRequest)
+			return
+		}
+
+		err = utils.UnmarshalJSON(bodyBytes, &requestBody)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "error unmarshalling request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err = c.Validator.Struct(requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, "error validating request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(requestBody.Showtimes) > maxAvailabilityBatch {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "At most %d showtimes can be requested at once"}`, maxAvailabilityBatch), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	summaries := c.fetchShowtimeAvailability(ctx, requestBody.Showtimes)
+
+	jsonResponse, err := utils.MarshalJSON(summaries)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,374 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// Best available seats are picked from the seats that are free, of the
+// preferred type and within the price. A block of seats next to each other in
+// one row is always preferred, the party is only split over rows when no row
+// has room for all of it. Blocks are scored by how central they are and by how
+// far their row is from the screen.
+
+const (
+	// idealRowDepth is where the best rows are, as a share of the way from the
+	// first row at the screen to the last row
+	idealRowDepth = 0.6
+	// weights of centrality and row depth in the score of a block
+	centralityWeight = 0.6
+	depthWeight      = 0.4
+	// bestSeatsAttempts bounds how often the seats are picked again when
+	// someone else holds them first
+	bestSeatsAttempts = 3
+)
+
+type BestSeatsRequest struct {
+	// VenueID is the venue of the showtime, its seat matrix lays the seats out
+	VenueID int32 `json:"venueId" validate:"required,gt=0"`
+	// Count is the size of the party
+	Count int `json:"count" validate:"required,min=1,max=10"`
+	// SeatType is a SeatType name, any type when empty
+	SeatType string `json:"seatType"`
+	// MaxPrice is the highest price of a seat, any price when 0
+	MaxPrice int32 `json:"maxPrice" validate:"gte=0"`
+}
+
+// BestSeatsHold is the hold placed on the best available seats
+type BestSeatsHold struct {
+	SeatHold
+	Seats      []*pb.SeatMatrix `json:"seats"`
+	TotalPrice int32            `json:"totalPrice"`
+	// Together is false when the party had to be split over rows
+	Together bool `json:"together"`
+}
+
+// parseSeatType parses a seat type such as "VIP" or "vip". An empty seat type
+// means any seat type and returns nil.
+func parseSeatType(seatType string) (*pb.SeatType, error) {
+	if seatType == "" {
+		return nil, nil
+	}
+
+	value, ok := pb.SeatType_value[strings.ToUpper(seatType)]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown seat type %q", seatType)
+	}
+
+	parsed := pb.SeatType(value)
+
+	return &parsed, nil
+}
+
+// seatBlock is a run of seats next to each other in a row
+type seatBlock struct {
+	seats []*pb.SeatMatrix
+	score float64
+}
+
+// bestSeatPicker scores the blocks of a seat map
+type bestSeatPicker struct {
+	seats  *seatMap
+	rules  SeatRules
+	aisles map[int32]bool
+	// depth is how far a row is from the screen, from 0 to 1
+	depth map[int32]float64
+	// centre and halfWidth of every row, in columns
+	centre    map[int32]float64
+	halfWidth map[int32]float64
+}
+
+func newBestSeatPicker(seats *seatMap, rules SeatRules) *bestSeatPicker {
+	picker := &bestSeatPicker{
+		seats:     seats,
+		rules:     rules,
+		aisles:    map[int32]bool{},
+		depth:     map[int32]float64{},
+		centre:    map[int32]float64{},
+		halfWidth: map[int32]float64{},
+	}
+
+	for _, column := range rules.Aisles {
+		picker.aisles[column] = true
+	}
+
+	rows := make([]int32, 0, len(seats.cells))
+
+	for row, cells := range seats.cells {
+		rows = append(rows, row)
+
+		first, last := int32(math.MaxInt32), int32(math.MinInt32)
+
+		for column := range cells {
+			first = min(first, column)
+			last = max(last, column)
+		}
+
+		picker.centre[row] = float64(first+last) / 2
+		picker.halfWidth[row] = max(float64(last-first)/2, 1)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i] < rows[j] })
+
+	for i, row := range rows {
+		if len(rows) > 1 {
+			picker.depth[row] = float64(i) / float64(len(rows)-1)
+		}
+	}
+
+	return picker
+}
+
+// score rates a block from 1 for a block in the middle of an ideal row down
+func (p *bestSeatPicker) score(block []*pb.SeatMatrix) float64 {
+	row := block[0].Row
+	middle := float64(block[0].Column+block[len(block)-1].Column) / 2
+
+	centrality := math.Abs(middle-p.centre[row]) / p.halfWidth[row]
+	depth := math.Abs(p.depth[row]-idealRowDepth) / max(idealRowDepth, 1-idealRowDepth)
+
+	return 1 - centralityWeight*centrality - depthWeight*depth
+}
+
+// bestBlock returns the best block of size seats out of the seats that can be
+// picked, nil when there is none. Blocks that break the seat rules together
+// with the seats picked so far are passed over.
+func (p *bestSeatPicker) bestBlock(size int, pickable map[int32]bool, picked []int32) *seatBlock {
+	var best *seatBlock
+
+	for _, cells := range p.seats.cells {
+		for _, seat := range cells {
+			// every seat is tried as the leftmost seat of a block
+			if !pickable[seat.Id] {
+				continue
+			}
+
+			block := []*pb.SeatMatrix{seat}
+
+			for len(block) < size {
+				next := p.seats.neighbour(block[len(block)-1], 1, p.aisles)
+
+				if next == nil || !pickable[next.Id] {
+					break
+				}
+
+				block = append(block, next)
+			}
+
+			if len(block) < size {
+				continue
+			}
+
+			selection := append([]int32(nil), picked...)
+
+			for _, seat := range block {
+				selection = append(selection, seat.Id)
+			}
+
+			if p.seats.checkSeatRules(p.rules, selection) != nil {
+				continue
+			}
+
+			candidate := &seatBlock{seats: block, score: p.score(block)}
+
+			if best == nil || better(candidate, best) {
+				best = candidate
+			}
+		}
+	}
+
+	return best
+}
+
+// better orders blocks by score, then from the front row and the left
+func better(a *seatBlock, b *seatBlock) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+
+	if a.seats[0].Row != b.seats[0].Row {
+		return a.seats[0].Row < b.seats[0].Row
+	}
+
+	return a.seats[0].Column < b.seats[0].Column
+}
+
+// pick returns the best count seats that match seatType and maxPrice. The
+// party is kept together when a row has room for it, otherwise it is split
+// into the largest blocks that fit. It returns nil when there are not enough
+// seats.
+func (p *bestSeatPicker) pick(count int, seatType *pb.SeatType, maxPrice int32) ([]*pb.SeatMatrix, bool) {
+	pickable := map[int32]bool{}
+
+	for id, seat := range p.seats.seats {
+		if p.seats.taken(id) || (seatType != nil && seat.Type != *seatType) || (maxPrice > 0 && seat.Price > maxPrice) {
+			continue
+		}
+
+		pickable[id] = true
+	}
+
+	var picked []int32
+	var seats []*pb.SeatMatrix
+	blocks := 0
+
+	for remaining := count; remaining > 0; {
+		var block *seatBlock
+
+		for size := remaining; size > 0 && block == nil; size-- {
+			block = p.bestBlock(size, pickable, picked)
+		}
+
+		if block == nil {
+			return nil, false
+		}
+
+		for _, seat := range block.seats {
+			delete(pickable, seat.Id)
+			picked = append(picked, seat.Id)
+			seats = append(seats, seat)
+		}
+
+		remaining -= len(block.seats)
+		blocks++
+	}
+
+	return seats, blocks == 1
+}
+
+// HoldBestSeats picks the best available seats of a showtime for a party and
+// holds them for the signed in user right away
+func (c *Config) HoldBestSeats(w http.ResponseWriter, r *http.Request) {
+	var requestBody BestSeatsRequest
+
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	slotID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.UnmarshalJSON(bodyBytes, &requestBody); err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.VenueID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venueId of the showtime is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Count < 1 || requestBody.Count > maxSeatsPerHold {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "count must be between 1 and %d"}`, maxSeatsPerHold), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.MaxPrice < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "maxPrice cannot be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	seatType, err := parseSeatType(requestBody.SeatType)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Seat holds are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	rules, err := c.venueSeatRules(r.Context(), requestBody.VenueID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading seat rules: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// the seats are picked again when someone else holds one of them between
+	// reading the seat map and placing the hold
+	for attempt := 0; attempt < bestSeatsAttempts; attempt++ {
+		seats, err := c.showtimeSeatMap(r.Context(), slotID, requestBody.VenueID)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if seats == nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "No seat matrix could be found for the venue"}`, http.StatusNotFound)
+			return
+		}
+
+		best, together := newBestSeatPicker(seats, rules).pick(requestBody.Count, seatType, requestBody.MaxPrice)
+
+		if best == nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "There are not %d seats available that match the seat type and price"}`, requestBody.Count), http.StatusConflict)
+			return
+		}
+
+		seatIDs := make([]int32, len(best))
+		response := BestSeatsHold{Seats: best, Together: together}
+
+		for i, seat := range best {
+			seatIDs[i] = seat.Id
+			response.TotalPrice += seat.Price
+		}
+
+		hold, taken, err := c.placeSeatHold(r.Context(), seats, user.UserID, seatIDs)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if len(taken) > 0 {
+			continue
+		}
+
+		response.SeatHold = *hold
+
+		writeJSON(w, http.StatusCreated, response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	http.Error(w, `{"error": "The seats were taken while they were picked, try again"}`, http.StatusConflict)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// The broker keeps its own light weight trail of the bookings that go through
+// it. MovieDB only knows about seats and time slots, this trail is what lets
+// the broker answer "which movies has this user booked" and "how fast is this
+// movie selling" without a round trip.
+
+// bookingVelocityRetention is how long the hourly booking counters are kept,
+// older buckets no longer contribute to the trending score anyway
+const bookingVelocityRetention = 8 * 24 * time.Hour
+
+func userBookedMoviesKey(email string) string {
+	return fmt.Sprintf("bookings:user:%s:movies", strings.ToLower(email))
+}
+
+// userBookedSeatsKey holds the seats email booked for movieID as
+// slotID:venueID:seat members, it is what a review is verified against
+func userBookedSeatsKey(email string, movieID int32) string {
+	return fmt.Sprintf("bookings:user:%s:movie:%d:seats", strings.ToLower(email), movieID)
+}
+
+func bookingVelocityKey(movieID int32, hour time.Time) string {
+	return fmt.Sprintf("bookings:velocity:%d:%d", movieID, hour.Truncate(time.Hour).Unix())
+}
+
+// venueShowsMovie reports whether venueID has a time slot of movieID. MovieDB
+// does not give time slots an id, so a booked time slot is tied to its movie
+// through the venue it is booked at. Time slots that do not name their movie
+// show none.
+func (c *Config) venueShowsMovie(ctx context.Context, movieID int32, venueID int32) (bool, error) {
+	if movieID <= 0 || venueID <= 0 {
+		return false, nil
+	}
+
+	response, err := c.MovieDB_service.GetMovie(ctx, &pb.MovieRequest{
+		Movieid: strconv.Itoa(int(movieID)),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, venue := range response.GetMovie().GetVenues() {
+		if venue.Id != venueID {
+			continue
+		}
+
+		for _, slot := range venue.MovieTimeSlots {
+			if slot.Movieid == movieID {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// recordBooking adds movieID and the seats booked for slotID to the booking
+// history of email and counts the seats towards the booking velocity of the
+// movie. email is the signed in user, anonymous bookings only count towards
+// the velocity. movieID is sent by the client, the booking is only recorded
+// when venueID, where the seats were booked, shows the movie.
+func (c *Config) recordBooking(ctx context.Context, email string, movieID int32, slotID int32, venueID int32, seats []string) error {
+	if c.RedisClient == nil || movieID <= 0 {
+		return nil
+	}
+
+	shows, err := c.venueShowsMovie(ctx, movieID, venueID)
+
+	if err != nil {
+		return err
+	}
+
+	if !shows {
+		log.Warnf("venue %d does not show movie %d, the booking of time slot %d is not recorded", venueID, movieID, slotID)
+		return nil
+	}
+
+	now := time.Now()
+
+	pipe := c.RedisClient.TxPipeline()
+
+	if email != "" {
+		pipe.ZAdd(ctx, userBookedMoviesKey(email), redis.Z{
+			Score:  float64(now.Unix()),
+			Member: movieID,
+		})
+
+		if slotID > 0 && len(seats) > 0 {
+			members := make([]any, len(seats))
+
+			for i, seat := range seats {
+				members[i] = fmt.Sprintf("%d:%d:%s", slotID, venueID, seat)
+			}
+
+			pipe.SAdd(ctx, userBookedSeatsKey(email, movieID), members...)
+		}
+	}
+
+	velocityKey := bookingVelocityKey(movieID, now)
+
+	pipe.IncrBy(ctx, velocityKey, int64(len(seats)))
+	pipe.Expire(ctx, velocityKey, bookingVelocityRetention)
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// bookingVelocity returns the number of seats booked for movieID in each of the
+// last hours, index 0 being the current hour
+func (c *Config) bookingVelocity(ctx context.Context, movieID int32, hours int) ([]int64, error) {
+	counts := make([]int64, hours)
+
+	if c.RedisClient == nil || hours <= 0 {
+		return counts, nil
+	}
+
+	keys := make([]string, hours)
+	now := time.Now()
+
+	for i := range keys {
+		keys[i] = bookingVelocityKey(movieID, now.Add(-time.Duration(i)*time.Hour))
+	}
+
+	values, err := c.RedisClient.MGet(ctx, keys...).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		raw, ok := value.(string)
+
+		if !ok {
+			continue
+		}
+
+		count, err := strconv.ParseInt(raw, 10, 64)
+
+		if err == nil {
+			counts[i] = count
+		}
+	}
+
+	return counts, nil
+}
+
+// bookedMovieIDs returns the movies email has booked through the broker, most
+// recent first
+func (c *Config) bookedMovieIDs(ctx context.Context, email string) ([]int32, error) {
+	if c.RedisClient == nil || email == "" {
+		return nil, nil
+	}
+
+	members, err := c.RedisClient.ZRevRange(ctx, userBookedMoviesKey(email), 0, -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int32, 0, len(members))
+
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 32)
+
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, int32(id))
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// coalescedCallTimeout bounds the shared backend call, it no longer belongs
+// to a single request so it cannot use that request's deadline
+const coalescedCallTimeout = 10 * time.Second
+
+// CoalescingClient is a MovieDBServiceClient that shares one backend call
+// between concurrent identical reads. Writes are passed through untouched.
+type CoalescingClient struct {
+	pb.MovieDBServiceClient
+
+	group singleflight.Group
+
+	// requests counts the reads per method and backendCalls the calls that
+	// actually reached the backend, the difference was deduplicated
+	requests     *expvar.Map
+	backendCalls *expvar.Map
+	metrics      *expvar.Map
+}
+
+func NewCoalescingClient(client pb.MovieDBServiceClient) *CoalescingClient {
+	c := &CoalescingClient{
+		MovieDBServiceClient: client,
+		requests:             new(expvar.Map).Init(),
+		backendCalls:         new(expvar.Map).Init(),
+		metrics:              new(expvar.Map).Init(),
+	}
+
+	c.metrics.Set("requests", c.requests)
+	c.metrics.Set("backend_calls", c.backendCalls)
+	c.metrics.Set("deduplicated", expvar.Func(func() any {
+		deduplicated := map[string]int64{}
+
+		c.requests.Do(func(kv expvar.KeyValue) {
+			deduplicated[kv.Key] = c.Deduplicated(kv.Key)
+		})
+
+		return deduplicated
+	}))
+
+	return c
+}
+
+// Metrics returns the request and deduplication counters per method, ready
+// to be published with expvar.Publish
+func (c *CoalescingClient) Metrics() *expvar.Map {
+	return c.metrics
+}
+
+// Deduplicated returns how many reads of method were answered by a backend
+// call another request had already started
+func (c *CoalescingClient) Deduplicated(method string) int64 {
+	return counter(c.requests, method) - counter(c.backendCalls, method)
+}
+
+func counter(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+// coalesce runs fetch once for all concurrent calls of method with an equal
+// request. Every caller still honours its own context and gets its own copy of
+// the response, so handlers may modify it freely.
+func coalesce[Resp proto.Message](ctx context.Context, c *CoalescingClient, method string, req proto.Message, fetch func(ctx context.Context) (Resp, error)) (Resp, error) {
+	c.requests.Add(method, 1)
+
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+
+	if err != nil {
+		c.backendCalls.Add(method, 1)
+		return fetch(ctx)
+	}
+
+	key := method + ":" + string(encoded)
+
+	result := c.group.DoChan(key, func() (any, error) {
+		c.backendCalls.Add(method, 1)
+
+		callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalescedCallTimeout)
+		defer cancel()
+
+		return fetch(callCtx)
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero Resp
+		return zero, ctx.Err()
+	case res := <-result:
+		resp, _ := res.Val.(Resp)
+
+		if res.Err != nil {
+			return resp, res.Err
+		}
+
+		if res.Shared && resp.ProtoReflect().IsValid() {
+			resp = proto.Clone(resp).(Resp)
+		}
+
+		return resp, nil
+	}
+}
+
+func (c *CoalescingClient) GetMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	return coalesce(ctx, c, "GetMovie", in, func(ctx context.Context) (*pb.MovieResponse, error) {
+		return c.MovieDBServiceClient.GetMovie(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetAllMovies(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*pb.MovieListResponse, error) {
+	return coalesce(ctx, c, "GetAllMovies", in, func(ctx context.Context) (*pb.MovieListResponse, error) {
+		return c.MovieDBServiceClient.GetAllMovies(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetVenue(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	return coalesce(ctx, c, "GetVenue", in, func(ctx context.Context) (*pb.VenueResponse, error) {
+		return c.MovieDBServiceClient.GetVenue(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetAllVenues(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*pb.MovieListResponse, error) {
+	return coalesce(ctx, c, "GetAllVenues", in, func(ctx context.Context) (*pb.MovieListResponse, error) {
+		return c.MovieDBServiceClient.GetAllVenues(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetUpcomingMovies(ctx context.Context, in *pb.GetUpcomingMovieRequest, opts ...grpc.CallOption) (*pb.GetUpcomingMovieResponse, error) {
+	return coalesce(ctx, c, "GetUpcomingMovies", in, func(ctx context.Context) (*pb.GetUpcomingMovieResponse, error) {
+		return c.MovieDBServiceClient.GetUpcomingMovies(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetNowPlayingMovies(ctx context.Context, in *pb.GetNowPlayingMovieRequest, opts ...grpc.CallOption) (*pb.GetUpcomingMovieResponse, error) {
+	return coalesce(ctx, c, "GetNowPlayingMovies", in, func(ctx context.Context) (*pb.GetUpcomingMovieResponse, error) {
+		return c.MovieDBServiceClient.GetNowPlayingMovies(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetReview(ctx context.Context, in *pb.ReviewRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	return coalesce(ctx, c, "GetReview", in, func(ctx context.Context) (*pb.ReviewResponse, error) {
+		return c.MovieDBServiceClient.GetReview(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	return coalesce(ctx, c, "GetAllMovieReviews", in, func(ctx context.Context) (*pb.ReviewListResponse, error) {
+		return c.MovieDBServiceClient.GetAllMovieReviews(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetMovieTimeSlots(ctx context.Context, in *pb.GetMovieTimeSlotRequest, opts ...grpc.CallOption) (*pb.GetMovieTimeSlotResponse, error) {
+	return coalesce(ctx, c, "GetMovieTimeSlots", in, func(ctx context.Context) (*pb.GetMovieTimeSlotResponse, error) {
+		return c.MovieDBServiceClient.GetMovieTimeSlots(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetSeatMatrix(ctx context.Context, in *pb.GetSeatMatrixRequest, opts ...grpc.CallOption) (*pb.GetSeatMatrixResponse, error) {
+	return coalesce(ctx, c, "GetSeatMatrix", in, func(ctx context.Context) (*pb.GetSeatMatrixResponse, error) {
+		return c.MovieDBServiceClient.GetSeatMatrix(ctx, in, opts...)
+	})
+}
+
+func (c *CoalescingClient) GetBookedSeats(ctx context.Context, in *pb.GetBookedSeatsRequest, opts ...grpc.CallOption) (*pb.GetBookedSeatsResponse, error) {
+	return coalesce(ctx, c, "GetBookedSeats", in, func(ctx context.Context) (*pb.GetBookedSeatsResponse, error) {
+		return c.MovieDBServiceClient.GetBookedSeats(ctx, in, opts...)
+	})
+}
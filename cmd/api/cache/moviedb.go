@@ -0,0 +1,415 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// TTL is how long a cached response is served as is. Once it is older than
+// Fresh it is still served for up to Stale while it is refreshed in the
+// background (stale-while-revalidate).
+type TTL struct {
+	Fresh time.Duration
+	Stale time.Duration
+}
+
+type TTLs struct {
+	GetMovie            TTL
+	GetAllMovies        TTL
+	GetVenue            TTL
+	GetUpcomingMovies   TTL
+	GetNowPlayingMovies TTL
+	GetAllMovieReviews  TTL
+	GetMovieTimeSlots   TTL
+	GetSeatMatrix       TTL
+}
+
+// DefaultTTLs reflect how often the data changes, seat matrices are only
+// touched when a screen is refitted while reviews come in all the time
+var DefaultTTLs = TTLs{
+	GetMovie:            TTL{Fresh: 10 * time.Minute, Stale: 10 * time.Minute},
+	GetAllMovies:        TTL{Fresh: 5 * time.Minute, Stale: 5 * time.Minute},
+	GetVenue:            TTL{Fresh: 10 * time.Minute, Stale: 10 * time.Minute},
+	GetUpcomingMovies:   TTL{Fresh: 10 * time.Minute, Stale: 10 * time.Minute},
+	GetNowPlayingMovies: TTL{Fresh: 5 * time.Minute, Stale: 5 * time.Minute},
+	GetAllMovieReviews:  TTL{Fresh: time.Minute, Stale: time.Minute},
+	GetMovieTimeSlots:   TTL{Fresh: 2 * time.Minute, Stale: 2 * time.Minute},
+	GetSeatMatrix:       TTL{Fresh: 30 * time.Minute, Stale: 30 * time.Minute},
+}
+
+// revalidateLockTTL bounds how long a single background refresh may hold the
+// lock of a key before another one is allowed to start
+const revalidateLockTTL = 10 * time.Second
+
+// Cache tags, every cached response is registered under the tags it depends on
+// so that writes can drop exactly the responses they make outdated
+const (
+	tagMovies    = "movies"
+	tagTimeSlots = "timeslots"
+)
+
+func movieTag(id any) string {
+	return fmt.Sprintf("movie:%v", id)
+}
+
+func venueTag(id any) string {
+	return fmt.Sprintf("venue:%v", id)
+}
+
+func seatMatrixTag(venueID int32) string {
+	return fmt.Sprintf("seatmatrix:%d", venueID)
+}
+
+func reviewsTag(movieID int32) string {
+	return fmt.Sprintf("reviews:%d", movieID)
+}
+
+// MovieDBCache is a MovieDBServiceClient that serves the catalog reads from
+// redis. Reads that are not cached and all writes are passed through to the
+// wrapped client, writes drop the cached responses they affect.
+type MovieDBCache struct {
+	pb.MovieDBServiceClient
+
+	redis *redis.Client
+	ttls  TTLs
+}
+
+func NewMovieDBCache(client pb.MovieDBServiceClient, redisClient *redis.Client, ttls TTLs) *MovieDBCache {
+	return &MovieDBCache{
+		MovieDBServiceClient: client,
+		redis:                redisClient,
+		ttls:                 ttls,
+	}
+}
+
+type cacheable interface {
+	proto.Message
+	GetError() string
+}
+
+func cacheKey(endpoint string, req proto.Message) (string, error) {
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum(encoded)
+
+	return fmt.Sprintf("moviedb:%s:%s", endpoint, hex.EncodeToString(sum[:])), nil
+}
+
+func tagKey(tag string) string {
+	return "moviedb:tag:" + tag
+}
+
+// encodeEntry prefixes the response with the time until which it is fresh
+func encodeEntry(resp proto.Message, freshUntil time.Time) ([]byte, error) {
+	encoded, err := proto.Marshal(resp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := make([]byte, 8, 8+len(encoded))
+	binary.BigEndian.PutUint64(entry, uint64(freshUntil.UnixMilli()))
+
+	return append(entry, encoded...), nil
+}
+
+func decodeEntry(entry []byte, resp proto.Message) (time.Time, error) {
+	if len(entry) < 8 {
+		return time.Time{}, errors.New("cache entry is too short")
+	}
+
+	freshUntil := time.UnixMilli(int64(binary.BigEndian.Uint64(entry[:8])))
+
+	return freshUntil, proto.Unmarshal(entry[8:], resp)
+}
+
+func (m *MovieDBCache) store(ctx context.Context, key string, resp proto.Message, ttl TTL, tags []string) {
+	entry, err := encodeEntry(resp, time.Now().Add(ttl.Fresh))
+
+	if err != nil {
+		log.Error("error encoding cache entry: ", err)
+		return
+	}
+
+	expiry := ttl.Fresh + ttl.Stale
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, key, entry, expiry)
+
+	for _, tag := range tags {
+		pipe.SAdd(ctx, tagKey(tag), key)
+		pipe.Expire(ctx, tagKey(tag), 2*expiry)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error("error storing cache entry: ", err)
+	}
+}
+
+// cached serves endpoint from the cache when possible and falls back to fetch.
+// Redis errors are logged and never fail the call, the cache is best effort.
+func cached[Resp cacheable](ctx context.Context, m *MovieDBCache, endpoint string, req proto.Message, ttl TTL, tags []string, newResp func() Resp, fetch func(ctx context.Context) (Resp, error)) (Resp, error) {
+	key, err := cacheKey(endpoint, req)
+
+	if err != nil {
+		return fetch(ctx)
+	}
+
+	entry, err := m.redis.Get(ctx, key).Bytes()
+
+	if err == nil {
+		resp := newResp()
+		freshUntil, decodeErr := decodeEntry(entry, resp)
+
+		if decodeErr == nil {
+			if time.Now().After(freshUntil) {
+				revalidate(m, key, ttl, tags, fetch)
+			}
+
+			return resp, nil
+		}
+
+		log.Error("error decoding cache entry: ", decodeErr)
+	} else if err != redis.Nil {
+		log.Error("error reading cache entry: ", err)
+	}
+
+	resp, err := fetch(ctx)
+
+	if err != nil || !resp.ProtoReflect().IsValid() || resp.GetError() != "" {
+		return resp, err
+	}
+
+	m.store(ctx, key, resp, ttl, tags)
+
+	return resp, nil
+}
+
+// revalidate refreshes a stale entry in the background. Only one refresh per
+// key runs at a time across all broker instances.
+func revalidate[Resp cacheable](m *MovieDBCache, key string, ttl TTL, tags []string, fetch func(ctx context.Context) (Resp, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	acquired, err := m.redis.SetNX(ctx, key+":lock", 1, revalidateLockTTL).Result()
+
+	if err != nil || !acquired {
+		cancel()
+		return
+	}
+
+	go func() {
+		defer cancel()
+		defer m.redis.Del(context.Background(), key+":lock")
+
+		resp, err := fetch(ctx)
+
+		if err != nil {
+			log.Error("error revalidating cache entry: ", err)
+			return
+		}
+
+		if !resp.ProtoReflect().IsValid() || resp.GetError() != "" {
+			return
+		}
+
+		m.store(ctx, key, resp, ttl, tags)
+	}()
+}
+
+// Invalidate drops every cached response registered under one of tags
+func (m *MovieDBCache) Invalidate(ctx context.Context, tags ...string) {
+	for _, tag := range tags {
+		keys, err := m.redis.SMembers(ctx, tagKey(tag)).Result()
+
+		if err != nil {
+			log.Error("error reading cache tag: ", err)
+			continue
+		}
+
+		if err := m.redis.Del(ctx, append(keys, tagKey(tag))...).Err(); err != nil {
+			log.Error("error invalidating cache tag: ", err)
+		}
+	}
+}
+
+// invalidateAfter drops tags once a write went through successfully
+func invalidateAfter[Resp cacheable](ctx context.Context, m *MovieDBCache, resp Resp, err error, tags ...string) (Resp, error) {
+	if err == nil && resp.GetError() == "" {
+		m.Invalidate(ctx, tags...)
+	}
+
+	return resp, err
+}
+
+// Cached reads
+
+// GetMovie and GetVenue embed their venues and time slots, so time slot and
+// venue writes (which all drop tagTimeSlots) have to drop them too
+
+func (m *MovieDBCache) GetMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	return cached(ctx, m, "GetMovie", in, m.ttls.GetMovie, []string{movieTag(in.Movieid), tagTimeSlots},
+		func() *pb.MovieResponse { return &pb.MovieResponse{} },
+		func(ctx context.Context) (*pb.MovieResponse, error) {
+			return m.MovieDBServiceClient.GetMovie(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetAllMovies(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*pb.MovieListResponse, error) {
+	return cached(ctx, m, "GetAllMovies", in, m.ttls.GetAllMovies, []string{tagMovies},
+		func() *pb.MovieListResponse { return &pb.MovieListResponse{} },
+		func(ctx context.Context) (*pb.MovieListResponse, error) {
+			return m.MovieDBServiceClient.GetAllMovies(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetVenue(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	return cached(ctx, m, "GetVenue", in, m.ttls.GetVenue, []string{venueTag(in.Venueid), tagTimeSlots},
+		func() *pb.VenueResponse { return &pb.VenueResponse{} },
+		func(ctx context.Context) (*pb.VenueResponse, error) {
+			return m.MovieDBServiceClient.GetVenue(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetUpcomingMovies(ctx context.Context, in *pb.GetUpcomingMovieRequest, opts ...grpc.CallOption) (*pb.GetUpcomingMovieResponse, error) {
+	return cached(ctx, m, "GetUpcomingMovies", in, m.ttls.GetUpcomingMovies, []string{tagMovies},
+		func() *pb.GetUpcomingMovieResponse { return &pb.GetUpcomingMovieResponse{} },
+		func(ctx context.Context) (*pb.GetUpcomingMovieResponse, error) {
+			return m.MovieDBServiceClient.GetUpcomingMovies(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetNowPlayingMovies(ctx context.Context, in *pb.GetNowPlayingMovieRequest, opts ...grpc.CallOption) (*pb.GetUpcomingMovieResponse, error) {
+	return cached(ctx, m, "GetNowPlayingMovies", in, m.ttls.GetNowPlayingMovies, []string{tagMovies, tagTimeSlots},
+		func() *pb.GetUpcomingMovieResponse { return &pb.GetUpcomingMovieResponse{} },
+		func(ctx context.Context) (*pb.GetUpcomingMovieResponse, error) {
+			return m.MovieDBServiceClient.GetNowPlayingMovies(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	return cached(ctx, m, "GetAllMovieReviews", in, m.ttls.GetAllMovieReviews, []string{reviewsTag(in.MovieID)},
+		func() *pb.ReviewListResponse { return &pb.ReviewListResponse{} },
+		func(ctx context.Context) (*pb.ReviewListResponse, error) {
+			return m.MovieDBServiceClient.GetAllMovieReviews(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetMovieTimeSlots(ctx context.Context, in *pb.GetMovieTimeSlotRequest, opts ...grpc.CallOption) (*pb.GetMovieTimeSlotResponse, error) {
+	return cached(ctx, m, "GetMovieTimeSlots", in, m.ttls.GetMovieTimeSlots, []string{tagTimeSlots, movieTag(in.Movieid)},
+		func() *pb.GetMovieTimeSlotResponse { return &pb.GetMovieTimeSlotResponse{} },
+		func(ctx context.Context) (*pb.GetMovieTimeSlotResponse, error) {
+			return m.MovieDBServiceClient.GetMovieTimeSlots(ctx, in, opts...)
+		})
+}
+
+func (m *MovieDBCache) GetSeatMatrix(ctx context.Context, in *pb.GetSeatMatrixRequest, opts ...grpc.CallOption) (*pb.GetSeatMatrixResponse, error) {
+	return cached(ctx, m, "GetSeatMatrix", in, m.ttls.GetSeatMatrix, []string{seatMatrixTag(in.Venueid)},
+		func() *pb.GetSeatMatrixResponse { return &pb.GetSeatMatrixResponse{} },
+		func(ctx context.Context) (*pb.GetSeatMatrixResponse, error) {
+			return m.MovieDBServiceClient.GetSeatMatrix(ctx, in, opts...)
+		})
+}
+
+// Writes, each one drops the cached reads it makes outdated
+
+func (m *MovieDBCache) AddMovie(ctx context.Context, in *pb.Movie, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddMovie(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies)
+}
+
+func (m *MovieDBCache) UpdateMovie(ctx context.Context, in *pb.Movie, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	resp, err := m.MovieDBServiceClient.UpdateMovie(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies, movieTag(in.Id))
+}
+
+func (m *MovieDBCache) DeleteMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteMovie(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies, tagTimeSlots, movieTag(in.Movieid))
+}
+
+func (m *MovieDBCache) AddVenue(ctx context.Context, in *pb.Venue, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddVenue(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies, tagTimeSlots)
+}
+
+func (m *MovieDBCache) UpdateVenue(ctx context.Context, in *pb.Venue, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	resp, err := m.MovieDBServiceClient.UpdateVenue(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies, tagTimeSlots, venueTag(in.Id), seatMatrixTag(in.Id))
+}
+
+func (m *MovieDBCache) DeleteVenue(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteVenue(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagMovies, tagTimeSlots, venueTag(in.Venueid))
+}
+
+func (m *MovieDBCache) AddReview(ctx context.Context, in *pb.Review, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddReview(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, reviewsTag(in.MovieID))
+}
+
+func (m *MovieDBCache) UpdateReview(ctx context.Context, in *pb.ReviewUpdateRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	resp, err := m.MovieDBServiceClient.UpdateReview(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, reviewsTag(in.MovieID))
+}
+
+func (m *MovieDBCache) DeleteReview(ctx context.Context, in *pb.ReviewRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteReview(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, reviewsTag(in.MovieID))
+}
+
+func (m *MovieDBCache) AddMovieTimeSlot(ctx context.Context, in *pb.MovieTimeSlot, opts ...grpc.CallOption) (*pb.MovieTimeSlotResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddMovieTimeSlot(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagTimeSlots, tagMovies)
+}
+
+func (m *MovieDBCache) UpdateMovieTimeSlot(ctx context.Context, in *pb.MovieTimeSlotUpdate, opts ...grpc.CallOption) (*pb.MovieTimeSlotUpdateResponse, error) {
+	resp, err := m.MovieDBServiceClient.UpdateMovieTimeSlot(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagTimeSlots, tagMovies)
+}
+
+func (m *MovieDBCache) DeleteMovieTimeSlot(ctx context.Context, in *pb.MovieTimeSlotDelete, opts ...grpc.CallOption) (*pb.MovieTimeSlotResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteMovieTimeSlot(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, tagTimeSlots, tagMovies)
+}
+
+func (m *MovieDBCache) AddSeatMatrix(ctx context.Context, in *pb.AddSeatMatrixInput, opts ...grpc.CallOption) (*pb.AddSeatMatrixResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddSeatMatrix(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, seatMatrixTag(in.Venueid))
+}
+
+func (m *MovieDBCache) AddSingleSeatMatrix(ctx context.Context, in *pb.AddSingleSeatMatrixInput, opts ...grpc.CallOption) (*pb.AddSingleSeatMatrixResponse, error) {
+	resp, err := m.MovieDBServiceClient.AddSingleSeatMatrix(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, seatMatrixTag(in.Venueid))
+}
+
+func (m *MovieDBCache) UpdateSeatMatrix(ctx context.Context, in *pb.UpdateSeatMatrixRequest, opts ...grpc.CallOption) (*pb.UpdateSeatMatrixResponse, error) {
+	resp, err := m.MovieDBServiceClient.UpdateSeatMatrix(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, seatMatrixTag(in.Venueid))
+}
+
+func (m *MovieDBCache) DeleteSeatMatrix(ctx context.Context, in *pb.DeleteSeatMatrixRequest, opts ...grpc.CallOption) (*pb.DeleteSeatMatrixResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteSeatMatrix(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, seatMatrixTag(in.Venueid))
+}
+
+func (m *MovieDBCache) DeleteEntireSeatMatrix(ctx context.Context, in *pb.DeleteEntireSeatMatrixRequest, opts ...grpc.CallOption) (*pb.DeleteEntireSeatMatrixResponse, error) {
+	resp, err := m.MovieDBServiceClient.DeleteEntireSeatMatrix(ctx, in, opts...)
+	return invalidateAfter(ctx, m, resp, err, seatMatrixTag(in.Venueid))
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+const (
+	calendarDateLayout      = "2006-01-02"
+	defaultCalendarSpanDays = 90
+	maxCalendarSpanDays     = 366
+	defaultCalendarPageSize = 20
+	maxCalendarPageSize     = 100
+)
+
+// releaseDateLayouts are the formats release dates are known to be stored in
+var releaseDateLayouts = []string{
+	calendarDateLayout,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+func parseReleaseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range releaseDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+type calendarQuery struct {
+	From      time.Time
+	To        time.Time
+	GroupBy   string
+	Languages []string
+	Genres    []string
+	Page      int
+	PageSize  int
+}
+
+// parseCalendarQuery validates the query of the releases calendar. "from" and
+// "to" are inclusive dates formatted as YYYY-MM-DD.
+func parseCalendarQuery(r *http.Request) (calendarQuery, error) {
+	query := r.URL.Query()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	q := calendarQuery{
+		From:      today,
+		GroupBy:   "week",
+		Languages: queryList(r, "language"),
+		Genres:    queryList(r, "genre"),
+		Page:      1,
+		PageSize:  defaultCalendarPageSize,
+	}
+
+	var err error
+
+	if raw := query.Get("from"); raw != "" {
+		q.From, err = time.Parse(calendarDateLayout, raw)
+
+		if err != nil {
+			return q, fmt.Errorf("from must be a date formatted as YYYY-MM-DD")
+		}
+	}
+
+	q.To = q.From.AddDate(0, 0, defaultCalendarSpanDays)
+
+	if raw := query.Get("to"); raw != "" {
+		q.To, err = time.Parse(calendarDateLayout, raw)
+
+		if err != nil {
+			return q, fmt.Errorf("to must be a date formatted as YYYY-MM-DD")
+		}
+	}
+
+	if q.To.Before(q.From) {
+		return q, fmt.Errorf("to cannot be before from")
+	}
+
+	if q.To.Sub(q.From) > maxCalendarSpanDays*24*time.Hour {
+		return q, fmt.Errorf("the date range cannot be longer than %d days", maxCalendarSpanDays)
+	}
+
+	if raw := query.Get("group_by"); raw != "" {
+		q.GroupBy = strings.ToLower(raw)
+	}
+
+	if q.GroupBy != "week" && q.GroupBy != "month" {
+		return q, fmt.Errorf("group_by must be either week or month")
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		q.Page, err = strconv.Atoi(raw)
+
+		if err != nil || q.Page < 1 {
+			return q, fmt.Errorf("page must be a positive integer")
+		}
+	}
+
+	if raw := query.Get("page_size"); raw != "" {
+		q.PageSize, err = strconv.Atoi(raw)
+
+		if err != nil || q.PageSize < 1 || q.PageSize > maxCalendarPageSize {
+			return q, fmt.Errorf("page_size must be between 1 and %d", maxCalendarPageSize)
+		}
+	}
+
+	return q, nil
+}
+
+type calendarRelease struct {
+	Movie       *pb.Movie
+	ReleaseDate time.Time
+}
+
+// releasesInRange returns the catalog movies released between q.From and q.To
+// that match the language and genre filters, earliest release first
+func releasesInRange(movies []*pb.Movie, q calendarQuery) []calendarRelease {
+	releases := []calendarRelease{}
+
+	for _, movie := range movies {
+		releaseDate, ok := parseReleaseDate(movie.ReleaseDate)
+
+		if !ok || releaseDate.Before(q.From) || releaseDate.After(q.To) {
+			continue
+		}
+
+		if !search.MatchesAny(movie.Language, q.Languages) || !search.MatchesAny(movie.Type, q.Genres) {
+			continue
+		}
+
+		releases = append(releases, calendarRelease{Movie: movie, ReleaseDate: releaseDate})
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		if !releases[i].ReleaseDate.Equal(releases[j].ReleaseDate) {
+			return releases[i].ReleaseDate.Before(releases[j].ReleaseDate)
+		}
+
+		return releases[i].Movie.Title < releases[j].Movie.Title
+	})
+
+	return releases
+}
+
+type CalendarGroup struct {
+	Key    string      `json:"key"`
+	Start  string      `json:"start"`
+	End    string      `json:"end"`
+	Movies []*pb.Movie `json:"movies"`
+}
+
+// calendarPeriod returns the key and the first and last day of the week (ISO
+// weeks, starting on monday) or month date falls in
+func calendarPeriod(date time.Time, groupBy string) (string, time.Time, time.Time) {
+	if groupBy == "month" {
+		start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		return start.Format("2006-01"), start, start.AddDate(0, 1, -1)
+	}
+
+	offset := (int(date.Weekday()) + 6) % 7
+	start := date.AddDate(0, 0, -offset)
+	year, week := date.ISOWeek()
+
+	return fmt.Sprintf("%d-W%02d", year, week), start, start.AddDate(0, 0, 6)
+}
+
+func groupReleases(releases []calendarRelease, groupBy string) []CalendarGroup {
+	groups := []CalendarGroup{}
+
+	for _, release := range releases {
+		key, start, end := calendarPeriod(release.ReleaseDate, groupBy)
+
+		if len(groups) == 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, CalendarGroup{
+				Key:    key,
+				Start:  start.Format(calendarDateLayout),
+				End:    end.Format(calendarDateLayout),
+				Movies: []*pb.Movie{},
+			})
+		}
+
+		group := &groups[len(groups)-1]
+		group.Movies = append(group.Movies, release.Movie)
+	}
+
+	return groups
+}
+
+func (c *Config) GetReleasesCalendar(w http.ResponseWriter, r *http.Request) {
+	q, err := parseCalendarQuery(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index, err := c.catalogIndex(ctx)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error loading movie catalog: %v"}`, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	releases := releasesInRange(index.Movies(), q)
+	total := len(releases)
+	totalPages := (total + q.PageSize - 1) / q.PageSize
+
+	start := min((q.Page-1)*q.PageSize, total)
+	end := min(start+q.PageSize, total)
+
+	jsonResponse, err := utils.MarshalJSON(map[string]any{
+		"from":       q.From.Format(calendarDateLayout),
+		"to":         q.To.Format(calendarDateLayout),
+		"groupBy":    q.GroupBy,
+		"page":       q.Page,
+		"pageSize":   q.PageSize,
+		"total":      total,
+		"totalPages": totalPages,
+		"groups":     groupReleases(releases[start:end], q.GroupBy),
+	})
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
+
+// GetReleasesCalendarICS serves the releases calendar as an iCalendar feed that
+// calendar apps can subscribe to. It takes the same filters as
+// GetReleasesCalendar, pagination and grouping do not apply.
+func (c *Config) GetReleasesCalendarICS(w http.ResponseWriter, r *http.Request) {
+	q, err := parseCalendarQuery(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index, err := c.catalogIndex(ctx)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error loading movie catalog: %v"}`, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	releases := releasesInRange(index.Movies(), q)
+	events := make([]utils.CalendarEvent, 0, len(releases))
+
+	for _, release := range releases {
+		events = append(events, utils.CalendarEvent{
+			UID:         fmt.Sprintf("movie-%d-release@booking-broker-service", release.Movie.Id),
+			Date:        release.ReleaseDate,
+			Summary:     release.Movie.Title,
+			Description: release.Movie.Description,
+			URL:         release.Movie.TrailerUrl,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="releases.ics"`)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write([]byte(utils.BuildICalendar("Upcoming releases", events, time.Now())))
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing calendar response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,607 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ps "github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// A checkout runs the payment steps the frontend used to call one by one as a
+// saga under one idempotency key. The state of every step is kept in Redis so
+// a retry with the same key picks up after the last step that went through.
+// A step that fails for good fails the checkout and releases the seat hold,
+// the customer and order already created are left to the payment service.
+
+const (
+	// checkoutTTL is how long the state of a checkout is kept
+	checkoutTTL = 24 * time.Hour
+	// checkoutLockTTL bounds how long a crashed run keeps a checkout locked
+	checkoutLockTTL = 30 * time.Second
+	// maxCheckoutStepAttempts is how often a step is tried before the
+	// checkout fails for good
+	maxCheckoutStepAttempts = 3
+)
+
+// Steps of a checkout, in order
+const (
+	checkoutStepCustomer    = "customer"
+	checkoutStepOrder       = "order"
+	checkoutStepCommit      = "commit"
+	checkoutStepPaymentLink = "paymentLink"
+)
+
+// Statuses of a checkout and of its steps
+const (
+	checkoutPending         = "pending"
+	checkoutDone            = "done"
+	checkoutAwaitingPayment = "awaitingPayment"
+	checkoutConfirmed       = "confirmed"
+	checkoutFailed          = "failed"
+)
+
+// unlockCheckoutScript frees the lock KEYS[1] when it is still held by the run
+// ARGV[1]
+var unlockCheckoutScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+
+return 0
+`)
+
+func checkoutKey(idempotentKey string) string {
+	return fmt.Sprintf("checkouts:%s", idempotentKey)
+}
+
+// checkoutOrderKey maps an order of the payment service to the idempotency
+// key of its checkout
+func checkoutOrderKey(orderID string) string {
+	return fmt.Sprintf("checkouts:orders:%s", orderID)
+}
+
+// checkoutLockKey is held while a checkout runs, a retry that comes in
+// meanwhile is turned away
+func checkoutLockKey(idempotentKey string) string {
+	return fmt.Sprintf("checkouts:%s:lock", idempotentKey)
+}
+
+type CheckoutCustomer struct {
+	CustomerName string `json:"customerName"`
+	PhoneNumber  string `json:"phoneNumber"`
+	// Email defaults to the email of the signed in user
+	Email   string `json:"email"`
+	Country string `json:"country"`
+	State   string `json:"state"`
+	City    string `json:"city"`
+	Zipcode int32  `json:"zipcode"`
+	Street  string `json:"street"`
+}
+
+type CheckoutRequest struct {
+	// IdempotentKey names the checkout, a new one is made when it is left out.
+	// It may be sent in the Idempotency-Key header instead.
+	IdempotentKey   string `json:"idempotentKey"`
+	MovieTimeSlotID int32  `json:"movieTimeSlotId" validate:"required,gt=0"`
+	HoldID          string `json:"holdId" validate:"required"`
+	// MovieID keeps the booking history of the user once the seats are booked
+	MovieID int32 `json:"movieId"`
+	// Date and StartTime name the showing on the ticket, they are matched with
+	// the time slots of the movie at the venue when the ticket is sent
+	Date      string           `json:"date"`
+	StartTime string           `json:"startTime"`
+	Customer  CheckoutCustomer `json:"customer"`
+}
+
+type CheckoutStep struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Checkout struct {
+	IdempotentKey string `json:"idempotentKey"`
+	Status        string `json:"status"`
+	UserID        int32  `json:"userId"`
+	// UserEmail is whose booking history the seats are kept in, the customer
+	// email is only where the ticket goes
+	UserEmail       string           `json:"userEmail,omitempty"`
+	MovieID         int32            `json:"movieId,omitempty"`
+	MovieTimeSlotID int32            `json:"movieTimeSlotId"`
+	Date            string           `json:"date,omitempty"`
+	StartTime       string           `json:"startTime,omitempty"`
+	VenueID         int32            `json:"venueId"`
+	HoldID          string           `json:"holdId"`
+	SeatMatrixIDs   []int32          `json:"seatMatrixIds"`
+	Customer        CheckoutCustomer `json:"customer"`
+	CustomerID      string           `json:"customerId,omitempty"`
+	OrderIDs        []string         `json:"orderIds,omitempty"`
+	PaymentLink     string           `json:"paymentLink,omitempty"`
+	// PaymentDueAt is when the checkout is swept unless it was paid, the seat
+	// hold lasts until then
+	PaymentDueAt *time.Time     `json:"paymentDueAt,omitempty"`
+	Steps        []CheckoutStep `json:"steps"`
+	// PaymentID and BookingIDs are set once the payment went through and the
+	// seats are booked
+	PaymentID    string     `json:"paymentId,omitempty"`
+	BookingIDs   []int32    `json:"bookingIds,omitempty"`
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`
+	TicketSentAt *time.Time `json:"ticketSentAt,omitempty"`
+	// RefundOwed is set when the payment went through but the seats could
+	// not be booked, RefundedAt once an admin refunded the payment
+	RefundOwed         bool       `json:"refundOwed,omitempty"`
+	RefundNoticeSentAt *time.Time `json:"refundNoticeSentAt,omitempty"`
+	RefundedAt         *time.Time `json:"refundedAt,omitempty"`
+	Error              string     `json:"error,omitempty"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+// checkoutStepError is a failed step, retryable when trying the step again
+// may go through
+type checkoutStepError struct {
+	err       error
+	retryable bool
+}
+
+func (e *checkoutStepError) Error() string {
+	return e.err.Error()
+}
+
+// rpcStepError classifies the outcome of a payment service call. Errors the
+// transport reports as passing and errors of status 5xx are retryable, the
+// payment service rejecting the call is not.
+func rpcStepError(err error, responseStatus int32, responseError string) *checkoutStepError {
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return &checkoutStepError{err: err, retryable: true}
+		}
+
+		return &checkoutStepError{err: err}
+	}
+
+	if responseError != "" {
+		return &checkoutStepError{err: fmt.Errorf("%s", responseError), retryable: responseStatus >= 500}
+	}
+
+	return nil
+}
+
+// checkout reads the state of a checkout, nil when there is none
+func (c *Config) checkout(ctx context.Context, idempotentKey string) (*Checkout, error) {
+	encoded, err := c.RedisClient.Get(ctx, checkoutKey(idempotentKey)).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var checkout Checkout
+
+	if err := json.Unmarshal(encoded, &checkout); err != nil {
+		return nil, err
+	}
+
+	return &checkout, nil
+}
+
+// lockCheckout locks a checkout for one run, ok is false when another run
+// holds the lock
+func (c *Config) lockCheckout(ctx context.Context, idempotentKey string) (unlock func(), ok bool, err error) {
+	run := utils.GenerateIdempotentKey()
+
+	locked, err := c.RedisClient.SetNX(ctx, checkoutLockKey(idempotentKey), run, checkoutLockTTL).Result()
+
+	if err != nil || !locked {
+		return nil, false, err
+	}
+
+	unlock = func() {
+		if err := unlockCheckoutScript.Run(context.Background(), c.RedisClient, []string{checkoutLockKey(idempotentKey)}, run).Err(); err != nil {
+			log.Error("error unlocking checkout: ", err)
+		}
+	}
+
+	return unlock, true, nil
+}
+
+func (c *Config) saveCheckout(ctx context.Context, checkout *Checkout) error {
+	checkout.UpdatedAt = time.Now().UTC()
+
+	encoded, err := json.Marshal(checkout)
+
+	if err != nil {
+		return err
+	}
+
+	ttl := checkoutTTL
+
+	// a checkout that owes a refund is kept until it is refunded
+	if checkout.owesRefund() {
+		ttl = 0
+	}
+
+	// the order keys hash to other slots, so they are not set in a transaction
+	pipe := c.RedisClient.Pipeline()
+	pipe.Set(ctx, checkoutKey(checkout.IdempotentKey), encoded, ttl)
+
+	for _, orderID := range checkout.OrderIDs {
+		pipe.Set(ctx, checkoutOrderKey(orderID), checkout.IdempotentKey, checkoutTTL)
+	}
+
+	// checkouts awaiting payment are swept once the payment is overdue
+	if checkout.Status == checkoutAwaitingPayment {
+		dueAt := checkout.UpdatedAt.Add(checkoutPaymentWindow)
+
+		if checkout.PaymentDueAt != nil {
+			dueAt = *checkout.PaymentDueAt
+		}
+
+		pipe.ZAdd(ctx, awaitingPaymentKey, redis.Z{
+			Score:  float64(dueAt.UnixMilli()),
+			Member: checkout.IdempotentKey,
+		})
+	} else {
+		pipe.ZRem(ctx, awaitingPaymentKey, checkout.IdempotentKey)
+	}
+
+	if checkout.owesRefund() {
+		pipe.ZAddNX(ctx, refundsOwedKey, redis.Z{
+			Score:  float64(checkout.UpdatedAt.UnixMilli()),
+			Member: checkout.IdempotentKey,
+		})
+	} else {
+		pipe.ZRem(ctx, refundsOwedKey, checkout.IdempotentKey)
+	}
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// runCheckoutStep calls the payment service for one step of a checkout
+func (c *Config) runCheckoutStep(ctx context.Context, checkout *Checkout, name string) *checkoutStepError {
+	switch name {
+	case checkoutStepCustomer:
+		response, err := c.Payment_service.CreateCustomer(ctx, &ps.CreateCustomerRequest{
+			CustomerName:  checkout.Customer.CustomerName,
+			PhoneNumber:   checkout.Customer.PhoneNumber,
+			Email:         checkout.Customer.Email,
+			Country:       checkout.Customer.Country,
+			State:         checkout.Customer.State,
+			City:          checkout.Customer.City,
+			Zipcode:       checkout.Customer.Zipcode,
+			Street:        checkout.Customer.Street,
+			IdempotentKey: checkout.IdempotentKey,
+		})
+
+		if stepErr := rpcStepError(err, response.GetStatus(), response.GetError()); stepErr != nil {
+			return stepErr
+		}
+
+		checkout.CustomerID = response.GetCustomerId()
+	case checkoutStepOrder:
+		response, err := c.Payment_service.CreateOrder(ctx, &ps.Create_Order_Request{
+			IdempotentKey:   checkout.IdempotentKey,
+			SeatMatrixIDs:   checkout.SeatMatrixIDs,
+			VenueId:         checkout.VenueID,
+			MovieTimeSlotId: checkout.MovieTimeSlotID,
+		})
+
+		if stepErr := rpcStepError(err, response.GetStatus(), response.GetError()); stepErr != nil {
+			return stepErr
+		}
+
+		checkout.OrderIDs = response.GetOrderId()
+	case checkoutStepCommit:
+		// the payment service makes the payment link of the customer and the
+		// orders committed under the idempotency key
+		response, err := c.Payment_service.CommitIdempotentKey(ctx, &ps.CommitIdempotentKeyRequest{
+			IdempotentKey: checkout.IdempotentKey,
+			CustomerId:    checkout.CustomerID,
+			OrderIds:      checkout.OrderIDs,
+		})
+
+		if stepErr := rpcStepError(err, response.GetStatus(), response.GetError()); stepErr != nil {
+			return stepErr
+		}
+	case checkoutStepPaymentLink:
+		response, err := c.Payment_service.GeneratePaymentLink(ctx, &ps.CreatePaymentLinkRequest{
+			IdempotentKey: checkout.IdempotentKey,
+		})
+
+		if stepErr := rpcStepError(err, response.GetStatus(), response.GetError()); stepErr != nil {
+			return stepErr
+		}
+
+		checkout.PaymentLink = response.GetPaymentLink()
+	}
+
+	return nil
+}
+
+// failCheckout fails a checkout for good and releases its seat hold
+func (c *Config) failCheckout(ctx context.Context, checkout *Checkout, reason string) {
+	checkout.Status = checkoutFailed
+	checkout.Error = reason
+
+	hold, err := c.seatHold(ctx, checkout.MovieTimeSlotID, checkout.HoldID)
+
+	if err != nil {
+		log.Error("error reading seat hold of checkout: ", err)
+		return
+	}
+
+	if hold != nil {
+		if err := c.releaseSeatHold(ctx, hold); err != nil {
+			log.Error("error releasing seat hold of checkout: ", err)
+		}
+	}
+}
+
+// runCheckout runs the steps of a checkout that have not gone through yet. It
+// stops at the first step that fails, the checkout stays pending when the
+// step may go through on a retry.
+func (c *Config) runCheckout(ctx context.Context, checkout *Checkout) error {
+	for i := range checkout.Steps {
+		step := &checkout.Steps[i]
+
+		if step.Status == checkoutDone {
+			continue
+		}
+
+		hold, err := c.seatHold(ctx, checkout.MovieTimeSlotID, checkout.HoldID)
+
+		if err != nil {
+			return err
+		}
+
+		if hold == nil {
+			c.failCheckout(ctx, checkout, "The seat hold expired before the checkout went through")
+			return c.saveCheckout(ctx, checkout)
+		}
+
+		step.Attempts++
+		stepErr := c.runCheckoutStep(ctx, checkout, step.Name)
+
+		if stepErr == nil {
+			step.Status = checkoutDone
+			step.Error = ""
+
+			if err := c.saveCheckout(ctx, checkout); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		step.Error = stepErr.Error()
+
+		if !stepErr.retryable || step.Attempts >= maxCheckoutStepAttempts {
+			step.Status = checkoutFailed
+			c.failCheckout(ctx, checkout, fmt.Sprintf("The %s step failed: %v", step.Name, stepErr))
+		}
+
+		return c.saveCheckout(ctx, checkout)
+	}
+
+	checkout.Status = checkoutAwaitingPayment
+	dueAt := time.Now().Add(checkoutPaymentWindow).UTC()
+
+	// the seats stay held while the customer pays, as far as a hold lasts, the
+	// payment is overdue once they are not held anymore
+	if hold, err := c.seatHold(ctx, checkout.MovieTimeSlotID, checkout.HoldID); err == nil && hold != nil {
+		if _, err := c.extendSeatHold(ctx, hold); err != nil {
+			log.Error("error extending seat hold of checkout: ", err)
+		}
+
+		if hold.ExpiresAt.Before(dueAt) {
+			dueAt = hold.ExpiresAt
+		}
+	}
+
+	checkout.PaymentDueAt = &dueAt
+
+	return c.saveCheckout(ctx, checkout)
+}
+
+// writeCheckout answers with a checkout, 503 Service Unavailable while a step
+// is left to retry and 409 Conflict once the checkout failed
+func writeCheckout(w http.ResponseWriter, checkout *Checkout) {
+	switch checkout.Status {
+	case checkoutAwaitingPayment, checkoutConfirmed:
+		writeJSON(w, http.StatusOK, checkout)
+	case checkoutFailed:
+		writeJSON(w, http.StatusConflict, checkout)
+	default:
+		writeJSON(w, http.StatusServiceUnavailable, checkout)
+	}
+}
+
+// Checkout creates the customer and the order of the seats of a seat hold,
+// commits them and makes the payment link in one call. Retrying with the same
+// idempotency key resumes the checkout, steps that went through are not run
+// again.
+func (c *Config) Checkout(w http.ResponseWriter, r *http.Request) {
+	var requestBody CheckoutRequest
+
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.UnmarshalJSON(bodyBytes, &requestBody); err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.MovieTimeSlotID <= 0 || requestBody.HoldID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "movieTimeSlotId and holdId are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if c.RedisClient == nil || c.Payment_service == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Checkout is not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	idempotentKey := requestBody.IdempotentKey
+
+	if idempotentKey == "" {
+		idempotentKey = r.Header.Get("Idempotency-Key")
+	}
+
+	if idempotentKey == "" {
+		idempotentKey = utils.GenerateIdempotentKey()
+	}
+
+	unlock, locked, err := c.lockCheckout(r.Context(), idempotentKey)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error locking checkout: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !locked {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "The checkout is already running, retry in a moment"}`, http.StatusConflict)
+		return
+	}
+
+	defer unlock()
+
+	checkout, err := c.checkout(r.Context(), idempotentKey)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading checkout: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if checkout != nil && (checkout.UserID != user.UserID || checkout.HoldID != requestBody.HoldID || checkout.MovieTimeSlotID != requestBody.MovieTimeSlotID) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "The idempotency key belongs to another checkout"}`, http.StatusConflict)
+		return
+	}
+
+	if checkout == nil {
+		hold, err := c.seatHold(r.Context(), requestBody.MovieTimeSlotID, requestBody.HoldID)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error reading seat hold: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if hold == nil || hold.UserID != user.UserID {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "No seat hold found, it may have expired"}`, http.StatusNotFound)
+			return
+		}
+
+		if requestBody.Customer.Email == "" {
+			requestBody.Customer.Email = user.Email
+		}
+
+		if requestBody.Customer.Email == "" {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "email of the customer cannot be empty"}`, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC()
+
+		checkout = &Checkout{
+			IdempotentKey:   idempotentKey,
+			Status:          checkoutPending,
+			UserID:          user.UserID,
+			UserEmail:       user.Email,
+			MovieID:         requestBody.MovieID,
+			MovieTimeSlotID: hold.MovieTimeSlotID,
+			Date:            requestBody.Date,
+			StartTime:       requestBody.StartTime,
+			VenueID:         hold.VenueID,
+			HoldID:          hold.ID,
+			SeatMatrixIDs:   hold.SeatMatrixIDs,
+			Customer:        requestBody.Customer,
+			CreatedAt:       now,
+		}
+
+		for _, name := range []string{checkoutStepCustomer, checkoutStepOrder, checkoutStepCommit, checkoutStepPaymentLink} {
+			checkout.Steps = append(checkout.Steps, CheckoutStep{Name: name, Status: checkoutPending})
+		}
+	}
+
+	if checkout.Status == checkoutPending {
+		if err := c.runCheckout(r.Context(), checkout); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error running checkout: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeCheckout(w, checkout)
+}
+
+// GetCheckout returns the state of a checkout of the signed in user
+func (c *Config) GetCheckout(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Checkout is not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	checkout, err := c.checkout(r.Context(), chi.URLParam(r, "key"))
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading checkout: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if checkout == nil || (checkout.UserID != user.UserID && !user.IsAdmin()) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No checkout found"}`, http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, checkout)
+}
@@ -0,0 +1,358 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go/types"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/parser"
+)
+
+// defaultListSize is the number of items assumed for a list field whose
+// length is decided by the data, like the venues of a movie
+const defaultListSize = 20
+
+// listSizeArgs are the arguments that bound the length of a list field, a
+// list argument bounds it by its own length
+var listSizeArgs = map[string]bool{"limit": true, "first": true, "ids": true}
+
+// maxListSizes is the most items a field returns whatever its size argument,
+// its resolver clamps larger and non positive sizes to it
+var maxListSizes = map[string]int{"Movie.reviews": maxReviewPage}
+
+// ListSizer returns the number of items a list field returns when it is not
+// bounded by an argument, ok is false for fields it does not know
+type ListSizer func(field string) (size int, ok bool, err error)
+
+// complexity estimates the cost of a query before it runs. Every field costs
+// one point, and the cost of the selections below a list field is multiplied
+// by the expected list length. Fragments are expanded where they are spread.
+type complexity struct {
+	schema    *types.Schema
+	fragments ast.FragmentDefinitionList
+	// variables are the variables of the request, defaults the default
+	// values declared by the operation
+	variables map[string]any
+	defaults  map[string]int
+	unbounded ListSizer
+}
+
+// estimateComplexity returns the cost of the operation in query. Size
+// arguments given as variables are resolved against variables, lists that no
+// argument bounds are sized by unbounded. The query must already be valid for
+// the schema, validation is left to graphql-go.
+func estimateComplexity(schema *types.Schema, query, operationName string, variables map[string]any, unbounded ListSizer) (int, error) {
+	document, parseErr := parser.ParseQuery(&ast.Source{Input: query})
+
+	if parseErr != nil {
+		return 0, parseErr
+	}
+
+	var operation *ast.OperationDefinition
+
+	if operationName == "" && len(document.Operations) > 0 {
+		operation = document.Operations[0]
+	} else {
+		operation = document.Operations.ForName(operationName)
+	}
+
+	if operation == nil {
+		return 0, fmt.Errorf("unknown operation %q", operationName)
+	}
+
+	c := &complexity{schema: schema, fragments: document.Fragments, variables: variables, unbounded: unbounded}
+	c.defaults = c.variableDefaults(operation.VariableDefinitions)
+
+	return c.selectionSet(operationType(schema, operation.Operation), operation.SelectionSet, 0, 0)
+}
+
+func operationType(schema *types.Schema, operation ast.Operation) string {
+	if root, ok := schema.EntryPoints[string(operation)]; ok {
+		return root.TypeName()
+	}
+
+	return ""
+}
+
+// arguments reads the sizes of the arguments of a field. Integers are taken
+// as they are, lists by their length and variables are resolved first, other
+// values are ignored.
+func (c *complexity) arguments(arguments ast.ArgumentList) map[string]int {
+	args := map[string]int{}
+
+	for _, arg := range arguments {
+		if size, ok := c.value(arg.Value); ok {
+			args[arg.Name] = size
+		}
+	}
+
+	return args
+}
+
+// value reads the size of a value
+func (c *complexity) value(value *ast.Value) (int, bool) {
+	if value == nil {
+		return 0, false
+	}
+
+	switch value.Kind {
+	case ast.Variable:
+		return c.variable(value.Raw)
+	case ast.ListValue:
+		return len(value.Children), true
+	case ast.IntValue:
+		size, err := strconv.Atoi(value.Raw)
+		return size, err == nil
+	}
+
+	return 0, false
+}
+
+// variable returns the size of a variable of the request, or of its default
+// value when the request leaves it out
+func (c *complexity) variable(name string) (int, bool) {
+	value, ok := c.variables[name]
+
+	if !ok {
+		size, ok := c.defaults[name]
+		return size, ok
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case json.Number:
+		size, err := v.Int64()
+		return int(size), err == nil
+	case []any:
+		return len(v), true
+	}
+
+	return 0, false
+}
+
+// variableDefaults reads the sizes of the default values declared by an
+// operation, like ($limit: Int = 5)
+func (c *complexity) variableDefaults(definitions ast.VariableDefinitionList) map[string]int {
+	defaults := map[string]int{}
+
+	for _, definition := range definitions {
+		if definition.DefaultValue == nil || definition.DefaultValue.Kind == ast.Variable {
+			continue
+		}
+
+		if size, ok := c.value(definition.DefaultValue); ok {
+			defaults[definition.Variable] = size
+		}
+	}
+
+	return defaults
+}
+
+// fieldSize returns how many items the list below a field holds, from its
+// size argument or the default of that argument in the schema. A field with a
+// maximum is clamped to it the way its resolver does and a list no argument
+// bounds is sized by c.unbounded.
+func (c *complexity) fieldSize(typeName, fieldName string, args map[string]int) (int, bool, error) {
+	size, sized := listSize(args)
+
+	if !sized {
+		size, sized = c.defaultSize(typeName, fieldName)
+	}
+
+	key := typeName + "." + fieldName
+
+	if limit, ok := maxListSizes[key]; ok {
+		if !sized || size <= 0 || size > limit {
+			size = limit
+		}
+
+		return size, true, nil
+	}
+
+	if sized || c.unbounded == nil {
+		return size, sized, nil
+	}
+
+	return c.unbounded(key)
+}
+
+// defaultSize returns the default value of the size argument of a field in
+// the schema, if it has one
+func (c *complexity) defaultSize(typeName, fieldName string) (int, bool) {
+	object, ok := c.schema.Types[typeName].(*types.ObjectTypeDefinition)
+
+	if !ok {
+		return 0, false
+	}
+
+	field := object.Fields.Get(fieldName)
+
+	if field == nil {
+		return 0, false
+	}
+
+	for _, arg := range field.Arguments {
+		if !listSizeArgs[arg.Name.Name] {
+			continue
+		}
+
+		if value, ok := arg.Default.(*types.PrimitiveValue); ok {
+			if size, err := strconv.Atoi(value.Text); err == nil {
+				return size, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// selectionSet returns the cost of selections, typeName is the type they are
+// selected on. pageSize is the limit given to a paginated parent, it bounds
+// the lists below it.
+func (c *complexity) selectionSet(typeName string, selections ast.SelectionSet, depth, pageSize int) (int, error) {
+	if depth > maxFragmentDepth {
+		return 0, fmt.Errorf("fragments nest too deep")
+	}
+
+	total := 0
+
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *ast.InlineFragment:
+			fragmentType := typeName
+
+			if selection.TypeCondition != "" {
+				fragmentType = selection.TypeCondition
+			}
+
+			cost, err := c.selectionSet(fragmentType, selection.SelectionSet, depth+1, pageSize)
+
+			if err != nil {
+				return 0, err
+			}
+
+			total += cost
+		case *ast.FragmentSpread:
+			spread := c.fragments.ForName(selection.Name)
+
+			if spread == nil {
+				return 0, fmt.Errorf("unknown fragment %q", selection.Name)
+			}
+
+			cost, err := c.selectionSet(spread.TypeCondition, spread.SelectionSet, depth+1, pageSize)
+
+			if err != nil {
+				return 0, err
+			}
+
+			total += cost
+		case *ast.Field:
+			cost, err := c.field(typeName, selection, depth, pageSize)
+
+			if err != nil {
+				return 0, err
+			}
+
+			total += cost
+		}
+	}
+
+	return total, nil
+}
+
+// field returns the cost of a field and of the selections below it
+func (c *complexity) field(typeName string, field *ast.Field, depth, pageSize int) (int, error) {
+	if len(field.SelectionSet) == 0 {
+		return 1, nil
+	}
+
+	fieldType, isList := c.fieldType(typeName, field.Name)
+
+	size, sized, err := c.fieldSize(typeName, field.Name, c.arguments(field.Arguments))
+
+	if err != nil {
+		return 0, err
+	}
+
+	childPageSize := 0
+
+	if sized && !isList {
+		childPageSize = size
+	}
+
+	children, err := c.selectionSet(fieldType, field.SelectionSet, depth, childPageSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	multiplier := 1
+
+	switch {
+	case isList && sized:
+		multiplier = size
+	case isList && pageSize > 0:
+		multiplier = pageSize
+	case isList:
+		multiplier = defaultListSize
+	}
+
+	return 1 + multiplier*children, nil
+}
+
+// maxFragmentDepth guards against fragments that spread each other
+const maxFragmentDepth = 16
+
+// fieldType returns the named type of a field and whether it is a list
+func (c *complexity) fieldType(typeName, fieldName string) (string, bool) {
+	object, ok := c.schema.Types[typeName].(*types.ObjectTypeDefinition)
+
+	if !ok {
+		return "", false
+	}
+
+	field := object.Fields.Get(fieldName)
+
+	if field == nil {
+		return "", false
+	}
+
+	isList := false
+	t := field.Type
+
+	for {
+		switch wrapped := t.(type) {
+		case *types.NonNull:
+			t = wrapped.OfType
+			continue
+		case *types.List:
+			isList = true
+			t = wrapped.OfType
+			continue
+		}
+
+		break
+	}
+
+	if named, ok := t.(types.NamedType); ok {
+		return named.TypeName(), isList
+	}
+
+	return "", isList
+}
+
+// listSize returns the size argument of a field, if it has one
+func listSize(args map[string]int) (int, bool) {
+	for name, value := range args {
+		if listSizeArgs[name] {
+			return value, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/errors"
+)
+
+// Query limits, a screen needs a handful of levels and a few hundred fields
+const (
+	MaxDepth       = 8
+	MaxComplexity  = 2000
+	maxQueryLength = 16 << 10
+)
+
+// Handler serves GraphQL queries over HTTP
+type Handler struct {
+	schema   *graphql.Schema
+	resolver *Resolver
+	// Token returns the auth token of the request, Query.viewer resolves to
+	// null without one
+	Token func(r *http.Request) string
+}
+
+type tokenKey struct{}
+
+func tokenFrom(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+
+	return token
+}
+
+// NewHandler parses the schema and binds it to resolver, it panics if the
+// resolvers do not match the schema
+func NewHandler(resolver *Resolver, token func(r *http.Request) string) *Handler {
+	return &Handler{
+		schema: graphql.MustParseSchema(Schema, resolver,
+			graphql.UseStringDescriptions(),
+			graphql.MaxDepth(MaxDepth),
+		),
+		resolver: resolver,
+		Token:    token,
+	}
+}
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params request
+
+	if r.Method == http.MethodGet {
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+				writeErrors(w, http.StatusBadRequest, errors.Errorf("invalid variables: %v", err))
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryLength)).Decode(&params); err != nil {
+		writeErrors(w, http.StatusBadRequest, errors.Errorf("error decoding request body: %v", err))
+		return
+	}
+
+	if params.Query == "" {
+		writeErrors(w, http.StatusBadRequest, errors.Errorf("missing query"))
+		return
+	}
+
+	if errs := h.schema.ValidateWithVariables(params.Query, params.Variables); len(errs) > 0 {
+		writeErrors(w, http.StatusBadRequest, errs...)
+		return
+	}
+
+	cost, err := estimateComplexity(h.schema.ASTSchema(), params.Query, params.OperationName, params.Variables, h.resolver.listSizer(r.Context()))
+
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, errors.Errorf("error estimating query complexity: %v", err))
+		return
+	}
+
+	if cost > MaxComplexity {
+		writeErrors(w, http.StatusBadRequest, errors.Errorf("query complexity %d exceeds the limit of %d", cost, MaxComplexity))
+		return
+	}
+
+	ctx := withLoaders(r.Context(), newLoaders(h.resolver.MovieDB))
+
+	if h.Token != nil {
+		ctx = context.WithValue(ctx, tokenKey{}, h.Token(r))
+	}
+
+	response := h.schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+
+	jsonResponse, err := json.Marshal(response)
+
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, errors.Errorf("error marshalling response: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...*errors.QueryError) {
+	jsonResponse, _ := json.Marshal(graphql.Response{Errors: errs})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
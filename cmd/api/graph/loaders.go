@@ -0,0 +1,257 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graph-gophers/dataloader"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// allMoviesThreshold is the batch size from which one GetAllMovies call is
+// cheaper than a GetMovie call per movie
+const allMoviesThreshold = 4
+
+// maxBatchParallelism bounds the backend calls a single batch runs at once
+const maxBatchParallelism = 8
+
+// Loaders batch and deduplicate the backend reads of one GraphQL request. The
+// MovieDB service has no batch reads, so a batch is served by one catalog read
+// when that is cheaper, or by parallel single reads otherwise.
+type Loaders struct {
+	movies  *dataloader.Loader
+	venues  *dataloader.Loader
+	seats   *dataloader.Loader
+	reviews *dataloader.Loader
+	movieDB pb.MovieDBServiceClient
+}
+
+type loadersKey struct{}
+
+func newLoaders(movieDB pb.MovieDBServiceClient) *Loaders {
+	l := &Loaders{movieDB: movieDB}
+
+	l.movies = dataloader.NewBatchedLoader(l.loadMovies)
+	l.venues = dataloader.NewBatchedLoader(l.loadVenues)
+	l.seats = dataloader.NewBatchedLoader(l.loadSeats)
+	l.reviews = dataloader.NewBatchedLoader(l.loadReviews)
+
+	return l
+}
+
+func withLoaders(ctx context.Context, l *Loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *Loaders {
+	return ctx.Value(loadersKey{}).(*Loaders)
+}
+
+// errNotFound marks a key the backend does not know, it resolves to null
+var errNotFound = errors.New("not found")
+
+func backendError(status int32, message string) error {
+	if status == http.StatusNotFound {
+		return errNotFound
+	}
+
+	return errors.New(message)
+}
+
+// fanOut runs fetch for every key with bounded parallelism and returns the
+// results in key order, as dataloader requires
+func fanOut(ctx context.Context, keys dataloader.Keys, fetch func(ctx context.Context, key string) (any, error)) []*dataloader.Result {
+	results := make([]*dataloader.Result, len(keys))
+	sem := make(chan struct{}, maxBatchParallelism)
+
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		wg.Add(1)
+
+		go func(i int, key string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			data, err := fetch(ctx, key)
+			results[i] = &dataloader.Result{Data: data, Error: err}
+		}(i, key.String())
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func (l *Loaders) loadMovies(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	if len(keys) >= allMoviesThreshold {
+		if results, err := l.loadAllMovies(ctx, keys); err == nil {
+			return results
+		}
+	}
+
+	return fanOut(ctx, keys, func(ctx context.Context, id string) (any, error) {
+		response, err := l.movieDB.GetMovie(ctx, &pb.MovieRequest{Movieid: id})
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting movie %s: %w", id, err)
+		}
+
+		if response.Error != "" || response.Movie == nil {
+			return nil, backendError(response.Status, response.Error)
+		}
+
+		return response.Movie, nil
+	})
+}
+
+func (l *Loaders) loadAllMovies(ctx context.Context, keys dataloader.Keys) ([]*dataloader.Result, error) {
+	response, err := l.movieDB.GetAllMovies(ctx, &emptypb.Empty{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" || response.MovieList == nil {
+		return nil, errors.New(response.Error)
+	}
+
+	byID := make(map[string]*pb.Movie, len(response.MovieList.Movies))
+
+	for _, movie := range response.MovieList.Movies {
+		byID[strconv.Itoa(int(movie.Id))] = movie
+	}
+
+	results := make([]*dataloader.Result, len(keys))
+
+	for i, key := range keys {
+		if movie, ok := byID[key.String()]; ok {
+			results[i] = &dataloader.Result{Data: movie}
+		} else {
+			results[i] = &dataloader.Result{Error: errNotFound}
+		}
+	}
+
+	return results, nil
+}
+
+func (l *Loaders) loadVenues(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	return fanOut(ctx, keys, func(ctx context.Context, id string) (any, error) {
+		response, err := l.movieDB.GetVenue(ctx, &pb.MovieRequest{Venueid: id})
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting venue %s: %w", id, err)
+		}
+
+		if response.Error != "" || response.Venue == nil {
+			return nil, backendError(response.Status, response.Error)
+		}
+
+		return response.Venue, nil
+	})
+}
+
+func (l *Loaders) loadSeats(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	return fanOut(ctx, keys, func(ctx context.Context, id string) (any, error) {
+		venueID, err := strconv.Atoi(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := l.movieDB.GetSeatMatrix(ctx, &pb.GetSeatMatrixRequest{Venueid: int32(venueID)})
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting seat matrix of venue %s: %w", id, err)
+		}
+
+		if response.Error != "" {
+			return nil, backendError(response.Status, response.Error)
+		}
+
+		return response.Seats, nil
+	})
+}
+
+// reviewsKey encodes a GetAllMovieReviews request as a loader key
+func reviewsKey(req *pb.GetAllMovieReviewsRequest) string {
+	return fmt.Sprintf("%d:%d:%d:%d:%d", req.MovieID, req.Limit, req.Offset, req.SortBy, req.FilterBy)
+}
+
+func parseReviewsKey(key string) (*pb.GetAllMovieReviewsRequest, error) {
+	parts := strings.Split(key, ":")
+
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid reviews key %q", key)
+	}
+
+	values := make([]int, len(parts))
+
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid reviews key %q", key)
+		}
+
+		values[i] = value
+	}
+
+	return &pb.GetAllMovieReviewsRequest{
+		MovieID:  int32(values[0]),
+		Limit:    int32(values[1]),
+		Offset:   int32(values[2]),
+		SortBy:   pb.SortBy(values[3]),
+		FilterBy: pb.FilterBy(values[4]),
+	}, nil
+}
+
+func (l *Loaders) loadReviews(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	return fanOut(ctx, keys, func(ctx context.Context, key string) (any, error) {
+		req, err := parseReviewsKey(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := l.movieDB.GetAllMovieReviews(ctx, req)
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting reviews of movie %d: %w", req.MovieID, err)
+		}
+
+		if response.Error != "" {
+			return nil, backendError(response.Status, response.Error)
+		}
+
+		return response, nil
+	})
+}
+
+// load resolves key with loader, a missing key resolves to nil
+func load[T any](ctx context.Context, loader *dataloader.Loader, key string) (T, error) {
+	var zero T
+
+	data, err := loader.Load(ctx, dataloader.StringKey(key))()
+
+	if errors.Is(err, errNotFound) {
+		return zero, nil
+	}
+
+	if err != nil {
+		return zero, err
+	}
+
+	value, _ := data.(T)
+
+	return value, nil
+}
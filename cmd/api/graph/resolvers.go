@@ -0,0 +1,481 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graph-gophers/dataloader"
+	graphql "github.com/graph-gophers/graphql-go"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	ps "github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// maxReviewPage caps the limit argument of Movie.reviews
+const maxReviewPage = 50
+
+// Resolver is the root resolver, it calls the three backends
+type Resolver struct {
+	MovieDB pb.MovieDBServiceClient
+	Payment ps.PaymentServiceClient
+	Auth    at.AuthServiceClient
+}
+
+func id(value int32) graphql.ID {
+	return graphql.ID(strconv.Itoa(int(value)))
+}
+
+func movieResolvers(movies []*pb.Movie) []*movieResolver {
+	resolvers := make([]*movieResolver, 0, len(movies))
+
+	for _, movie := range movies {
+		resolvers = append(resolvers, &movieResolver{movie})
+	}
+
+	return resolvers
+}
+
+// primeMovies stores movies that came with a list response in the loader, so
+// nested lookups of the same movies do not go back to the backend
+func primeMovies(ctx context.Context, movies []*pb.Movie) {
+	loaders := loadersFrom(ctx)
+
+	for _, movie := range movies {
+		loaders.movies.Prime(ctx, dataloader.StringKey(stringKey(movie.Id)), movie)
+	}
+}
+
+func (r *Resolver) Movie(ctx context.Context, args struct{ ID graphql.ID }) (*movieResolver, error) {
+	movie, err := load[*pb.Movie](ctx, loadersFrom(ctx).movies, string(args.ID))
+
+	if err != nil || movie == nil {
+		return nil, err
+	}
+
+	return &movieResolver{movie}, nil
+}
+
+// listSizer sizes the lists no argument bounds for the complexity estimate,
+// movies without ids is the whole catalog
+func (r *Resolver) listSizer(ctx context.Context) ListSizer {
+	return func(field string) (int, bool, error) {
+		if field != "Query.movies" {
+			return 0, false, nil
+		}
+
+		response, err := r.MovieDB.GetAllMovies(ctx, &emptypb.Empty{})
+
+		if err != nil {
+			return 0, false, fmt.Errorf("error getting movies: %w", err)
+		}
+
+		return len(response.GetMovieList().GetMovies()), true, nil
+	}
+}
+
+func (r *Resolver) Movies(ctx context.Context, args struct{ IDs *[]graphql.ID }) ([]*movieResolver, error) {
+	if args.IDs == nil {
+		response, err := r.MovieDB.GetAllMovies(ctx, &emptypb.Empty{})
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting movies: %w", err)
+		}
+
+		if response.Error != "" {
+			return nil, errors.New(response.Error)
+		}
+
+		// an empty catalog comes back without a movie list
+		movies := response.GetMovieList().GetMovies()
+
+		primeMovies(ctx, movies)
+
+		return movieResolvers(movies), nil
+	}
+
+	// queue every id before resolving any, so they end up in one batch
+	thunks := make([]dataloader.Thunk, 0, len(*args.IDs))
+
+	for _, movieID := range *args.IDs {
+		thunks = append(thunks, loadersFrom(ctx).movies.Load(ctx, dataloader.StringKey(movieID)))
+	}
+
+	movies := make([]*pb.Movie, 0, len(thunks))
+
+	for _, thunk := range thunks {
+		data, err := thunk()
+
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, data.(*pb.Movie))
+	}
+
+	return movieResolvers(movies), nil
+}
+
+func (r *Resolver) UpcomingMovies(ctx context.Context, args struct{ Date string }) ([]*movieResolver, error) {
+	response, err := r.MovieDB.GetUpcomingMovies(ctx, &pb.GetUpcomingMovieRequest{Date: args.Date})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting upcoming movies: %w", err)
+	}
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	primeMovies(ctx, response.MovieList)
+
+	return movieResolvers(response.MovieList), nil
+}
+
+func (r *Resolver) NowPlayingMovies(ctx context.Context, args struct{ Latitude, Longitude float64 }) ([]*movieResolver, error) {
+	response, err := r.MovieDB.GetNowPlayingMovies(ctx, &pb.GetNowPlayingMovieRequest{
+		Longitude: int64(args.Longitude),
+		Latitude:  int64(args.Latitude),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting now playing movies: %w", err)
+	}
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	primeMovies(ctx, response.MovieList)
+
+	return movieResolvers(response.MovieList), nil
+}
+
+func (r *Resolver) Venue(ctx context.Context, args struct{ ID graphql.ID }) (*venueResolver, error) {
+	venue, err := load[*pb.Venue](ctx, loadersFrom(ctx).venues, string(args.ID))
+
+	if err != nil || venue == nil {
+		return nil, err
+	}
+
+	return &venueResolver{venue}, nil
+}
+
+func (r *Resolver) Showtimes(ctx context.Context, args struct {
+	MovieID   graphql.ID
+	StartDate string
+	EndDate   string
+	Latitude  float64
+	Longitude float64
+}) ([]*timeSlotResolver, error) {
+	response, err := r.MovieDB.GetMovieTimeSlots(ctx, &pb.GetMovieTimeSlotRequest{
+		Movieid:   string(args.MovieID),
+		StartDate: args.StartDate,
+		EndDate:   args.EndDate,
+		Latitude:  float32(args.Latitude),
+		Longitude: float32(args.Longitude),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting movie time slots: %w", err)
+	}
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	loaders := loadersFrom(ctx)
+
+	for _, venue := range response.Venues {
+		loaders.venues.Prime(ctx, dataloader.StringKey(stringKey(venue.Id)), venue)
+	}
+
+	return timeSlotResolvers(response.MovieTimeSlots), nil
+}
+
+// Viewer is the signed in user, null for anonymous requests
+func (r *Resolver) Viewer(ctx context.Context) (*viewerResolver, error) {
+	token := tokenFrom(ctx)
+
+	if token == "" {
+		return nil, nil
+	}
+
+	response, err := r.Auth.ValidateToken(ctx, &at.ValdateTokenRequest{Token: token})
+
+	if err != nil {
+		return nil, fmt.Errorf("error validating token: %w", err)
+	}
+
+	if !response.Valid {
+		return nil, nil
+	}
+
+	claims, err := utils.ParseTokenClaims(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &viewerResolver{claims}, nil
+}
+
+func (r *Resolver) Checkout(ctx context.Context, args struct{ IdempotentKey string }) (*checkoutResolver, error) {
+	response, err := r.Payment.IsValidIdempotentKey(ctx, &ps.IsValidIdempotentKeyRequest{
+		IdempotentKey: args.IdempotentKey,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error checking idempotent key: %w", err)
+	}
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+
+	return &checkoutResolver{key: args.IdempotentKey, valid: response.IsValid}, nil
+}
+
+type movieResolver struct {
+	m *pb.Movie
+}
+
+func (r *movieResolver) ID() graphql.ID              { return id(r.m.Id) }
+func (r *movieResolver) Title() string               { return r.m.Title }
+func (r *movieResolver) Description() string         { return r.m.Description }
+func (r *movieResolver) Duration() int32             { return r.m.Duration }
+func (r *movieResolver) Languages() []string         { return nonNil(r.m.Language) }
+func (r *movieResolver) Genres() []string            { return nonNil(r.m.Type) }
+func (r *movieResolver) PosterUrl() string           { return r.m.PosterUrl }
+func (r *movieResolver) ScreenWidePosterUrl() string { return r.m.ScreenWidePosterUrl }
+func (r *movieResolver) TrailerUrl() string          { return r.m.TrailerUrl }
+func (r *movieResolver) ReleaseDate() string         { return r.m.ReleaseDate }
+func (r *movieResolver) Resolutions() []string       { return nonNil(r.m.MovieResolution) }
+func (r *movieResolver) Votes() float64              { return float64(r.m.Votes) }
+func (r *movieResolver) Ranking() int32              { return r.m.Ranking }
+
+func (r *movieResolver) CastAndCrew() []*castAndCrewResolver {
+	resolvers := make([]*castAndCrewResolver, 0, len(r.m.CastCrew))
+
+	for _, person := range r.m.CastCrew {
+		resolvers = append(resolvers, &castAndCrewResolver{person})
+	}
+
+	return resolvers
+}
+
+func (r *movieResolver) Venues() []*venueResolver {
+	resolvers := make([]*venueResolver, 0, len(r.m.Venues))
+
+	for _, venue := range r.m.Venues {
+		resolvers = append(resolvers, &venueResolver{venue})
+	}
+
+	return resolvers
+}
+
+func (r *movieResolver) Reviews(ctx context.Context, args struct {
+	Limit    int32
+	Offset   int32
+	SortBy   string
+	FilterBy string
+}) (*reviewPageResolver, error) {
+	if args.Limit <= 0 || args.Limit > maxReviewPage {
+		args.Limit = maxReviewPage
+	}
+
+	if args.Offset < 0 {
+		args.Offset = 0
+	}
+
+	req := &pb.GetAllMovieReviewsRequest{
+		MovieID:  r.m.Id,
+		Limit:    args.Limit,
+		Offset:   args.Offset,
+		SortBy:   pb.SortBy(pb.SortBy_value[args.SortBy]),
+		FilterBy: pb.FilterBy(pb.FilterBy_value[args.FilterBy]),
+	}
+
+	response, err := load[*pb.ReviewListResponse](ctx, loadersFrom(ctx).reviews, reviewsKey(req))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		response = &pb.ReviewListResponse{}
+	}
+
+	return &reviewPageResolver{response}, nil
+}
+
+type castAndCrewResolver struct {
+	c *pb.CastAndCrew
+}
+
+func (r *castAndCrewResolver) Name() string          { return r.c.Name }
+func (r *castAndCrewResolver) Role() string          { return r.c.Type.String() }
+func (r *castAndCrewResolver) CharacterName() string { return r.c.CharacterName }
+func (r *castAndCrewResolver) PhotoUrl() string      { return r.c.Photourl }
+
+type venueResolver struct {
+	v *pb.Venue
+}
+
+func (r *venueResolver) ID() graphql.ID               { return id(r.v.Id) }
+func (r *venueResolver) Name() string                 { return r.v.Name }
+func (r *venueResolver) Address() string              { return r.v.Address }
+func (r *venueResolver) Type() string                 { return r.v.Type.String() }
+func (r *venueResolver) Rows() int32                  { return r.v.Rows }
+func (r *venueResolver) Columns() int32               { return r.v.Columns }
+func (r *venueResolver) Latitude() float64            { return float64(r.v.Latitude) }
+func (r *venueResolver) Longitude() float64           { return float64(r.v.Longitude) }
+func (r *venueResolver) ScreenNumber() int32          { return r.v.ScreenNumber }
+func (r *venueResolver) FormatsSupported() []string   { return nonNil(r.v.MovieFormatSupported) }
+func (r *venueResolver) LanguagesSupported() []string { return nonNil(r.v.LanguageSupported) }
+
+func (r *venueResolver) Seats(ctx context.Context) ([]*seatResolver, error) {
+	seats, err := load[[]*pb.SeatMatrix](ctx, loadersFrom(ctx).seats, stringKey(r.v.Id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*seatResolver, 0, len(seats))
+
+	for _, seat := range seats {
+		resolvers = append(resolvers, &seatResolver{seat})
+	}
+
+	return resolvers, nil
+}
+
+func (r *venueResolver) Showtimes() []*timeSlotResolver {
+	return timeSlotResolvers(r.v.MovieTimeSlots)
+}
+
+type seatResolver struct {
+	s *pb.SeatMatrix
+}
+
+func (r *seatResolver) ID() graphql.ID     { return id(r.s.Id) }
+func (r *seatResolver) SeatNumber() string { return r.s.SeatNumber }
+func (r *seatResolver) Row() int32         { return r.s.Row }
+func (r *seatResolver) Column() int32      { return r.s.Column }
+func (r *seatResolver) Price() int32       { return r.s.Price }
+func (r *seatResolver) Type() string       { return r.s.Type.String() }
+
+type timeSlotResolver struct {
+	t *pb.MovieTimeSlot
+}
+
+func timeSlotResolvers(slots []*pb.MovieTimeSlot) []*timeSlotResolver {
+	resolvers := make([]*timeSlotResolver, 0, len(slots))
+
+	for _, slot := range slots {
+		resolvers = append(resolvers, &timeSlotResolver{slot})
+	}
+
+	return resolvers
+}
+
+func (r *timeSlotResolver) StartTime() string { return r.t.StartTime }
+func (r *timeSlotResolver) EndTime() string   { return r.t.EndTime }
+func (r *timeSlotResolver) Duration() int32   { return r.t.Duration }
+func (r *timeSlotResolver) Date() string      { return r.t.Date }
+func (r *timeSlotResolver) Format() string    { return r.t.MovieFormat.String() }
+
+func (r *timeSlotResolver) Movie(ctx context.Context) (*movieResolver, error) {
+	movie, err := load[*pb.Movie](ctx, loadersFrom(ctx).movies, stringKey(r.t.Movieid))
+
+	if err != nil || movie == nil {
+		return nil, err
+	}
+
+	return &movieResolver{movie}, nil
+}
+
+func (r *timeSlotResolver) Venue(ctx context.Context) (*venueResolver, error) {
+	venue, err := load[*pb.Venue](ctx, loadersFrom(ctx).venues, stringKey(r.t.Venueid))
+
+	if err != nil || venue == nil {
+		return nil, err
+	}
+
+	return &venueResolver{venue}, nil
+}
+
+type reviewPageResolver struct {
+	r *pb.ReviewListResponse
+}
+
+func (r *reviewPageResolver) TotalCount() int32 { return r.r.TotalReviewCount }
+func (r *reviewPageResolver) TotalVotes() int32 { return r.r.TotalVotes }
+
+func (r *reviewPageResolver) Reviews() []*reviewResolver {
+	resolvers := make([]*reviewResolver, 0, len(r.r.GetReviewList().GetReviews()))
+
+	for _, review := range r.r.GetReviewList().GetReviews() {
+		resolvers = append(resolvers, &reviewResolver{review})
+	}
+
+	return resolvers
+}
+
+type reviewResolver struct {
+	r *pb.Review
+}
+
+func (r *reviewResolver) ID() graphql.ID       { return id(r.r.ReviewID) }
+func (r *reviewResolver) UserId() int32        { return r.r.UserID }
+func (r *reviewResolver) Rating() int32        { return r.r.Rating }
+func (r *reviewResolver) Title() string        { return r.r.Title }
+func (r *reviewResolver) Comment() string      { return r.r.Comment }
+func (r *reviewResolver) ReviewerName() string { return r.r.ReviewerName }
+func (r *reviewResolver) CreatedAt() int32     { return r.r.CreatedAt }
+
+func (r *reviewResolver) Movie(ctx context.Context) (*movieResolver, error) {
+	movie, err := load[*pb.Movie](ctx, loadersFrom(ctx).movies, stringKey(r.r.MovieID))
+
+	if err != nil || movie == nil {
+		return nil, err
+	}
+
+	return &movieResolver{movie}, nil
+}
+
+type viewerResolver struct {
+	claims utils.TokenClaims
+}
+
+func (r *viewerResolver) UserId() int32 { return r.claims.UserID }
+func (r *viewerResolver) Email() string { return r.claims.Email }
+func (r *viewerResolver) Role() string  { return r.claims.Role }
+
+type checkoutResolver struct {
+	key   string
+	valid bool
+}
+
+func (r *checkoutResolver) IdempotentKey() string { return r.key }
+func (r *checkoutResolver) Valid() bool           { return r.valid }
+
+func stringKey(value int32) string {
+	return strconv.Itoa(int(value))
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
@@ -0,0 +1,135 @@
+package graph
+
+// Schema maps the protobuf messages of the MovieDB, payment and auth services
+// onto GraphQL types. Field names follow the proto fields in camel case and
+// enums keep the proto value names.
+const Schema = `
+schema {
+	query: Query
+}
+
+type Query {
+	movie(id: ID!): Movie
+	movies(ids: [ID!]): [Movie!]!
+	upcomingMovies(date: String!): [Movie!]!
+	nowPlayingMovies(latitude: Float!, longitude: Float!): [Movie!]!
+	venue(id: ID!): Venue
+	showtimes(movieId: ID!, startDate: String!, endDate: String!, latitude: Float!, longitude: Float!): [MovieTimeSlot!]!
+	viewer: Viewer
+	checkout(idempotentKey: String!): Checkout!
+}
+
+enum SeatType {
+	TWO_D
+	THREE_D
+	FOUR_D
+	NORMAL
+	VIP
+}
+
+enum VenueType {
+	MOVIE
+	CONCERT
+	PLAY
+	STANDUP
+}
+
+enum SortBy {
+	ASCENDING
+	DESCENDING
+}
+
+enum FilterBy {
+	RATING
+	DATE
+}
+
+type Movie {
+	id: ID!
+	title: String!
+	description: String!
+	duration: Int!
+	languages: [String!]!
+	genres: [String!]!
+	castAndCrew: [CastAndCrew!]!
+	posterUrl: String!
+	screenWidePosterUrl: String!
+	trailerUrl: String!
+	releaseDate: String!
+	resolutions: [String!]!
+	votes: Float!
+	ranking: Int!
+	venues: [Venue!]!
+	reviews(limit: Int = 10, offset: Int = 0, sortBy: SortBy = DESCENDING, filterBy: FilterBy = DATE): ReviewPage!
+}
+
+type CastAndCrew {
+	name: String!
+	role: String!
+	characterName: String!
+	photoUrl: String!
+}
+
+type Venue {
+	id: ID!
+	name: String!
+	address: String!
+	type: VenueType!
+	rows: Int!
+	columns: Int!
+	latitude: Float!
+	longitude: Float!
+	screenNumber: Int!
+	formatsSupported: [String!]!
+	languagesSupported: [String!]!
+	seats: [Seat!]!
+	showtimes: [MovieTimeSlot!]!
+}
+
+type Seat {
+	id: ID!
+	seatNumber: String!
+	row: Int!
+	column: Int!
+	price: Int!
+	type: SeatType!
+}
+
+type MovieTimeSlot {
+	startTime: String!
+	endTime: String!
+	duration: Int!
+	date: String!
+	format: SeatType!
+	movie: Movie
+	venue: Venue
+}
+
+type ReviewPage {
+	totalCount: Int!
+	totalVotes: Int!
+	reviews: [Review!]!
+}
+
+type Review {
+	id: ID!
+	movie: Movie
+	userId: Int!
+	rating: Int!
+	title: String!
+	comment: String!
+	reviewerName: String!
+	createdAt: Int!
+}
+
+type Viewer {
+	userId: Int!
+	email: String!
+	role: String!
+}
+
+type Checkout {
+	idempotentKey: String!
+	valid: Boolean!
+}
+`
@@ -0,0 +1,616 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// A seat hold reserves seats of a showtime between picking them and paying for
+// them. Every held seat is a key holding the id of its hold, the keys of a hold
+// are written together by a script so a hold gets all of its seats or none.
+// The keys of a showtime share a hash tag and live on one Redis Cluster slot.
+
+const (
+	// seatHoldTTL is how long a hold lasts, extending it starts it over
+	seatHoldTTL = 10 * time.Minute
+	// maxSeatHoldLifetime bounds how long a hold can be extended for
+	maxSeatHoldLifetime = 30 * time.Minute
+	maxSeatsPerHold     = 10
+)
+
+// placeHoldScript holds the seats of KEYS[3..] for the hold ARGV[1] unless
+// another hold has one of them. KEYS[1] is the hold and KEYS[2] the held seats
+// of the showtime. ARGV[2] is the TTL in milliseconds, ARGV[3] the hold,
+// ARGV[4] its expiry in unix milliseconds and ARGV[5..] the seat ids. It
+// returns the seat ids held by other holds, none when the hold was placed.
+var placeHoldScript = redis.NewScript(`
+local conflicts = {}
+
+for i = 3, #KEYS do
+	local holder = redis.call('GET', KEYS[i])
+
+	if holder and holder ~= ARGV[1] then
+		table.insert(conflicts, tonumber(ARGV[i + 2]))
+	end
+end
+
+if #conflicts > 0 then
+	return conflicts
+end
+
+for i = 3, #KEYS do
+	redis.call('SET', KEYS[i], ARGV[1], 'PX', ARGV[2])
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[i + 2])
+end
+
+redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[2])
+
+if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+
+return conflicts
+`)
+
+// extendHoldScript renews the hold ARGV[1] when it still has all of its seats,
+// the keys and the other arguments are those of placeHoldScript. It returns 1
+// when the hold was extended.
+var extendHoldScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+
+for i = 3, #KEYS do
+	if redis.call('GET', KEYS[i]) ~= ARGV[1] then
+		return 0
+	end
+end
+
+for i = 3, #KEYS do
+	redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[i + 2])
+end
+
+redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[2])
+
+if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+
+return 1
+`)
+
+// releaseHoldScript frees the seats of KEYS[3..] still held by the hold
+// ARGV[1] and drops the hold. ARGV[2..] are the seat ids.
+var releaseHoldScript = redis.NewScript(`
+for i = 3, #KEYS do
+	if redis.call('GET', KEYS[i]) == ARGV[1] then
+		redis.call('DEL', KEYS[i])
+		redis.call('ZREM', KEYS[2], ARGV[i - 1])
+	end
+end
+
+return redis.call('DEL', KEYS[1])
+`)
+
+func seatHoldKey(slotID int32, holdID string) string {
+	return fmt.Sprintf("seats:{%d}:holds:%s", slotID, holdID)
+}
+
+// heldSeatKey holds the id of the hold that has a seat of a showtime
+func heldSeatKey(slotID int32, seatID int32) string {
+	return fmt.Sprintf("seats:{%d}:held:%d", slotID, seatID)
+}
+
+// heldSeatsKey scores the held seats of a showtime by the expiry of their hold
+func heldSeatsKey(slotID int32) string {
+	return fmt.Sprintf("seats:{%d}:held", slotID)
+}
+
+type SeatHold struct {
+	ID              string    `json:"id"`
+	MovieTimeSlotID int32     `json:"movieTimeSlotId"`
+	VenueID         int32     `json:"venueId"`
+	SeatMatrixIDs   []int32   `json:"seatMatrixIds"`
+	UserID          int32     `json:"userId"`
+	CreatedAt       time.Time `json:"createdAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
+type SeatHoldRequest struct {
+	// VenueID is the venue of the showtime, its seat matrix lays the seats out
+	VenueID       int32   `json:"venueId" validate:"required,gt=0"`
+	SeatMatrixIDs []int32 `json:"seatMatrixIds" validate:"required,min=1,max=10,dive,gt=0"`
+}
+
+// SeatHoldConflict is the answer when some of the seats are taken
+type SeatHoldConflict struct {
+	Error         string  `json:"error"`
+	SeatMatrixIDs []int32 `json:"seatMatrixIds"`
+}
+
+func (h *SeatHold) keys() []string {
+	keys := []string{seatHoldKey(h.MovieTimeSlotID, h.ID), heldSeatsKey(h.MovieTimeSlotID)}
+
+	for _, seatID := range h.SeatMatrixIDs {
+		keys = append(keys, heldSeatKey(h.MovieTimeSlotID, seatID))
+	}
+
+	return keys
+}
+
+// args are the arguments shared by placeHoldScript and extendHoldScript
+func (h *SeatHold) args() ([]any, error) {
+	encoded, err := json.Marshal(h)
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{h.ID, time.Until(h.ExpiresAt).Milliseconds(), encoded, h.ExpiresAt.UnixMilli()}
+
+	for _, seatID := range h.SeatMatrixIDs {
+		args = append(args, seatID)
+	}
+
+	return args, nil
+}
+
+// distinctSeatIDs sorts seat ids and drops repeats
+func distinctSeatIDs(seatIDs []int32) []int32 {
+	seen := make(map[int32]bool, len(seatIDs))
+	distinct := make([]int32, 0, len(seatIDs))
+
+	for _, seatID := range seatIDs {
+		if !seen[seatID] {
+			seen[seatID] = true
+			distinct = append(distinct, seatID)
+		}
+	}
+
+	sort.Slice(distinct, func(i, j int) bool { return distinct[i] < distinct[j] })
+
+	return distinct
+}
+
+// placeSeatHold holds seats of a showtime for a user. When some of the seats
+// are booked or held by someone else nothing is held and those seats are
+// returned.
+func (c *Config) placeSeatHold(ctx context.Context, seats *seatMap, userID int32, seatIDs []int32) (*SeatHold, []int32, error) {
+	if c.RedisClient == nil {
+		return nil, nil, fmt.Errorf("seat holds are not configured")
+	}
+
+	seatIDs = distinctSeatIDs(seatIDs)
+
+	var taken []int32
+
+	for _, seatID := range seatIDs {
+		if seats.booked[seatID] {
+			taken = append(taken, seatID)
+		}
+	}
+
+	if len(taken) > 0 {
+		return nil, taken, nil
+	}
+
+	now := time.Now()
+
+	hold := &SeatHold{
+		ID:              utils.GenerateIdempotentKey(),
+		MovieTimeSlotID: seats.slotID,
+		VenueID:         seats.venueID,
+		SeatMatrixIDs:   seatIDs,
+		UserID:          userID,
+		CreatedAt:       now.UTC(),
+		ExpiresAt:       now.Add(seatHoldTTL).UTC(),
+	}
+
+	args, err := hold.args()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conflicts, err := placeHoldScript.Run(ctx, c.RedisClient, hold.keys(), args...).Int64Slice()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error holding seats: %w", err)
+	}
+
+	for _, seatID := range conflicts {
+		taken = append(taken, int32(seatID))
+	}
+
+	if len(taken) > 0 {
+		return nil, taken, nil
+	}
+
+	return hold, nil, nil
+}
+
+// seatHold returns a hold that has not expired, nil when there is none
+func (c *Config) seatHold(ctx context.Context, slotID int32, holdID string) (*SeatHold, error) {
+	if c.RedisClient == nil || holdID == "" {
+		return nil, nil
+	}
+
+	encoded, err := c.RedisClient.Get(ctx, seatHoldKey(slotID, holdID)).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var hold SeatHold
+
+	if err := json.Unmarshal(encoded, &hold); err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// extendSeatHold starts the TTL of a hold over, up to its lifetime. It
+// returns false when the hold has expired in the meantime.
+func (c *Config) extendSeatHold(ctx context.Context, hold *SeatHold) (bool, error) {
+	expiresAt := time.Now().Add(seatHoldTTL)
+
+	if limit := hold.CreatedAt.Add(maxSeatHoldLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	if !expiresAt.After(hold.ExpiresAt) {
+		return true, nil
+	}
+
+	extended := *hold
+	extended.ExpiresAt = expiresAt.UTC()
+
+	args, err := extended.args()
+
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := extendHoldScript.Run(ctx, c.RedisClient, extended.keys(), args...).Bool()
+
+	if err != nil || !ok {
+		return false, err
+	}
+
+	*hold = extended
+
+	return true, nil
+}
+
+// releaseSeatHold frees the seats of a hold
+func (c *Config) releaseSeatHold(ctx context.Context, hold *SeatHold) error {
+	if c.RedisClient == nil {
+		return nil
+	}
+
+	args := []any{hold.ID}
+
+	for _, seatID := range hold.SeatMatrixIDs {
+		args = append(args, seatID)
+	}
+
+	return releaseHoldScript.Run(ctx, c.RedisClient, hold.keys(), args...).Err()
+}
+
+// heldSeatIDs returns the seats of a showtime under a hold. The held seats are
+// confirmed with their keys, which expire with the hold, and seats of expired
+// holds are pruned on the way.
+func (c *Config) heldSeatIDs(ctx context.Context, slotID int32) (map[int32]bool, error) {
+	held := map[int32]bool{}
+
+	if c.RedisClient == nil {
+		return held, nil
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	if err := c.RedisClient.ZRemRangeByScore(ctx, heldSeatsKey(slotID), "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := c.RedisClient.ZRange(ctx, heldSeatsKey(slotID), 0, -1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	seatIDs := make([]int32, 0, len(members))
+
+	for _, member := range members {
+		if seatID, err := strconv.ParseInt(member, 10, 32); err == nil {
+			seatIDs = append(seatIDs, int32(seatID))
+		}
+	}
+
+	holders, err := c.seatHolders(ctx, slotID, seatIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for seatID := range holders {
+		held[seatID] = true
+	}
+
+	return held, nil
+}
+
+// seatHolders returns the hold of every seat that has one
+func (c *Config) seatHolders(ctx context.Context, slotID int32, seatIDs []int32) (map[int32]string, error) {
+	holders := map[int32]string{}
+
+	if c.RedisClient == nil || len(seatIDs) == 0 {
+		return holders, nil
+	}
+
+	keys := make([]string, len(seatIDs))
+
+	for i, seatID := range seatIDs {
+		keys[i] = heldSeatKey(slotID, seatID)
+	}
+
+	values, err := c.RedisClient.MGet(ctx, keys...).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if holdID, ok := value.(string); ok {
+			holders[seatIDs[i]] = holdID
+		}
+	}
+
+	return holders, nil
+}
+
+// withHeldSeats adds the held seats of a showtime to its booked seats, they are
+// marked as not booked
+func (c *Config) withHeldSeats(ctx context.Context, slotID int32, booked []*pb.BookedSeats) []*pb.BookedSeats {
+	held, err := c.heldSeatIDs(ctx, slotID)
+
+	if err != nil {
+		log.Error("error reading held seats: ", err)
+		return booked
+	}
+
+	for _, seat := range booked {
+		delete(held, seat.SeatMatrixID)
+	}
+
+	seatIDs := make([]int32, 0, len(held))
+
+	for seatID := range held {
+		seatIDs = append(seatIDs, seatID)
+	}
+
+	sort.Slice(seatIDs, func(i, j int) bool { return seatIDs[i] < seatIDs[j] })
+
+	for _, seatID := range seatIDs {
+		booked = append(booked, &pb.BookedSeats{SeatMatrixID: seatID, MovieTimeSlotID: slotID})
+	}
+
+	return booked
+}
+
+// ownSeatHold reads the hold of the request and checks that it belongs to the
+// signed in user, it writes the error response when it does not
+func (c *Config) ownSeatHold(w http.ResponseWriter, r *http.Request) (*SeatHold, bool) {
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	slotID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	hold, err := c.seatHold(r.Context(), slotID, chi.URLParam(r, "holdId"))
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading seat hold: %v"}`, err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if hold == nil || (hold.UserID != user.UserID && !user.IsAdmin()) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No seat hold found, it may have expired"}`, http.StatusNotFound)
+		return nil, false
+	}
+
+	return hold, true
+}
+
+// HoldSeats holds seats of a showtime for the signed in user, all of them or
+// none. The seats must keep to the seat rules of the venue.
+func (c *Config) HoldSeats(w http.ResponseWriter, r *http.Request) {
+	var requestBody SeatHoldRequest
+
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	slotID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.UnmarshalJSON(bodyBytes, &requestBody); err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	seatIDs := distinctSeatIDs(requestBody.SeatMatrixIDs)
+
+	if len(seatIDs) == 0 || len(seatIDs) > maxSeatsPerHold || seatIDs[0] <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "seatMatrixIds must hold 1 to %d seat ids"}`, maxSeatsPerHold), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.VenueID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venueId of the showtime is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Seat holds are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	seats, err := c.showtimeSeatMap(r.Context(), slotID, requestBody.VenueID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if seats == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No seat matrix could be found for the venue"}`, http.StatusNotFound)
+		return
+	}
+
+	var taken []int32
+
+	for _, seatID := range seatIDs {
+		if seats.taken(seatID) {
+			taken = append(taken, seatID)
+		}
+	}
+
+	if len(taken) > 0 {
+		writeJSON(w, http.StatusConflict, SeatHoldConflict{Error: "Some of the seats are already taken", SeatMatrixIDs: taken})
+		return
+	}
+
+	if !c.checkSelection(w, r, seats, seatIDs) {
+		return
+	}
+
+	hold, taken, err := c.placeSeatHold(r.Context(), seats, user.UserID, seatIDs)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if len(taken) > 0 {
+		writeJSON(w, http.StatusConflict, SeatHoldConflict{Error: "Some of the seats are already taken", SeatMatrixIDs: taken})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, hold)
+}
+
+func (c *Config) GetSeatHold(w http.ResponseWriter, r *http.Request) {
+	hold, ok := c.ownSeatHold(w, r)
+
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hold)
+}
+
+// ExtendSeatHold starts the TTL of a hold over, a hold lasts at most
+// maxSeatHoldLifetime
+func (c *Config) ExtendSeatHold(w http.ResponseWriter, r *http.Request) {
+	hold, ok := c.ownSeatHold(w, r)
+
+	if !ok {
+		return
+	}
+
+	previous := hold.ExpiresAt
+
+	extended, err := c.extendSeatHold(r.Context(), hold)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error extending seat hold: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !extended {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No seat hold found, it may have expired"}`, http.StatusNotFound)
+		return
+	}
+
+	if !hold.ExpiresAt.After(previous) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "A seat hold cannot last longer than %v"}`, maxSeatHoldLifetime), http.StatusConflict)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hold)
+}
+
+// ReleaseSeatHold frees the seats of a hold before it expires
+func (c *Config) ReleaseSeatHold(w http.ResponseWriter, r *http.Request) {
+	hold, ok := c.ownSeatHold(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := c.releaseSeatHold(r.Context(), hold); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error releasing seat hold: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
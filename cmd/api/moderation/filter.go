@@ -0,0 +1,223 @@
+package moderation
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Flag is a reason a review was held for a moderator
+type Flag string
+
+const (
+	FlagProfanity Flag = "profanity"
+	FlagSpam      Flag = "spam"
+	FlagLink      Flag = "link"
+	FlagDuplicate Flag = "duplicate"
+)
+
+// DefaultWords is the word list used when none is configured. Entries with
+// more than one word match as a phrase.
+var DefaultWords = []string{
+	"fuck", "fucking", "shit", "bullshit", "bitch", "bastard", "asshole", "cunt",
+	"motherfucker", "slut", "whore",
+	"viagra", "casino", "crypto giveaway", "free money", "click here", "buy now",
+	"work from home", "promo code", "dm me", "whatsapp me",
+}
+
+// Thresholds of the spam heuristics
+const (
+	shoutingMinLetters  = 20
+	shoutingUpperRatio  = 0.7
+	repetitionMinWords  = 8
+	repetitionWordRatio = 0.4
+	contactNumberDigits = 10
+)
+
+var (
+	linkPattern = regexp.MustCompile(`(?i)(https?://|www\.|\b[a-z0-9-]+\.(com|net|org|io|ly|xyz|info|biz|ru|tk)\b)`)
+	// a run of digits with at most one separator between them
+	contactNumberPattern = regexp.MustCompile(`(\+?\d[\s.\-]?){` + strconv.Itoa(contactNumberDigits) + `,}`)
+)
+
+// leet maps the characters used to dodge word lists back to letters
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+
+// Filter flags reviews that need a moderator. It is safe for concurrent use.
+type Filter struct {
+	words   map[string]bool
+	phrases [][]string
+}
+
+// NewFilter returns a filter that flags the given words and phrases, matching
+// ignores case and common letter substitutions
+func NewFilter(words []string) *Filter {
+	f := &Filter{words: map[string]bool{}}
+
+	for _, entry := range words {
+		tokens := tokenize(entry, true)
+
+		switch len(tokens) {
+		case 0:
+		case 1:
+			f.words[tokens[0]] = true
+		default:
+			f.phrases = append(f.phrases, tokens)
+		}
+	}
+
+	return f
+}
+
+// ParseWordList reads a word list with one word or phrase per line, blank lines
+// and lines starting with # are skipped
+func ParseWordList(r io.Reader) ([]string, error) {
+	var words []string
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words = append(words, line)
+	}
+
+	return words, scanner.Err()
+}
+
+// Check returns the flags raised by the texts of a review, sorted and without
+// duplicates. Duplicate content is checked by the caller with Fingerprint.
+func (f *Filter) Check(texts ...string) []Flag {
+	found := map[Flag]bool{}
+
+	for _, text := range texts {
+		if f.profane(text) {
+			found[FlagProfanity] = true
+		}
+
+		if linkPattern.MatchString(text) {
+			found[FlagLink] = true
+		}
+	}
+
+	// a short title and a short comment may only shout together
+	if spammy(strings.Join(texts, "\n")) {
+		found[FlagSpam] = true
+	}
+
+	flags := make([]Flag, 0, len(found))
+
+	for flag := range found {
+		flags = append(flags, flag)
+	}
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+
+	return flags
+}
+
+func (f *Filter) profane(text string) bool {
+	tokens := tokenize(text, true)
+
+	for i, token := range tokens {
+		if f.words[token] {
+			return true
+		}
+
+		for _, phrase := range f.phrases {
+			if i+len(phrase) <= len(tokens) && equal(tokens[i:i+len(phrase)], phrase) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// spammy reports text that shouts, repeats itself or advertises a phone
+// number
+func spammy(text string) bool {
+	var letters, upper int
+
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	if letters >= shoutingMinLetters && float64(upper) >= shoutingUpperRatio*float64(letters) {
+		return true
+	}
+
+	tokens := tokenize(text, false)
+
+	if len(tokens) >= repetitionMinWords {
+		counts := map[string]int{}
+
+		for _, token := range tokens {
+			counts[token]++
+
+			if float64(counts[token]) > repetitionWordRatio*float64(len(tokens)) {
+				return true
+			}
+		}
+	}
+
+	return contactNumberPattern.MatchString(text)
+}
+
+// Fingerprint identifies the content of a review regardless of case, spacing
+// and punctuation, empty content has no fingerprint
+func Fingerprint(texts ...string) string {
+	var tokens []string
+
+	for _, text := range texts {
+		tokens = append(tokens, tokenize(text, false)...)
+	}
+
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(tokens, " ")))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// tokenize lowercases text and splits it into words, with deobfuscate the
+// letter substitutions of leet are undone first
+func tokenize(text string, deobfuscate bool) []string {
+	text = strings.ToLower(text)
+
+	if deobfuscate {
+		text = leet.Replace(text)
+	}
+
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func equal(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,545 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/moderation"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// Reviews pass through moderation before they reach MovieDB. Clean reviews are
+// published right away, flagged ones wait in a queue in Redis until an admin
+// approves or rejects them. Every outcome is appended to the moderation log.
+
+const (
+	pendingReviewsKey   = "reviews:pending"
+	pendingReviewSeqKey = "reviews:pending:seq"
+	moderationLogKey    = "reviews:moderation:log"
+	// maxModerationLog bounds how many outcomes the log keeps
+	maxModerationLog = 10000
+	// reviewFingerprintTTL is how long published content counts for the
+	// duplicate check
+	reviewFingerprintTTL = 90 * 24 * time.Hour
+)
+
+const (
+	defaultModerationLimit = 50
+	maxModerationLimit     = 200
+)
+
+// Moderation outcomes
+const (
+	moderationPublished = "published"
+	moderationHeld      = "held"
+	moderationApproved  = "approved"
+	moderationRejected  = "rejected"
+)
+
+var defaultReviewFilter = moderation.NewFilter(moderation.DefaultWords)
+
+func pendingReviewKey(id int64) string {
+	return fmt.Sprintf("reviews:pending:%d", id)
+}
+
+// pendingAuthorHold is what the author key of a held review holds, it keeps
+// the author from posting another review while the first one waits
+func pendingAuthorHold(id int64) string {
+	return fmt.Sprintf("pending:%d", id)
+}
+
+func reviewFingerprintKey(fingerprint string) string {
+	return fmt.Sprintf("reviews:fingerprint:%s", fingerprint)
+}
+
+// PendingReview is a review held for a moderator. ReviewID is set when the
+// review is an edit of a published review, Verified when the author of a new
+// review is a verified viewer.
+type PendingReview struct {
+	ID          int64             `json:"id"`
+	ReviewID    int32             `json:"reviewId,omitempty"`
+	MovieID     int32             `json:"movieId"`
+	UserID      int32             `json:"userId"`
+	Title       string            `json:"title"`
+	Comment     string            `json:"comment"`
+	Rating      int32             `json:"rating"`
+	Flags       []moderation.Flag `json:"flags"`
+	Verified    bool              `json:"verified"`
+	SubmittedAt time.Time         `json:"submittedAt"`
+}
+
+// ModerationRecord is an entry of the moderation log
+type ModerationRecord struct {
+	Action      string            `json:"action"`
+	PendingID   int64             `json:"pendingId,omitempty"`
+	ReviewID    int32             `json:"reviewId,omitempty"`
+	MovieID     int32             `json:"movieId"`
+	UserID      int32             `json:"userId"`
+	Flags       []moderation.Flag `json:"flags"`
+	ModeratorID int32             `json:"moderatorId,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	At          time.Time         `json:"at"`
+}
+
+type PendingReviewList struct {
+	Reviews []PendingReview `json:"reviews"`
+	Total   int64           `json:"total"`
+}
+
+func (c *Config) reviewFilter() *moderation.Filter {
+	if c.ReviewFilter != nil {
+		return c.ReviewFilter
+	}
+
+	return defaultReviewFilter
+}
+
+// moderateReview returns the flags raised by a review. Content already posted
+// by another user, or for another movie, is a duplicate.
+func (c *Config) moderateReview(ctx context.Context, movieID int32, userID int32, title string, comment string) ([]moderation.Flag, error) {
+	flags := c.reviewFilter().Check(title, comment)
+
+	fingerprint := moderation.Fingerprint(title, comment)
+
+	if c.RedisClient == nil || fingerprint == "" {
+		return flags, nil
+	}
+
+	owner, err := c.RedisClient.Get(ctx, reviewFingerprintKey(fingerprint)).Result()
+
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if err == nil && owner != fmt.Sprintf("%d:%d", movieID, userID) {
+		flags = append(flags, moderation.FlagDuplicate)
+	}
+
+	return flags, nil
+}
+
+// rememberReviewContent records the content of a review for the duplicate
+// check, the first poster keeps it
+func (c *Config) rememberReviewContent(ctx context.Context, movieID int32, userID int32, title string, comment string) {
+	fingerprint := moderation.Fingerprint(title, comment)
+
+	if c.RedisClient == nil || fingerprint == "" {
+		return
+	}
+
+	if err := c.RedisClient.SetNX(ctx, reviewFingerprintKey(fingerprint), fmt.Sprintf("%d:%d", movieID, userID), reviewFingerprintTTL).Err(); err != nil {
+		log.Error("error recording review fingerprint: ", err)
+	}
+}
+
+// holdReview queues a review for a moderator and returns it with its id. Its
+// content is only remembered for the duplicate check once it is approved.
+func (c *Config) holdReview(ctx context.Context, pending PendingReview) (PendingReview, error) {
+	if c.RedisClient == nil {
+		return pending, fmt.Errorf("moderation queue is not configured")
+	}
+
+	id, err := c.RedisClient.Incr(ctx, pendingReviewSeqKey).Result()
+
+	if err != nil {
+		return pending, err
+	}
+
+	pending.ID = id
+	pending.SubmittedAt = time.Now().UTC()
+
+	raw, err := json.Marshal(pending)
+
+	if err != nil {
+		return pending, err
+	}
+
+	pipe := c.RedisClient.TxPipeline()
+	pipe.Set(ctx, pendingReviewKey(id), raw, 0)
+	pipe.ZAdd(ctx, pendingReviewsKey, redis.Z{Score: float64(pending.SubmittedAt.Unix()), Member: id})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return pending, err
+	}
+
+	return pending, nil
+}
+
+func (c *Config) pendingReview(ctx context.Context, id int64) (*PendingReview, error) {
+	raw, err := c.RedisClient.Get(ctx, pendingReviewKey(id)).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pending PendingReview
+
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// recordModeration appends an outcome to the moderation log
+func (c *Config) recordModeration(ctx context.Context, record ModerationRecord) {
+	record.At = time.Now().UTC()
+
+	log.WithFields(log.Fields{
+		"action":    record.Action,
+		"pendingId": record.PendingID,
+		"reviewId":  record.ReviewID,
+		"movieId":   record.MovieID,
+		"userId":    record.UserID,
+		"flags":     record.Flags,
+		"moderator": record.ModeratorID,
+	}).Info("review moderation")
+
+	if c.RedisClient == nil {
+		return
+	}
+
+	raw, err := json.Marshal(record)
+
+	if err != nil {
+		log.Error("error marshalling moderation record: ", err)
+		return
+	}
+
+	pipe := c.RedisClient.TxPipeline()
+	pipe.LPush(ctx, moderationLogKey, raw)
+	pipe.LTrim(ctx, moderationLogKey, 0, maxModerationLog-1)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error("error recording moderation outcome: ", err)
+	}
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	jsonResponse, err := utils.MarshalJSON(v)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err = w.Write(jsonResponse); err != nil {
+		log.Error("error writing JSON response: ", err)
+	}
+}
+
+// claimPendingReview takes a review off the queue so that a single moderator
+// acts on it
+func (c *Config) claimPendingReview(w http.ResponseWriter, r *http.Request) (*PendingReview, bool) {
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Moderation queue is not configured"}`, http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	id, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	removed, err := c.RedisClient.ZRem(r.Context(), pendingReviewsKey, id).Result()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation queue: %v"}`, err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	pending, err := c.pendingReview(r.Context(), int64(id))
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation queue: %v"}`, err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if removed == 0 || pending == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No pending review found"}`, http.StatusNotFound)
+		return nil, false
+	}
+
+	return pending, true
+}
+
+// requeuePendingReview puts a claimed review back when acting on it failed
+func (c *Config) requeuePendingReview(ctx context.Context, pending *PendingReview) {
+	err := c.RedisClient.ZAdd(ctx, pendingReviewsKey, redis.Z{Score: float64(pending.SubmittedAt.Unix()), Member: pending.ID}).Err()
+
+	if err != nil {
+		log.Error("error requeueing pending review: ", err)
+	}
+}
+
+func (c *Config) AdminListPendingReviews(w http.ResponseWriter, r *http.Request) {
+	if c.RedisClient == nil {
+		writeJSON(w, http.StatusOK, PendingReviewList{})
+		return
+	}
+
+	limit, err := queryLimit(r, defaultModerationLimit, maxModerationLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.RedisClient.ZRange(r.Context(), pendingReviewsKey, 0, int64(limit-1)).Result()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation queue: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	total, err := c.RedisClient.ZCard(r.Context(), pendingReviewsKey).Result()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation queue: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	list := PendingReviewList{Total: total}
+
+	for _, raw := range ids {
+		id, _ := strconv.ParseInt(raw, 10, 64)
+
+		pending, err := c.pendingReview(r.Context(), id)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation queue: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if pending != nil {
+			list.Reviews = append(list.Reviews, *pending)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// AdminApprovePendingReview publishes a held review, or applies a held edit
+func (c *Config) AdminApprovePendingReview(w http.ResponseWriter, r *http.Request) {
+	moderator, _ := UserFromContext(r.Context())
+
+	pending, ok := c.claimPendingReview(w, r)
+
+	if !ok {
+		return
+	}
+
+	var response *pb.ReviewResponse
+	var previous *pb.Review
+	var err error
+
+	review := &pb.Review{
+		ReviewID: pending.ReviewID,
+		MovieID:  pending.MovieID,
+		UserID:   pending.UserID,
+		Rating:   pending.Rating,
+		Comment:  pending.Comment,
+		Title:    pending.Title,
+	}
+
+	if pending.ReviewID != 0 {
+		// the review as it was, to move the aggregates of the movie off it
+		previous, _, err = c.authorizedReview(r.Context(), moderator, pending.MovieID, pending.ReviewID)
+
+		if err == nil {
+			review.CreatedAt = previous.CreatedAt
+		}
+
+		response, err = c.MovieDB_service.UpdateReview(r.Context(), &pb.ReviewUpdateRequest{
+			UserID:   pending.UserID,
+			ReviewID: pending.ReviewID,
+			MovieID:  pending.MovieID,
+			Title:    pending.Title,
+			Comment:  pending.Comment,
+			Rating:   pending.Rating,
+		})
+	} else {
+		response, err = c.MovieDB_service.AddReview(r.Context(), review)
+	}
+
+	if err == nil && response != nil && response.Error != "" {
+		err = fmt.Errorf("%s", response.Error)
+	}
+
+	if err != nil || response == nil {
+		c.requeuePendingReview(context.Background(), pending)
+
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error publishing review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	record := ModerationRecord{
+		Action:      moderationApproved,
+		PendingID:   pending.ID,
+		ReviewID:    pending.ReviewID,
+		MovieID:     pending.MovieID,
+		UserID:      pending.UserID,
+		Flags:       pending.Flags,
+		ModeratorID: moderator.UserID,
+	}
+
+	if response.Review != nil && response.Review.ReviewID > 0 {
+		record.ReviewID = response.Review.ReviewID
+	}
+
+	// a new review now holds the place of the author for the movie, without
+	// its id the hold is dropped and MovieDB answers for the author instead
+	if pending.ReviewID == 0 {
+		authorKey := reviewAuthorKey(pending.MovieID, pending.UserID)
+
+		if record.ReviewID > 0 {
+			c.RedisClient.Set(r.Context(), authorKey, record.ReviewID, 0)
+
+			if pending.Verified {
+				c.markVerifiedReview(r.Context(), pending.MovieID, record.ReviewID)
+			}
+		} else {
+			c.RedisClient.Del(r.Context(), authorKey)
+		}
+	}
+
+	// an edit of a review that could not be read leaves the aggregates to be
+	// computed again
+	if pending.ReviewID != 0 && previous == nil {
+		c.RedisClient.Del(r.Context(), reviewAggregatesKey(pending.MovieID))
+	} else {
+		c.adjustReviewAggregates(r.Context(), pending.MovieID, previous, publishedReview(response, review))
+	}
+
+	c.rememberReviewContent(r.Context(), pending.MovieID, pending.UserID, pending.Title, pending.Comment)
+
+	c.RedisClient.Del(r.Context(), pendingReviewKey(pending.ID))
+	c.recordModeration(r.Context(), record)
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+type RejectReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminRejectPendingReview drops a held review, the author may post a new one
+func (c *Config) AdminRejectPendingReview(w http.ResponseWriter, r *http.Request) {
+	var requestBody RejectReviewRequest
+
+	moderator, _ := UserFromContext(r.Context())
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	// the reason is optional, so is the body
+	if len(bytes.TrimSpace(bodyBytes)) > 0 {
+		if err := utils.UnmarshalJSON(bodyBytes, &requestBody); err != nil {
+			http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pending, ok := c.claimPendingReview(w, r)
+
+	if !ok {
+		return
+	}
+
+	if pending.ReviewID == 0 {
+		authorKey := reviewAuthorKey(pending.MovieID, pending.UserID)
+
+		if hold, _ := c.RedisClient.Get(r.Context(), authorKey).Result(); hold == pendingAuthorHold(pending.ID) {
+			c.RedisClient.Del(r.Context(), authorKey)
+		}
+	}
+
+	c.RedisClient.Del(r.Context(), pendingReviewKey(pending.ID))
+
+	record := ModerationRecord{
+		Action:      moderationRejected,
+		PendingID:   pending.ID,
+		ReviewID:    pending.ReviewID,
+		MovieID:     pending.MovieID,
+		UserID:      pending.UserID,
+		Flags:       pending.Flags,
+		ModeratorID: moderator.UserID,
+		Reason:      requestBody.Reason,
+	}
+
+	c.recordModeration(r.Context(), record)
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+// AdminGetModerationLog returns the latest moderation outcomes, newest first
+func (c *Config) AdminGetModerationLog(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryLimit(r, defaultModerationLimit, maxModerationLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	records := []ModerationRecord{}
+
+	if c.RedisClient != nil {
+		entries, err := c.RedisClient.LRange(r.Context(), moderationLogKey, 0, int64(limit-1)).Result()
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error reading moderation log: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		for _, entry := range entries {
+			var record ModerationRecord
+
+			if err := json.Unmarshal([]byte(entry), &record); err != nil {
+				log.Error("error unmarshalling moderation record: ", err)
+				continue
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
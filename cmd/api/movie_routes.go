@@ -2,16 +2,16 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	dodopayments "github.com/dodopayments/dodopayments-go"
 	"github.com/go-chi/chi/v5"
 	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
 
 	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
 	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
@@ -62,7 +62,7 @@ func (c *Config) CheckIfUserExists(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -82,6 +82,10 @@ func (c *Config) CheckIfUserExists(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type OTPRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 func (c *Config) GenerateOTP(w http.ResponseWriter, r *http.Request) {
 
 	// First retrieve the email from the request body
@@ -89,9 +93,7 @@ func (c *Config) GenerateOTP(w http.ResponseWriter, r *http.Request) {
 	// Insert data in the redis cache
 	// Return the OTP to the user via email
 
-	var requestBody struct {
-		Email string `json:"email" validate:"required,email"`
-	}
+	var requestBody OTPRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -101,7 +103,7 @@ func (c *Config) GenerateOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -155,7 +157,7 @@ func (c *Config) GenerateOTP(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 
-	jsonResponse, err := json.Marshal(map[string]string{
+	jsonResponse, err := utils.MarshalJSON(map[string]string{
 		"message": "OTP sent successfully",
 	})
 
@@ -175,16 +177,18 @@ func (c *Config) GenerateOTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
+type ValidateOTPRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	OTP   string `json:"otp" validate:"required,len=6"`
+}
+
 func (c *Config) ValidateOTP(w http.ResponseWriter, r *http.Request) {
 	// Validate the OTP provided by the user
 	// Check if the OTP exists in Redis
 	// If it exists, delete it from Redis and return success
 	// If it doesn't exist, return an error
 
-	var requestBody struct {
-		Email string `json:"email" validate:"required,email"`
-		OTP   string `json:"otp" validate:"required,len=6"`
-	}
+	var requestBody ValidateOTPRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -194,7 +198,7 @@ func (c *Config) ValidateOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -241,7 +245,7 @@ func (c *Config) ValidateOTP(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 
-	jsonResponse, err := json.Marshal(map[string]string{
+	jsonResponse, err := utils.MarshalJSON(map[string]string{
 		"message": "OTP validated successfully",
 	})
 
@@ -289,7 +293,7 @@ func (c *Config) ValidateToken(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	jsonResponse, err := json.Marshal(map[string]string{
+	jsonResponse, err := utils.MarshalJSON(map[string]string{
 		"message": "Token is valid",
 	})
 
@@ -307,12 +311,14 @@ func (c *Config) ValidateToken(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=32"`
+}
+
 func (c *Config) Login(w http.ResponseWriter, r *http.Request) {
 
-	var requestBody struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=8,max=32"`
-	}
+	var requestBody LoginRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -322,7 +328,7 @@ func (c *Config) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -368,7 +374,7 @@ func (c *Config) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	w.WriteHeader(http.StatusOK)
-	jsonResponse, err := json.Marshal(map[string]string{
+	jsonResponse, err := utils.MarshalJSON(map[string]string{
 		"message": "User logged in successfully",
 		"token":   response.Token,
 	})
@@ -387,14 +393,16 @@ func (c *Config) Login(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type RegisterUserRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=32"`
+	// PhoneNumber string `json:"phoneNumber" validate:"required,e164"` // assuming E.164 format
+	Role string `json:"role" validate:"required,oneof=admin user"`
+}
+
 func (c *Config) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
-	var requestBody struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=8,max=32"`
-		// PhoneNumber string `json:"phoneNumber" validate:"required,e164"` // assuming E.164 format
-		Role string `json:"role" validate:"required,oneof=admin user"`
-	}
+	var requestBody RegisterUserRequest
 
 	bodyyBytes, err := io.ReadAll(r.Body)
 
@@ -404,7 +412,7 @@ func (c *Config) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -460,7 +468,7 @@ func (c *Config) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	jsonResponse, err := json.Marshal(map[string]string{
+	jsonResponse, err := utils.MarshalJSON(map[string]string{
 		"message": "User registered successfully",
 		"token":   response.Token,
 	})
@@ -484,6 +492,10 @@ func (c *Config) GetUpcomingMovies(w http.ResponseWriter, r *http.Request) {
 	// Extract the "date" parameter from the URL
 	dateParam := chi.URLParam(r, "date")
 
+	if dateParam == "" {
+		dateParam = r.URL.Query().Get("date")
+	}
+
 	fmt.Println("dateParam: ", dateParam)
 
 	if dateParam == "" {
@@ -509,8 +521,16 @@ func (c *Config) GetUpcomingMovies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	movies, err := filterMoviesByPerson(r, response.MovieList)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
 	// Marshal the response to JSON
-	jsonResponse, err := json.Marshal(response.MovieList)
+	jsonResponse, err := utils.MarshalJSON(movies)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
@@ -527,11 +547,13 @@ func (c *Config) GetUpcomingMovies(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type NowPlayingRequest struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+}
+
 func (c *Config) GetNowPlayingMovies(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Longitude float64 `json:"longitude"`
-		Latitude  float64 `json:"latitude"`
-	}
+	var requestBody NowPlayingRequest
 
 	// Read and parse the request body
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -541,7 +563,7 @@ func (c *Config) GetNowPlayingMovies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		http.Error(w, "error unmarshalling JSON from request body", http.StatusBadRequest)
@@ -565,8 +587,15 @@ func (c *Config) GetNowPlayingMovies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	movies, err := filterMoviesByPerson(r, response.MovieList)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Marshal the response to JSON
-	jsonResponse, err := json.Marshal(&response.MovieList)
+	jsonResponse, err := utils.MarshalJSON(&movies)
 	if err != nil {
 		http.Error(w, "Error marshalling JSON response", http.StatusInternalServerError)
 		return
@@ -612,7 +641,7 @@ func (c *Config) GetMovieDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Marshal the response to JSON
-	jsonResponse, err := json.Marshal(response.Movie)
+	jsonResponse, err := utils.MarshalJSON(response.Movie)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
@@ -629,260 +658,16 @@ func (c *Config) GetMovieDetails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (c *Config) GetMovieReviews(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Offset   int32       `json:"offset"`
-		SortBy   pb.SortBy   `json:"sortBy"`
-		Limit    int32       `json:"limit"`
-		FilterBy pb.FilterBy `json:"filterBy"`
-	}
-
-	bodyBytes, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(bodyBytes, &requestBody)
-	if err != nil {
-		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
-		return
-	}
-
-	// Extract the "id" parameter from the URL
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	idInt, err := strconv.Atoi(id)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Invalid 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	// Call the gRPC service
-
-	response, err := c.MovieDB_service.GetAllMovieReviews(context.Background(), &pb.GetAllMovieReviewsRequest{
-		MovieID:  int32(idInt),
-		Offset:   requestBody.Offset,
-		SortBy:   requestBody.SortBy,
-		FilterBy: requestBody.FilterBy,
-		Limit:    requestBody.Limit,
-	})
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error getting movie reviews: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	// Validate the gRPC response
-
-	if response == nil || response.ReviewList == nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "No movie reviews found"}`, http.StatusNotFound)
-		return
-	}
-
-	// Marshal the response to JSON
-
-	jsonResponse, err := json.Marshal(response)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	// Write the JSON response
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(jsonResponse)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
-	}
-
-}
-
-func (c *Config) AddMovieReview(w http.ResponseWriter, r *http.Request) {
-	// Extract the "id" parameter from the URL
-	var requestBody struct {
-		UserID  int32  `json:"userId"`
-		Title   string `json:"title"`
-		Comment string `json:"comment"`
-		Rating  int32  `json:"rating"`
-	}
-
-	bodyBytes, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(bodyBytes, &requestBody)
-
-	if err != nil {
-		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
-		return
-	}
-
-	if requestBody.Rating <= 0 || requestBody.Rating > 5 {
-		http.Error(w, `error rating cannot be less than 1 or greater than 5`, http.StatusBadRequest)
-		return
-	}
-
-	if requestBody.Comment == "" {
-		http.Error(w, "error comment cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	if requestBody.Title == "" {
-		http.Error(w, "error title cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	if requestBody.UserID <= 0 {
-		http.Error(w, "error userId cannot be less than 1", http.StatusBadRequest)
-		return
-	}
-
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	idInt, err := strconv.Atoi(id)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Invalid 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	response, err := c.MovieDB_service.AddReview(context.Background(), &pb.Review{
-		MovieID: int32(idInt),
-		UserID:  requestBody.UserID,
-		Rating:  requestBody.Rating,
-		Comment: requestBody.Comment,
-		Title:   requestBody.Title,
-	})
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error adding movie review: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	if response == nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
-		return
-	}
-
-	jsonResponse, err := json.Marshal(response.Message)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
-}
-
-func (c *Config) DeleteMovieReview(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		UserID   int32 `json:"userId"`
-		ReviewID int32 `json:"reviewId"`
-	}
-
-	bodyBytes, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
-	}
-
-	err = json.Unmarshal(bodyBytes, &requestBody)
-
-	if err != nil {
-		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
-		return
-	}
-
-	// Extract the "id" parameter from the URL
-
-	id := chi.URLParam(r, "id")
-
-	if id == "" {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	idInt, err := strconv.Atoi(id)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "Invalid 'id' parameter in URL"}`, http.StatusBadRequest)
-		return
-	}
-
-	response, err := c.MovieDB_service.DeleteReview(context.Background(), &pb.ReviewRequest{
-		MovieID:  int32(idInt),
-		UserID:   requestBody.UserID,
-		ReviewID: requestBody.ReviewID,
-	})
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error deleting movie review: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	if response == nil || response.Review == nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
-		return
-	}
-
-	jsonResponse, err := json.Marshal(response.Review)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+type MovieTimeSlotsRequest struct {
+	StartDate string  `json:"startDate"`
+	EndDate   string  `json:"endDate"`
+	MovieID   uint    `json:"movieId"`
+	Longitude float32 `json:"longitude"`
+	Latitude  float32 `json:"latitude"`
 }
 
 func (c *Config) GetMovieTimeSlots(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		StartDate string  `json:"start_date"`
-		EndDate   string  `json:"end_date"`
-		MovieID   uint    `json:"movie_id"`
-		Longitude float32 `json:"longitude"`
-		Latitude  float32 `json:"latitude"`
-	}
+	var requestBody MovieTimeSlotsRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -892,7 +677,7 @@ func (c *Config) GetMovieTimeSlots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -944,7 +729,7 @@ func (c *Config) GetMovieTimeSlots(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -964,10 +749,12 @@ func (c *Config) GetMovieTimeSlots(w http.ResponseWriter, r *http.Request) {
 
 }
 
+type SeatMatrixRequest struct {
+	VenueID int32 `json:"venueId"`
+}
+
 func (c *Config) GetSeatMatrix(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		VenueID int32 `json:"venue_id"`
-	}
+	var requestBody SeatMatrixRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -977,7 +764,7 @@ func (c *Config) GetSeatMatrix(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1020,7 +807,7 @@ func (c *Config) GetSeatMatrix(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1040,7 +827,7 @@ func (c *Config) GetSeatMatrix(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *Config) BookSeats(w http.ResponseWriter, r *http.Request) {
-	var requestBody *pb.BookSeatsRequest
+	requestBody := &pb.BookSeatsRequest{}
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -1050,7 +837,7 @@ func (c *Config) BookSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1064,6 +851,119 @@ func (c *Config) BookSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// movieId, venueId and holdId are not part of BookSeatsRequest, they are
+	// only used by the broker. movieId keeps the booking history of the user
+	// and the booking velocity, venueId lays the seats out for the seat rules
+	// and holdId is the seat hold the seats are booked under.
+	var bookingMovie struct {
+		MovieID int32  `json:"movieId"`
+		VenueID int32  `json:"venueId"`
+		HoldID  string `json:"holdId"`
+	}
+
+	_ = utils.UnmarshalJSON(bodyBytes, &bookingMovie)
+
+	hold, err := c.seatHold(r.Context(), requestBody.MovieTimeSlotId, bookingMovie.HoldID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading seat hold: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// only the user holding the seats, or an admin, books them under the hold
+	if hold != nil {
+		user, ok := UserFromContext(r.Context())
+
+		if !ok || (hold.UserID != user.UserID && !user.IsAdmin()) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "The seat hold belongs to someone else"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	venueID := bookingMovie.VenueID
+
+	if venueID == 0 && hold != nil {
+		venueID = hold.VenueID
+	}
+
+	// without the venue the seats cannot be laid out and the seat rules could
+	// not be checked
+	if venueID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "venueId is required unless the seats are booked under a hold"}`, http.StatusBadRequest)
+		return
+	}
+
+	seats, err := c.showtimeSeatMap(r.Context(), requestBody.MovieTimeSlotId, venueID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if seats == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No seat matrix could be found for the venue"}`, http.StatusNotFound)
+		return
+	}
+
+	seatIDs := make([]int32, 0, len(requestBody.Seats))
+	var unknown []string
+
+	for _, seat := range requestBody.Seats {
+		if seat.GetSeatMatrixID() > 0 {
+			seatIDs = append(seatIDs, seat.GetSeatMatrixID())
+			continue
+		}
+
+		seatID, ok := seats.seatID(seat.GetSeatNumber())
+
+		if !ok {
+			unknown = append(unknown, seat.GetSeatNumber())
+			continue
+		}
+
+		seatIDs = append(seatIDs, seatID)
+	}
+
+	// a seat that is not resolved to its id would escape the hold and seat
+	// rule checks
+	if len(unknown) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Seats %s could not be found at venue %d"}`, strings.Join(unknown, ", "), venueID), http.StatusBadRequest)
+		return
+	}
+
+	seatIDs = distinctSeatIDs(seatIDs)
+
+	holders, err := c.seatHolders(r.Context(), requestBody.MovieTimeSlotId, seatIDs)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error checking seat holds: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	var held []int32
+
+	for _, seatID := range seatIDs {
+		if holdID, ok := holders[seatID]; ok && holdID != bookingMovie.HoldID {
+			held = append(held, seatID)
+		}
+	}
+
+	if len(held) > 0 {
+		writeJSON(w, http.StatusConflict, SeatHoldConflict{Error: "Some of the seats are held by someone else", SeatMatrixIDs: held})
+		return
+	}
+
+	if !c.checkSelection(w, r, seats, seatIDs) {
+		return
+	}
+
 	response, err := c.MovieDB_service.BookSeats(context.Background(), &pb.BookSeatsRequest{
 		Seats:           requestBody.Seats,
 		MovieTimeSlotId: requestBody.MovieTimeSlotId,
@@ -1089,7 +989,31 @@ func (c *Config) BookSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	seatNumbers := make([]string, 0, len(requestBody.Seats))
+
+	for _, seat := range requestBody.Seats {
+		seatNumbers = append(seatNumbers, seat.GetSeatNumber())
+	}
+
+	// the history is kept for the signed in user, the email of the request
+	// is only where MovieDB sends the booking to
+	var historyEmail string
+
+	if user, ok := UserFromContext(r.Context()); ok {
+		historyEmail = user.Email
+	}
+
+	if err := c.recordBooking(context.Background(), historyEmail, bookingMovie.MovieID, requestBody.MovieTimeSlotId, venueID, seatNumbers); err != nil {
+		log.Error("error recording booking history: ", err)
+	}
+
+	if hold != nil {
+		if err := c.releaseSeatHold(r.Context(), hold); err != nil {
+			log.Error("error releasing seat hold: ", err)
+		}
+	}
+
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1118,7 +1042,7 @@ func (c *Config) GetBookedSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1140,6 +1064,11 @@ func (c *Config) GetBookedSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// seats under a hold are listed as well, they are not booked yet
+	if response != nil {
+		response.BookedSeats = c.withHeldSeats(r.Context(), requestBody.MovieTimeSlotId, response.BookedSeats)
+	}
+
 	if response == nil || len(response.BookedSeats) == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		if response == nil {
@@ -1153,7 +1082,7 @@ func (c *Config) GetBookedSeats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1173,61 +1102,6 @@ func (c *Config) GetBookedSeats(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (c *Config) HandleWebhookEvents(w http.ResponseWriter, r *http.Request) {
-
-	var dummyResponse struct {
-		IsValid bool
-	}
-
-	var requestBody dodopayments.WebhookEvent
-
-	bodyBytes, err := io.ReadAll(r.Body)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"errors": "Error writing JSON response %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	err = json.Unmarshal(bodyBytes, &requestBody)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"errors": "Error unmarshaling json %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Println(requestBody)
-
-	// Need to call the create ticket function and book seats function
-	// Need to call the send mail producer to send mail to user
-
-	// switch requestBody.Type {
-	// case "payment.succeeded":
-	// 	// Commit seats and generate ticket for the customer
-	// 	fmt.Println("Payment succeeded")
-	// 	// response, err := c.MovieDB_service.BookSeats(context.Background(), &pb.BookSeatsRequest{})
-	// case "payment.failed":
-	// 	// re
-	// }
-
-	dummyResponse.IsValid = true
-
-	jsonResponse, err := json.Marshal(dummyResponse)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-	}
-	_, err = w.Write(jsonResponse)
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
-		return
-	}
-}
-
 func (c *Config) GetIdempotentKey(w http.ResponseWriter, r *http.Request) {
 
 	// Generate a new idempotent key
@@ -1238,10 +1112,10 @@ func (c *Config) GetIdempotentKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 
 	response := map[string]string{
-		"idempotent_key": idempotentKey,
+		"idempotentKey": idempotentKey,
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1258,11 +1132,13 @@ func (c *Config) GetIdempotentKey(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type IdempotentKeyRequest struct {
+	Key string `json:"key"`
+}
+
 func (c *Config) IsValidIdempotentKey(w http.ResponseWriter, r *http.Request) {
 
-	var requestBody struct {
-		Key string
-	}
+	var requestBody IdempotentKeyRequest
 
 	bodyBytes, err := io.ReadAll(r.Body)
 
@@ -1272,7 +1148,7 @@ func (c *Config) IsValidIdempotentKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1308,7 +1184,7 @@ func (c *Config) IsValidIdempotentKey(w http.ResponseWriter, r *http.Request) {
 
 	responseBody.IsValidKey = response.IsValid
 
-	jsonResponse, err := json.Marshal(responseBody)
+	jsonResponse, err := utils.MarshalJSON(responseBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1337,7 +1213,7 @@ func (c *Config) CommitIdempotentKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1371,7 +1247,7 @@ func (c *Config) CommitIdempotentKey(w http.ResponseWriter, r *http.Request) {
 		"message": "Idempotent key committed successfully",
 	}
 
-	jsonResponse, err := json.Marshal(responseBody)
+	jsonResponse, err := utils.MarshalJSON(responseBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1401,7 +1277,7 @@ func (c *Config) Create_Customer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1432,11 +1308,11 @@ func (c *Config) Create_Customer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	responseBody := map[string]string{
-		"message":     "Customer created successfully",
-		"customer_id": response.CustomerId,
+		"message":    "Customer created successfully",
+		"customerId": response.CustomerId,
 	}
 
-	jsonResponse, err := json.Marshal(responseBody)
+	jsonResponse, err := utils.MarshalJSON(responseBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1465,7 +1341,7 @@ func (c *Config) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1528,7 +1404,7 @@ func (c *Config) CreatePaymentLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal(bodyBytes, &requestBody)
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1559,7 +1435,7 @@ func (c *Config) CreatePaymentLink(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	jsonResponse, err := json.Marshal(response)
+	jsonResponse, err := utils.MarshalJSON(response)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,301 @@
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Auth is the authentication a route requires
+type Auth int
+
+const (
+	AuthNone Auth = iota
+	// AuthOptional routes personalise the response for a signed in user
+	AuthOptional
+	AuthRequired
+	AuthAdmin
+)
+
+// Route describes one route of the broker. Request is decoded from the JSON
+// body, or for GET and DELETE routes from the query string. Response is the
+// value the handler encodes with utils.MarshalJSON.
+type Route struct {
+	ID          string
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Auth        Auth
+	// PathParams overrides the type of path parameters by a sample value, by
+	// default id parameters are integers and the others strings
+	PathParams map[string]any
+	// Query lists the query parameters a handler reads itself
+	Query   []Param
+	Request any
+	// PathFields are the request fields filled from the path
+	PathFields []string
+	Response   any
+	// ContentType of the response, JSON when empty
+	ContentType string
+	// Conditional routes answer If-None-Match with 304 Not Modified
+	Conditional bool
+	// Aliases are the deprecated routes that serve the same handler
+	Aliases []Alias
+}
+
+// Alias is a deprecated route kept for older clients. Request overrides the
+// request of the route it belongs to.
+type Alias struct {
+	Method  string
+	Path    string
+	Request any
+}
+
+// Param is a query parameter, Example is a sample value of its type
+type Param struct {
+	Name        string
+	Description string
+	Example     any
+	Required    bool
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build generates the document describing routes
+func Build(info Info, tags []Tag, routes []Route) *Document {
+	s := newSchemas()
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Tags:    tags,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: s.components,
+			Responses: map[string]*Response{
+				"Error": {
+					Description: `The request failed. The body is plain text, most handlers send a JSON object such as {"error": "..."} in it.`,
+					Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+				},
+				"Unauthorized": {
+					Description: "The auth token is missing, invalid or expired.",
+					Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+				},
+				"Forbidden": {
+					Description: "The signed in user may not use this route.",
+					Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"tokenHeader": {
+					Type:        "apiKey",
+					Name:        "Authorization",
+					In:          "header",
+					Description: "The token returned by login or registration.",
+				},
+				"tokenCookie": {
+					Type:        "apiKey",
+					Name:        "auth_token",
+					In:          "cookie",
+					Description: "The cookie set by login or registration, used by browsers.",
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		addOperation(doc, route.Path, route.Method, s.operation(route, route.Method, route.Path, route.Request, false))
+
+		for i, alias := range route.Aliases {
+			request := route.Request
+
+			if alias.Request != nil {
+				request = alias.Request
+			}
+
+			operation := s.operation(route, alias.Method, alias.Path, request, true)
+
+			operation.OperationID = route.ID + "Legacy"
+
+			if len(route.Aliases) > 1 {
+				operation.OperationID += strconv.Itoa(i + 1)
+			}
+
+			addOperation(doc, alias.Path, alias.Method, operation)
+		}
+	}
+
+	return doc
+}
+
+func addOperation(doc *Document, path, method string, operation *Operation) {
+	item, ok := doc.Paths[path]
+
+	if !ok {
+		item = &PathItem{}
+		doc.Paths[path] = item
+	}
+
+	item.set(method, operation)
+}
+
+func (s *schemas) operation(route Route, method, path string, request any, deprecated bool) *Operation {
+	operation := &Operation{
+		OperationID: route.ID,
+		Summary:     route.Summary,
+		Description: route.Description,
+		Deprecated:  deprecated,
+		Responses:   map[string]*Response{},
+	}
+
+	if route.Tag != "" {
+		operation.Tags = []string{route.Tag}
+	}
+
+	pathParams := map[string]bool{}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		pathParams[name] = true
+
+		schema := &Schema{Type: "string"}
+
+		if sample, ok := route.PathParams[name]; ok {
+			schema = s.of(sample)
+		} else if name == "id" || strings.HasSuffix(name, "Id") {
+			schema = &Schema{Type: "integer", Format: "int32"}
+		}
+
+		operation.Parameters = append(operation.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+
+	for _, param := range route.Query {
+		// a legacy route may take the parameter in its path instead
+		if pathParams[param.Name] {
+			continue
+		}
+
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name:        param.Name,
+			In:          "query",
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      s.of(param.Example),
+		})
+	}
+
+	if request != nil {
+		if method == http.MethodGet || method == http.MethodDelete {
+			operation.Parameters = append(operation.Parameters, s.queryParameters(request, route.PathFields)...)
+		} else {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: s.of(request)}},
+			}
+		}
+	}
+
+	if route.Conditional {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name:        "If-None-Match",
+			In:          "header",
+			Description: "The ETag of a cached copy of the response.",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	success := &Response{Description: "OK"}
+
+	switch {
+	case route.ContentType != "":
+		success.Content = map[string]MediaType{route.ContentType: {Schema: &Schema{Type: "string"}}}
+	case route.Response != nil:
+		success.Content = map[string]MediaType{"application/json": {Schema: s.of(route.Response)}}
+	}
+
+	if route.Conditional {
+		success.Headers = map[string]Header{"ETag": {Schema: &Schema{Type: "string"}}}
+		operation.Responses["304"] = &Response{Description: "Not Modified, the cached copy is still current."}
+	}
+
+	if deprecated {
+		success.Headers = mergeHeaders(success.Headers, map[string]Header{
+			"Deprecation": {Description: "When the route was deprecated, as @<unix seconds>.", Schema: &Schema{Type: "string"}},
+			"Sunset":      {Description: "When the route will be removed.", Schema: &Schema{Type: "string"}},
+			"Link":        {Description: "The successor route, when it can be derived from the request url.", Schema: &Schema{Type: "string"}},
+		})
+	}
+
+	operation.Responses["200"] = success
+	operation.Responses["default"] = &Response{Ref: "#/components/responses/Error"}
+
+	switch route.Auth {
+	case AuthOptional:
+		operation.Security = []map[string][]string{{}, {"tokenHeader": {}}, {"tokenCookie": {}}}
+	case AuthRequired, AuthAdmin:
+		operation.Security = []map[string][]string{{"tokenHeader": {}}, {"tokenCookie": {}}}
+		operation.Responses["401"] = &Response{Ref: "#/components/responses/Unauthorized"}
+
+		if route.Auth == AuthAdmin {
+			operation.Responses["403"] = &Response{Ref: "#/components/responses/Forbidden"}
+		}
+	}
+
+	return operation
+}
+
+// queryParameters turns the top level fields of a request into query
+// parameters, the fields filled from the path are left out
+func (s *schemas) queryParameters(request any, pathFields []string) []Parameter {
+	schema := s.of(request)
+
+	if schema.Ref != "" {
+		schema = s.components[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+
+	skip := map[string]bool{}
+
+	for _, field := range pathFields {
+		skip[field] = true
+	}
+
+	required := map[string]bool{}
+
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+
+	for name := range schema.Properties {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	params := make([]Parameter, 0, len(names))
+
+	for _, name := range names {
+		params = append(params, Parameter{Name: name, In: "query", Required: required[name], Schema: schema.Properties[name]})
+	}
+
+	return params
+}
+
+func mergeHeaders(headers, more map[string]Header) map[string]Header {
+	if headers == nil {
+		headers = map[string]Header{}
+	}
+
+	for name, header := range more {
+		headers[name] = header
+	}
+
+	return headers
+}
@@ -0,0 +1,35 @@
+package openapi
+
+import (
+	"fmt"
+	"html"
+)
+
+// swaggerUIVersion pins the Swagger UI release the docs page loads
+const swaggerUIVersion = "5.17.14"
+
+// DocsPage returns a browsable page for the document served at specURL
+func DocsPage(title, specURL string) []byte {
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>%[1]s</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[3]s/swagger-ui.css">
+</head>
+<body>
+	<div id="docs"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@%[3]s/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.ui = SwaggerUIBundle({
+			url: %[2]q,
+			dom_id: "#docs",
+			deepLinking: true,
+			withCredentials: true,
+		});
+	</script>
+</body>
+</html>
+`, html.EscapeString(title), specURL, swaggerUIVersion))
+}
@@ -0,0 +1,363 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// Object describes an ad hoc JSON object, such as the map responses of the
+// auth handlers, by a sample value per property
+type Object map[string]any
+
+var (
+	protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	protoEnumType    = reflect.TypeOf((*protoreflect.Enum)(nil)).Elem()
+	timeType         = reflect.TypeOf(time.Time{})
+	enumValueType    = reflect.TypeOf(utils.EnumValue(""))
+	objectType       = reflect.TypeOf(Object{})
+)
+
+// schemas generates the component schemas of the request and response types.
+// Proto messages follow utils.MarshalJSON, so names are the proto JSON names,
+// enums are strings and 64 bit integers are strings. Go structs follow their
+// json tags and take constraints from their validate tags.
+type schemas struct {
+	components map[string]*Schema
+	// owners maps a component name to the type it was generated for, so that
+	// two types with the same short name get distinct components
+	owners map[string]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]*Schema{}, owners: map[string]string{}}
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// component registers the schema built by build under name, unless a schema
+// for owner is registered already
+func (s *schemas) component(name, owner string, build func() *Schema) *Schema {
+	if existing, ok := s.owners[name]; ok {
+		if existing == owner {
+			return ref(name)
+		}
+
+		name = strings.NewReplacer(".", "_", "/", "_").Replace(owner)
+
+		if _, ok := s.owners[name]; ok {
+			return ref(name)
+		}
+	}
+
+	s.owners[name] = owner
+	// a placeholder guards recursive types while they are being built
+	s.components[name] = &Schema{}
+	s.components[name] = build()
+
+	return ref(name)
+}
+
+// of returns the schema of v, a nil v has no schema
+func (s *schemas) of(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+
+	if object, ok := v.(Object); ok {
+		return s.object(object)
+	}
+
+	return s.ofType(reflect.TypeOf(v))
+}
+
+func (s *schemas) object(object Object) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for name, sample := range object {
+		schema.Properties[name] = s.of(sample)
+		schema.Required = append(schema.Required, name)
+	}
+
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func (s *schemas) ofType(t reflect.Type) *Schema {
+	if t.Implements(protoMessageType) {
+		message := reflect.Zero(t).Interface().(proto.Message)
+
+		return s.message(message.ProtoReflect().Descriptor())
+	}
+
+	if t.Kind() != reflect.Pointer && t.Implements(protoEnumType) {
+		enum := reflect.Zero(t).Interface().(protoreflect.Enum)
+
+		return s.enum(enum.Descriptor())
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case objectType:
+		return &Schema{Type: "object"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.ofType(t.Elem())
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: floatPtr(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: s.ofType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.ofType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+
+		return s.component(t.Name(), t.PkgPath()+"."+t.Name(), func() *Schema {
+			return s.structSchema(t)
+		})
+	}
+
+	return &Schema{}
+}
+
+func (s *schemas) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for _, field := range structFields(t) {
+		property := s.fieldSchema(field)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "" {
+			name = strings.ToLower(field.Name[:1]) + field.Name[1:]
+		}
+
+		schema.Properties[name] = property
+
+		if hasRule(field.Tag.Get("validate"), "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// structFields returns the encoded fields of t, embedded structs are flattened
+// the way utils.MarshalJSON flattens them
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(field.Type)...)
+			continue
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// fieldSchema returns the schema of a struct field with the constraints of its
+// validate tag. Fields of type utils.EnumValue name their proto enum in an
+// enum tag.
+func (s *schemas) fieldSchema(field reflect.StructField) *Schema {
+	if field.Type == enumValueType {
+		if name := field.Tag.Get("enum"); name != "" {
+			if enum, err := protoregistry.GlobalTypes.FindEnumByName(protoreflect.FullName(name)); err == nil {
+				return s.enum(enum.Descriptor())
+			}
+		}
+
+		return &Schema{Type: "string"}
+	}
+
+	schema := s.ofType(field.Type)
+
+	if schema.Ref != "" {
+		return schema
+	}
+
+	constrained := *schema
+
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if rule == "dive" {
+			break
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		number, numberErr := strconv.ParseFloat(param, 64)
+		size, sizeErr := strconv.Atoi(param)
+
+		switch {
+		case name == "email":
+			constrained.Format = "email"
+		case name == "oneof":
+			constrained.Enum = strings.Fields(param)
+		case constrained.Type == "string" && sizeErr == nil && name == "len":
+			constrained.MinLength = &size
+			constrained.MaxLength = &size
+		case constrained.Type == "string" && sizeErr == nil && name == "min":
+			constrained.MinLength = &size
+		case constrained.Type == "string" && sizeErr == nil && name == "max":
+			constrained.MaxLength = &size
+		case constrained.Type == "array" && sizeErr == nil && name == "min":
+			constrained.MinItems = &size
+		case constrained.Type == "array" && sizeErr == nil && name == "max":
+			constrained.MaxItems = &size
+		case numberErr == nil && (name == "min" || name == "gte"):
+			constrained.Minimum = &number
+		case numberErr == nil && name == "gt":
+			constrained.Minimum = &number
+			constrained.ExclusiveMinimum = true
+		case numberErr == nil && (name == "max" || name == "lte"):
+			constrained.Maximum = &number
+		}
+	}
+
+	return &constrained
+}
+
+func hasRule(validate, rule string) bool {
+	for _, candidate := range strings.Split(validate, ",") {
+		if candidate == "dive" {
+			return false
+		}
+
+		if candidate == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *schemas) enum(descriptor protoreflect.EnumDescriptor) *Schema {
+	return s.component(string(descriptor.Name()), string(descriptor.FullName()), func() *Schema {
+		schema := &Schema{Type: "string"}
+		values := descriptor.Values()
+
+		for i := 0; i < values.Len(); i++ {
+			schema.Enum = append(schema.Enum, string(values.Get(i).Name()))
+		}
+
+		return schema
+	})
+}
+
+func (s *schemas) message(descriptor protoreflect.MessageDescriptor) *Schema {
+	switch descriptor.FullName() {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string"}
+	case "google.protobuf.Empty":
+		return &Schema{Type: "object"}
+	}
+
+	return s.component(string(descriptor.Name()), string(descriptor.FullName()), func() *Schema {
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		fields := descriptor.Fields()
+
+		for i := 0; i < fields.Len(); i++ {
+			field := fields.Get(i)
+			schema.Properties[field.JSONName()] = s.protoField(field)
+		}
+
+		return schema
+	})
+}
+
+func (s *schemas) protoField(field protoreflect.FieldDescriptor) *Schema {
+	if field.IsMap() {
+		return &Schema{Type: "object", AdditionalProperties: s.protoValue(field.MapValue())}
+	}
+
+	value := s.protoValue(field)
+
+	if field.IsList() {
+		return &Schema{Type: "array", Items: value}
+	}
+
+	return value
+}
+
+func (s *schemas) protoValue(field protoreflect.FieldDescriptor) *Schema {
+	if utils.IsUnixTimestampField(field.FullName()) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return &Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &Schema{Type: "integer", Minimum: floatPtr(0)}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson sends 64 bit integers as strings
+		return &Schema{Type: "string", Format: "int64"}
+	case protoreflect.FloatKind:
+		return &Schema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &Schema{Type: "number", Format: "double"}
+	case protoreflect.StringKind:
+		return &Schema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &Schema{Type: "string", Format: "byte"}
+	case protoreflect.EnumKind:
+		return s.enum(field.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return s.message(field.Message())
+	}
+
+	return &Schema{}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/openapi"
+	ps "github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+)
+
+const apiTitle = "Booking broker service"
+
+var apiTags = []openapi.Tag{
+	{Name: "catalog", Description: "Movies, people, reviews and release dates."},
+	{Name: "showtimes", Description: "Showtimes, seat maps and availability."},
+	{Name: "bookings", Description: "Seat bookings and reviews written by users."},
+	{Name: "payments", Description: "Idempotency keys, customers, orders and payment links."},
+	{Name: "auth", Description: "Registration, login and one time passwords."},
+	{Name: "admin", Description: "Catalog management and review moderation, admins only."},
+	{Name: "meta", Description: "The API description, docs and GraphQL gateway."},
+}
+
+// Query parameters shared by several routes
+var (
+	limitParam     = openapi.Param{Name: "limit", Description: "The number of results to return.", Example: 0}
+	latitudeParam  = openapi.Param{Name: "latitude", Description: "Latitude of the user, between -90 and 90.", Example: 0.0}
+	longitudeParam = openapi.Param{Name: "longitude", Description: "Longitude of the user, between -180 and 180.", Example: 0.0}
+	languageParam  = openapi.Param{Name: "language", Description: "Only movies in these languages, comma separated or repeated.", Example: []string{}}
+	genreParam     = openapi.Param{Name: "genre", Description: "Only movies of these genres, comma separated or repeated.", Example: []string{}}
+	personParam    = openapi.Param{Name: "person", Description: "Only movies with this cast or crew member.", Example: ""}
+	roleParam      = openapi.Param{Name: "role", Description: "The role of person, a CastAndCrewType name.", Example: pb.CastAndCrewType(0)}
+	calendarParams = []openapi.Param{
+		{Name: "from", Description: "First release date, YYYY-MM-DD, defaults to today.", Example: ""},
+		{Name: "to", Description: "Last release date, YYYY-MM-DD.", Example: ""},
+		{Name: "group_by", Description: "week or month.", Example: ""},
+		{Name: "page", Example: 0},
+		{Name: "page_size", Example: 0},
+		languageParam,
+		genreParam,
+	}
+)
+
+var (
+	messageResponse = openapi.Object{"message": ""}
+	tokenResponse   = openapi.Object{"message": "", "token": ""}
+)
+
+// apiRoutes describes every route of Routes, a test fails when the two drift
+// apart
+func apiRoutes() []openapi.Route {
+	return []openapi.Route{
+		{ID: "getIndex", Method: "GET", Path: "/", Tag: "meta", Summary: "Welcome message", ContentType: "text/plain"},
+		{ID: "getOpenAPI", Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "This OpenAPI document", Response: openapi.Object{}, Conditional: true},
+		{ID: "getDocs", Method: "GET", Path: "/docs", Tag: "meta", Summary: "Browsable API docs", ContentType: "text/html", Conditional: true},
+		{ID: "queryGraphQL", Method: "GET", Path: "/graphql", Tag: "meta", Summary: "Run a GraphQL query",
+			Query: []openapi.Param{
+				{Name: "query", Example: "", Required: true},
+				{Name: "operationName", Example: ""},
+				{Name: "variables", Description: "The variables as a JSON object.", Example: ""},
+			},
+			Response: openapi.Object{"data": openapi.Object{}, "errors": []openapi.Object{}},
+		},
+		{ID: "postGraphQL", Method: "POST", Path: "/graphql", Tag: "meta", Summary: "Run a GraphQL query",
+			Request:  openapi.Object{"query": "", "operationName": "", "variables": openapi.Object{}},
+			Response: openapi.Object{"data": openapi.Object{}, "errors": []openapi.Object{}},
+		},
+
+		// Catalog
+		{ID: "getUpcomingMovies", Method: "GET", Path: "/v1/movies/upcoming", Tag: "catalog", Summary: "Movies releasing after a date",
+			Query:       []openapi.Param{{Name: "date", Description: "YYYY-MM-DD.", Example: "", Required: true}, personParam, roleParam},
+			Response:    []*pb.Movie{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getupcomingmovies/{date}"}},
+		},
+		{ID: "getNowPlayingMovies", Method: "GET", Path: "/v1/movies/now-playing", Tag: "catalog", Summary: "Movies showing near a location",
+			Query:       []openapi.Param{personParam, roleParam},
+			Request:     NowPlayingRequest{},
+			Response:    []*pb.Movie{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/getnowplayingmovies"}},
+		},
+		{ID: "searchMovies", Method: "GET", Path: "/v1/movies/search", Tag: "catalog", Summary: "Full text movie search",
+			Query:       []openapi.Param{{Name: "q", Example: "", Required: true}, languageParam, genreParam, limitParam},
+			Response:    []search.Result{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/searchMovies"}},
+		},
+		{ID: "autocompleteMovies", Method: "GET", Path: "/v1/movies/autocomplete", Tag: "catalog", Summary: "Title suggestions for a prefix",
+			Query:       []openapi.Param{{Name: "q", Example: "", Required: true}, limitParam},
+			Response:    openapi.Object{"suggestions": []string{}},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/autocompleteMovies"}},
+		},
+		{ID: "getTrendingMovies", Method: "GET", Path: "/v1/movies/trending", Tag: "catalog", Summary: "Movies ranked by recent bookings and reviews",
+			Query: []openapi.Param{
+				limitParam,
+				{Name: "city", Description: "Only venues whose address mentions the city.", Example: ""},
+				latitudeParam,
+				longitudeParam,
+				{Name: "radius_km", Description: "Radius around latitude and longitude.", Example: 0.0},
+			},
+			Response:    openapi.Object{"computedAt": time.Time{}, "movies": []TrendingMovie{}},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getTrendingMovies"}},
+		},
+		{ID: "getMovie", Method: "GET", Path: "/v1/movies/{id}", Tag: "catalog", Summary: "A movie",
+			Response:    &pb.Movie{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getMovie/{id}"}},
+		},
+		{ID: "getMovieReviews", Method: "GET", Path: "/v1/movies/{id}/reviews", Tag: "catalog", Summary: "A page of reviews of a movie",
+			Description: "Pages hold at most 50 reviews, 10 by default. Follow nextCursor and prevCursor to move between pages, a cursor keeps the order it was issued for. The helpful order ranks reviews by the votes of readers, then by their content. votes holds the tallies of the reviews of the page. offset, sortBy and filterBy are accepted from older clients, the POST alias answers with the reviewList shape they were written against. The helpful order is cached for a minute.",
+			Request:     MovieReviewsRequest{},
+			Response:    MovieReviewsPage{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/getAllMovieReview/{id}"}},
+		},
+		{ID: "getMovieReviewAggregates", Method: "GET", Path: "/v1/movies/{id}/reviews/aggregates", Tag: "catalog", Summary: "Rating histogram, reviews per month and top keywords of a movie",
+			Query:       []openapi.Param{{Name: "keywords", Description: "The number of keywords to return, at most 50, 10 by default.", Example: 0}},
+			Response:    ReviewAggregates{},
+			Conditional: true,
+		},
+		{ID: "getMovieShowtimes", Method: "GET", Path: "/v1/movies/{id}/showtimes", Tag: "showtimes", Summary: "Showtimes of a movie near a location",
+			Request:     MovieTimeSlotsRequest{},
+			PathFields:  []string{"movieId"},
+			Response:    &pb.GetMovieTimeSlotResponse{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/getMovieTimeSlots"}},
+		},
+		{ID: "getSimilarMovies", Method: "GET", Path: "/v1/movies/{id}/similar", Tag: "catalog", Summary: "Movies similar to a movie",
+			Description: "Results are tuned to the booking history of a signed in user, and movies showing near the given location rank higher.",
+			Auth:        openapi.AuthOptional,
+			Query:       []openapi.Param{limitParam, latitudeParam, longitudeParam},
+			Response:    []search.Result{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getSimilarMovies/{id}"}},
+		},
+		{ID: "getPerson", Method: "GET", Path: "/v1/people/{id}", Tag: "catalog", Summary: "A cast or crew member and their movies",
+			PathParams:  map[string]any{"id": ""},
+			Response:    search.Person{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getPerson/{id}"}},
+		},
+		{ID: "getReleasesCalendar", Method: "GET", Path: "/v1/releases", Tag: "catalog", Summary: "Upcoming releases grouped by week or month",
+			Query: calendarParams,
+			Response: openapi.Object{
+				"from": "", "to": "", "groupBy": "",
+				"page": 0, "pageSize": 0, "total": 0, "totalPages": 0,
+				"groups": []CalendarGroup{},
+			},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getReleasesCalendar"}},
+		},
+		{ID: "getReleasesCalendarICS", Method: "GET", Path: "/v1/releases.ics", Tag: "catalog", Summary: "Upcoming releases as an iCalendar feed",
+			Query:       calendarParams,
+			ContentType: "text/calendar",
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "GET", Path: "/getReleasesCalendar.ics"}},
+		},
+
+		// Showtimes and seats
+		{ID: "getBookedSeats", Method: "GET", Path: "/v1/showtimes/{id}/seats", Tag: "showtimes", Summary: "Seats already booked for a showtime",
+			Description: "Seats under a seat hold are listed as well, with isBooked left out.",
+			Request:     &pb.GetBookedSeatsRequest{},
+			PathFields:  []string{"movieTimeSlotId"},
+			Response:    &pb.GetBookedSeatsResponse{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/GetBookedSeats"}},
+		},
+		{ID: "getShowtimeAvailability", Method: "GET", Path: "/v1/showtimes/availability", Tag: "showtimes", Summary: "Seat availability of several showtimes",
+			Query: []openapi.Param{{
+				Name:        "showtime",
+				Description: "movieTimeSlotId:venueId pairs, comma separated or repeated.",
+				Example:     []string{},
+				Required:    true,
+			}},
+			Response:    []ShowtimeAvailability{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/getShowtimeAvailability", Request: ShowtimeAvailabilityRequest{}}},
+		},
+		{ID: "holdSeats", Method: "POST", Path: "/v1/showtimes/{id}/holds", Tag: "showtimes", Summary: "Hold seats of a showtime",
+			Description: "The seats are held for the signed in user, all of them or none. Seats booked or held by someone else are answered with 409 Conflict and listed. A selection that would leave a single empty seat between taken seats is answered with 400 Bad Request unless the venue allows it, seats next to an aisle or a missing cell of the seat matrix are exempt. A hold expires after 10 minutes unless it is extended.",
+			Auth:        openapi.AuthRequired,
+			Request:     SeatHoldRequest{},
+			Response:    SeatHold{},
+		},
+		{ID: "holdBestSeats", Method: "POST", Path: "/v1/showtimes/{id}/best-seats", Tag: "showtimes", Summary: "Hold the best available seats for a party",
+			Description: "Picks count seats of the seat type and within maxPrice out of the seats that are neither booked nor held, and holds them for the signed in user right away. Seats next to each other in one row are preferred, then seats in the middle of a row and rows a little over half way back from the screen. together is false when no row had room for the whole party. When not enough seats match the answer is 409 Conflict.",
+			Auth:        openapi.AuthRequired,
+			Request:     BestSeatsRequest{},
+			Response:    BestSeatsHold{},
+		},
+		{ID: "getSeatHold", Method: "GET", Path: "/v1/showtimes/{id}/holds/{holdId}", Tag: "showtimes", Summary: "A seat hold",
+			Auth:       openapi.AuthRequired,
+			PathParams: map[string]any{"holdId": ""},
+			Response:   SeatHold{},
+		},
+		{ID: "extendSeatHold", Method: "POST", Path: "/v1/showtimes/{id}/holds/{holdId}/extend", Tag: "showtimes", Summary: "Extend a seat hold",
+			Description: "The hold lasts another 10 minutes, a hold lasts at most 30 minutes and extending it past that is answered with 409 Conflict.",
+			Auth:        openapi.AuthRequired,
+			PathParams:  map[string]any{"holdId": ""},
+			Response:    SeatHold{},
+		},
+		{ID: "releaseSeatHold", Method: "DELETE", Path: "/v1/showtimes/{id}/holds/{holdId}", Tag: "showtimes", Summary: "Release a seat hold",
+			Auth:       openapi.AuthRequired,
+			PathParams: map[string]any{"holdId": ""},
+		},
+		{ID: "getSeatMatrix", Method: "GET", Path: "/v1/venues/{id}/seats", Tag: "showtimes", Summary: "The seat map of a venue",
+			Request:     SeatMatrixRequest{},
+			PathFields:  []string{"venueId"},
+			Response:    &pb.GetSeatMatrixResponse{},
+			Conditional: true,
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/GetSeatMatrix"}},
+		},
+
+		// Bookings and reviews
+		{ID: "addMovieReview", Method: "POST", Path: "/v1/movies/{id}/reviews", Tag: "bookings", Summary: "Review a movie",
+			Description: "The review is posted as the signed in user. A user reviews a movie once, a second review is answered with 409 Conflict. A review flagged by moderation is held for an admin and answered with 202 Accepted and the held review. Authors who booked a showing of the movie through the broker are verified viewers, movies may take reviews of verified viewers only and answer others with 403 Forbidden.",
+			Auth:        openapi.AuthRequired,
+			Request:     AddReviewRequest{},
+			Response:    &pb.ReviewResponse{},
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/addReview/{id}"}},
+		},
+		{ID: "updateMovieReview", Method: "PUT", Path: "/v1/movies/{id}/reviews/{reviewId}", Tag: "bookings", Summary: "Edit a review",
+			Description: "Only the author of the review or an admin may edit it. Fields left out keep their value. An edit flagged by moderation is held for an admin and answered with 202 Accepted.",
+			Auth:        openapi.AuthRequired,
+			Request:     UpdateReviewRequest{},
+			Response:    &pb.ReviewResponse{},
+		},
+		{ID: "deleteMovieReview", Method: "DELETE", Path: "/v1/movies/{id}/reviews/{reviewId}", Tag: "bookings", Summary: "Delete a review",
+			Description: "Only the author of the review or an admin may delete it.",
+			Auth:        openapi.AuthRequired,
+			Response:    &pb.ReviewResponse{},
+		},
+		{ID: "voteOnReview", Method: "PUT", Path: "/v1/movies/{id}/reviews/{reviewId}/vote", Tag: "bookings", Summary: "Vote a review helpful or unhelpful",
+			Description: "A user has one vote per review, voting again replaces it. Authors may not vote on their own review.",
+			Auth:        openapi.AuthRequired,
+			Request:     ReviewVoteRequest{},
+			Response:    ReviewVotes{},
+		},
+		{ID: "retractReviewVote", Method: "DELETE", Path: "/v1/movies/{id}/reviews/{reviewId}/vote", Tag: "bookings", Summary: "Take back a vote on a review",
+			Auth:     openapi.AuthRequired,
+			Response: ReviewVotes{},
+		},
+		{ID: "bookSeats", Method: "POST", Path: "/v1/bookings", Tag: "bookings", Summary: "Book seats for a showtime",
+			Description: "Seats held by a seat hold are answered with 409 Conflict unless the holdId of the hold is sent with the seats by the signed in user holding them, the hold is released once the seats are booked. The venueId of the showtime is required unless the seats are booked under a hold, the seats are checked against the seat rules of the venue. Seats are found by their seatMatrixID or their seatNumber, seats that cannot be found are answered with 400 Bad Request. Bookings of a signed in user are kept in their booking history when the venue shows the movieId sent with the seats.",
+			Auth:        openapi.AuthOptional,
+			Request:     &pb.BookSeatsRequest{},
+			Response:    &pb.BookSeatsResponse{},
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/BookSeats"}},
+		},
+
+		// Payments
+		{ID: "handlePaymentWebhook", Method: "POST", Path: "/v1/webhooks/payments", Tag: "payments", Summary: "Payment provider webhook",
+			Description: "payment.succeeded books the seats of the checkout of the payment, found by the idempotentKey or orderId in the metadata of the payment, confirms the checkout and emails the ticket, naming the movie and the start of the showing given by the date and startTime of the checkout. payment.failed and payment.cancelled fail the checkout and release its seat hold, and email a link to retry with the same seats when they are still free. A webhook delivered again only does what is left. The Standard Webhooks signature is checked, a webhook that is not signed is answered with 401 Unauthorized and every webhook with 503 Service Unavailable while no secret is configured. An error is answered with a status other than 200 so the webhook is delivered again.",
+			Request:     map[string]any{},
+			Response:    openapi.Object{"isValid": true},
+			Aliases:     []openapi.Alias{{Method: "POST", Path: "/webhook/events"}},
+		},
+		{ID: "createIdempotentKey", Method: "POST", Path: "/v1/idempotency-keys", Tag: "payments", Summary: "A new idempotency key for a checkout",
+			Response: openapi.Object{"idempotentKey": ""},
+			Aliases:  []openapi.Alias{{Method: "GET", Path: "/getIdempotentKey"}},
+		},
+		{ID: "getIdempotentKey", Method: "GET", Path: "/v1/idempotency-keys/{key}", Tag: "payments", Summary: "Whether an idempotency key can still be used",
+			Request:    IdempotentKeyRequest{},
+			PathFields: []string{"key"},
+			Response:   openapi.Object{"isValidKey": true},
+			Aliases:    []openapi.Alias{{Method: "GET", Path: "/isValidIdempotentKey"}},
+		},
+		{ID: "commitIdempotentKey", Method: "POST", Path: "/v1/idempotency-keys/{key}/commit", Tag: "payments", Summary: "Commit an idempotency key",
+			Request:  &ps.CommitIdempotentKeyRequest{},
+			Response: messageResponse,
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/commitIdempotentKey"}},
+		},
+		{ID: "createCustomer", Method: "POST", Path: "/v1/customers", Tag: "payments", Summary: "Create a payment customer",
+			Request:  &ps.CreateCustomerRequest{},
+			Response: openapi.Object{"message": "", "customerId": ""},
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/createCustomer"}},
+		},
+		{ID: "createOrder", Method: "POST", Path: "/v1/orders", Tag: "payments", Summary: "Create an order",
+			Request: &ps.Create_Order_Request{},
+			Aliases: []openapi.Alias{{Method: "POST", Path: "/createOrder"}},
+		},
+		{ID: "createPaymentLink", Method: "POST", Path: "/v1/payment-links", Tag: "payments", Summary: "Create a payment link for an order",
+			Request:  &ps.CreatePaymentLinkRequest{},
+			Response: &ps.CreatePaymentLinkResponse{},
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/createPaymentLink"}},
+		},
+		{ID: "checkout", Method: "POST", Path: "/v1/checkouts", Tag: "payments", Summary: "Check out the seats of a seat hold",
+			Description: "Creates the customer and the order, commits them under the idempotency key and makes the payment link in one call. The idempotency key is sent in the body or the Idempotency-Key header and made up when left out. Retrying with the same key resumes the checkout, steps that went through are not run again. The answer is 200 once the payment link is ready, 503 Service Unavailable when a step may go through on a retry and 409 Conflict when a step failed for good, the seat hold is released then. A step is tried at most 3 times. A checkout whose payment is not made by its paymentDueAt, when its seat hold expires, fails and its seat hold is released.",
+			Auth:        openapi.AuthRequired,
+			Request:     CheckoutRequest{},
+			Response:    Checkout{},
+		},
+		{ID: "getCheckout", Method: "GET", Path: "/v1/checkouts/{key}", Tag: "payments", Summary: "The state of a checkout",
+			Auth:       openapi.AuthRequired,
+			PathParams: map[string]any{"key": ""},
+			Response:   Checkout{},
+		},
+
+		// Auth
+		{ID: "validateToken", Method: "GET", Path: "/v1/auth/token", Tag: "auth", Summary: "Check an auth token",
+			Auth:     openapi.AuthRequired,
+			Response: messageResponse,
+			Aliases:  []openapi.Alias{{Method: "GET", Path: "/validateToken"}},
+		},
+		{ID: "generateOTP", Method: "POST", Path: "/v1/auth/otp", Tag: "auth", Summary: "Email a one time password",
+			Request:  OTPRequest{},
+			Response: messageResponse,
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/generateOTP"}},
+		},
+		{ID: "validateOTP", Method: "POST", Path: "/v1/auth/otp/verify", Tag: "auth", Summary: "Check a one time password",
+			Request:  ValidateOTPRequest{},
+			Response: messageResponse,
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/validateOTP"}},
+		},
+		{ID: "login", Method: "POST", Path: "/v1/auth/login", Tag: "auth", Summary: "Log in and receive an auth token",
+			Request:  LoginRequest{},
+			Response: tokenResponse,
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/loginUser"}},
+		},
+		{ID: "registerUser", Method: "POST", Path: "/v1/users", Tag: "auth", Summary: "Register a user",
+			Request:  RegisterUserRequest{},
+			Response: tokenResponse,
+			Aliases:  []openapi.Alias{{Method: "POST", Path: "/registerUser"}},
+		},
+		{ID: "checkIfUserExists", Method: "GET", Path: "/v1/users/{email}/exists", Tag: "auth", Summary: "Whether an email is registered",
+			Response: &at.CheckUserExistsResponse{},
+			Aliases:  []openapi.Alias{{Method: "GET", Path: "/checkIfUserExists/{email}"}},
+		},
+	}
+}
+
+// adminAPIRoutes describes the routes of adminRoutes, mounted under prefix
+func adminAPIRoutes() []openapi.Route {
+	routes := []openapi.Route{
+		{ID: "adminAddMovie", Method: "POST", Path: "/movie", Summary: "Add a movie", Request: &pb.Movie{}, Response: &pb.MovieResponse{}},
+		{ID: "adminUpdateMovie", Method: "PUT", Path: "/movie", Summary: "Update a movie", Request: &pb.Movie{}, Response: &pb.MovieResponse{}},
+		{ID: "adminDeleteMovie", Method: "DELETE", Path: "/movie/{id}", Summary: "Delete a movie", Response: &pb.MovieResponse{}},
+		{ID: "adminAddVenue", Method: "POST", Path: "/venue", Summary: "Add a venue", Request: &pb.Venue{}, Response: &pb.VenueResponse{}},
+		{ID: "adminUpdateVenue", Method: "PUT", Path: "/venue", Summary: "Update a venue", Request: &pb.Venue{}, Response: &pb.VenueResponse{}},
+		{ID: "adminDeleteVenue", Method: "DELETE", Path: "/venue/{id}", Summary: "Delete a venue", Response: &pb.MovieResponse{}},
+		{ID: "adminAddMovieTimeSlot", Method: "POST", Path: "/movieTimeSlot", Summary: "Add a showtime", Request: &pb.MovieTimeSlot{}, Response: &pb.MovieTimeSlotResponse{}},
+		{ID: "adminUpdateMovieTimeSlot", Method: "PUT", Path: "/movieTimeSlot", Summary: "Update a showtime", Request: &pb.MovieTimeSlotUpdate{}, Response: &pb.MovieTimeSlotUpdateResponse{}},
+		{ID: "adminDeleteMovieTimeSlot", Method: "DELETE", Path: "/movieTimeSlot/{id}", Summary: "Delete a showtime", Response: &pb.MovieTimeSlotResponse{}},
+		{ID: "adminAddSeatMatrix", Method: "POST", Path: "/seatMatrix", Summary: "Add the seat map of a venue", Request: &pb.AddSeatMatrixInput{}, Response: &pb.AddSeatMatrixResponse{}},
+		{ID: "adminUpdateSeatMatrix", Method: "PUT", Path: "/seatMatrix", Summary: "Update seats of a venue", Request: &pb.UpdateSeatMatrixRequest{}, Response: &pb.UpdateSeatMatrixResponse{}},
+		{ID: "adminDeleteSeatMatrix", Method: "DELETE", Path: "/seatMatrix/{venueId}", Summary: "Delete the seat map of a venue", Response: &pb.DeleteSeatMatrixResponse{}},
+		{ID: "adminDeleteSeat", Method: "DELETE", Path: "/seatMatrix/{venueId}/{seatId}", Summary: "Delete a seat of a venue", Response: &pb.DeleteSeatMatrixResponse{}},
+		{ID: "adminMetrics", Method: "GET", Path: "/metrics", Summary: "Process and MovieDB coalescing metrics", Response: map[string]any{}},
+		{ID: "adminListRefundsOwed", Method: "GET", Path: "/checkouts/refunds-owed", Summary: "Checkouts paid for whose seats could not be booked, oldest first", Query: []openapi.Param{limitParam}, Response: RefundsOwedList{}},
+		{ID: "adminMarkRefunded", Method: "POST", Path: "/checkouts/{key}/refunded", Summary: "Record that the payment of a checkout was refunded", PathParams: map[string]any{"key": ""}, Response: Checkout{}},
+		{ID: "adminListPendingReviews", Method: "GET", Path: "/reviews/pending", Summary: "Reviews held for moderation, oldest first", Query: []openapi.Param{limitParam}, Response: PendingReviewList{}},
+		{ID: "adminApprovePendingReview", Method: "POST", Path: "/reviews/pending/{id}/approve", Summary: "Publish a held review or apply a held edit", Response: ModerationRecord{}},
+		{ID: "adminRejectPendingReview", Method: "POST", Path: "/reviews/pending/{id}/reject", Summary: "Drop a held review", Request: RejectReviewRequest{}, Response: ModerationRecord{}},
+		{ID: "adminGetModerationLog", Method: "GET", Path: "/reviews/moderation-log", Summary: "Latest moderation outcomes, newest first", Query: []openapi.Param{limitParam}, Response: []ModerationRecord{}},
+		{ID: "adminGetReviewSettings", Method: "GET", Path: "/movie/{id}/review-settings", Summary: "Review settings of a movie", Response: ReviewSettings{}},
+		{ID: "adminUpdateReviewSettings", Method: "PUT", Path: "/movie/{id}/review-settings", Summary: "Let only verified viewers review a movie", Request: ReviewSettings{}, Response: ReviewSettings{}},
+		{ID: "adminGetSeatRules", Method: "GET", Path: "/venue/{id}/seat-rules", Summary: "Seat selection rules of a venue", Response: SeatRules{}},
+		{ID: "adminUpdateSeatRules", Method: "PUT", Path: "/venue/{id}/seat-rules", Summary: "Set the aisles of a venue and whether orphan seats are allowed", Request: SeatRules{}, Response: SeatRules{}},
+	}
+
+	for i := range routes {
+		routes[i].Tag = "admin"
+		routes[i].Auth = openapi.AuthAdmin
+		routes[i].Aliases = []openapi.Alias{{Method: routes[i].Method, Path: "/admin" + routes[i].Path}}
+		routes[i].Path = "/v1/admin" + routes[i].Path
+	}
+
+	return routes
+}
+
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument *openapi.Document
+	openAPIJSON     []byte
+)
+
+// OpenAPI returns the OpenAPI document of the broker
+func OpenAPI() *openapi.Document {
+	openAPIOnce.Do(func() {
+		openAPIDocument = openapi.Build(openapi.Info{
+			Title:   apiTitle,
+			Version: "1.0.0",
+			Description: "The HTTP API in front of the MovieDB, payment and auth services. " +
+				"Responses follow the protojson contract: camelCase names, enums as strings, " +
+				"64 bit integers as strings and timestamps as RFC 3339. Routes outside /v1 are " +
+				"deprecated aliases and send Deprecation and Sunset headers.",
+		}, apiTags, append(apiRoutes(), adminAPIRoutes()...))
+
+		openAPIJSON, _ = json.Marshal(openAPIDocument)
+	})
+
+	return openAPIDocument
+}
+
+func (c *Config) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	OpenAPI()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIJSON)
+}
+
+func (c *Config) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.DocsPage(apiTitle, "/openapi.json"))
+}
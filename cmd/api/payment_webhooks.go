@@ -0,0 +1,471 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dodopayments "github.com/dodopayments/dodopayments-go"
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// Payment webhooks confirm checkouts. A payment.succeeded webhook books the
+// seats of the checkout the payment belongs to, confirms the checkout and sends
+// the ticket. The booking and the ticket are kept on the checkout, a webhook
+// delivered again only does what is left. Payments that fail or are cancelled
+// abandon the checkout, see abandoned_checkouts.go.
+
+const (
+	paymentSucceeded = "payment.succeeded"
+
+	// paymentWebhookTolerance bounds how far the timestamp of a signed webhook
+	// may be off
+	paymentWebhookTolerance = 5 * time.Minute
+)
+
+// errCheckoutLocked is returned when another run holds the lock of a checkout
+var errCheckoutLocked = errors.New("the checkout is already running")
+
+// PaymentWebhook is the body of a webhook of the payment provider
+type PaymentWebhook struct {
+	BusinessID string               `json:"business_id"`
+	Type       string               `json:"type"`
+	Timestamp  time.Time            `json:"timestamp"`
+	Data       dodopayments.Payment `json:"data"`
+}
+
+type PaymentWebhookResponse struct {
+	IsValid bool `json:"isValid"`
+}
+
+func (c *Config) sendMail(mail utils.SendMailStruct) error {
+	if c.Mailer != nil {
+		return c.Mailer(mail)
+	}
+
+	return utils.SendMail(mail)
+}
+
+// verifyPaymentWebhook checks the Standard Webhooks signature of a webhook.
+// The secret may carry the whsec_ prefix, the signature header may list
+// several signatures while the secret is rotated.
+func verifyPaymentWebhook(secret string, header http.Header, body []byte, now time.Time) error {
+	id := header.Get("webhook-id")
+	timestamp := header.Get("webhook-timestamp")
+	signatures := header.Get("webhook-signature")
+
+	if id == "" || timestamp == "" || signatures == "" {
+		return errors.New("the webhook is not signed")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp %q", timestamp)
+	}
+
+	if sent := time.Unix(seconds, 0); sent.Before(now.Add(-paymentWebhookTolerance)) || sent.After(now.Add(paymentWebhookTolerance)) {
+		return errors.New("the webhook timestamp is too far off")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+
+	if err != nil {
+		return fmt.Errorf("invalid webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, signature := range strings.Fields(signatures) {
+		version, value, ok := strings.Cut(signature, ",")
+
+		if !ok || version != "v1" {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(value)
+
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return errors.New("the webhook signature does not match")
+}
+
+// checkoutKeyOfPayment finds the idempotency key of the checkout a payment
+// belongs to from the metadata of the payment, by the key itself or by the
+// order. It returns "" when the payment belongs to no checkout.
+func (c *Config) checkoutKeyOfPayment(ctx context.Context, payment *dodopayments.Payment) (string, error) {
+	for _, name := range []string{"idempotentKey", "idempotent_key"} {
+		if key := payment.Metadata[name]; key != "" {
+			return key, nil
+		}
+	}
+
+	for _, name := range []string{"orderId", "order_id"} {
+		orderID := payment.Metadata[name]
+
+		if orderID == "" {
+			continue
+		}
+
+		key, err := c.RedisClient.Get(ctx, checkoutOrderKey(orderID)).Result()
+
+		if err == redis.Nil {
+			continue
+		}
+
+		return key, err
+	}
+
+	return "", nil
+}
+
+// bookCheckout books the seats of a checkout that was paid for. It returns the
+// reason when the seats cannot be booked, and an error when booking may go
+// through when the webhook is delivered again.
+func (c *Config) bookCheckout(ctx context.Context, checkout *Checkout) (string, error) {
+	hold, err := c.seatHold(ctx, checkout.MovieTimeSlotID, checkout.HoldID)
+
+	if err != nil {
+		return "", err
+	}
+
+	holders, err := c.seatHolders(ctx, checkout.MovieTimeSlotID, checkout.SeatMatrixIDs)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, holdID := range holders {
+		if holdID != checkout.HoldID {
+			return "Some of the seats were held by someone else after the seat hold expired", nil
+		}
+	}
+
+	seats, err := c.showtimeSeatMap(ctx, checkout.MovieTimeSlotID, checkout.VenueID)
+
+	if err != nil {
+		return "", err
+	}
+
+	request := &pb.BookSeatsRequest{
+		MovieTimeSlotId: checkout.MovieTimeSlotID,
+		Email:           checkout.Customer.Email,
+	}
+
+	request.PhoneNumber, _ = strconv.ParseInt(checkout.Customer.PhoneNumber, 10, 64)
+
+	booked := 0
+
+	for _, seatID := range checkout.SeatMatrixIDs {
+		seat := &pb.BookedSeats{SeatMatrixID: seatID, MovieTimeSlotID: checkout.MovieTimeSlotID, IsBooked: true}
+
+		if seats != nil {
+			if matrix, ok := seats.seats[seatID]; ok {
+				seat.SeatNumber = matrix.SeatNumber
+			}
+
+			if seats.booked[seatID] {
+				booked++
+			}
+		}
+
+		request.Seats = append(request.Seats, seat)
+	}
+
+	// while the seats are still held for the checkout nobody else can book
+	// them, they were booked by an earlier delivery that went through before
+	// the checkout was saved
+	if booked > 0 {
+		if booked == len(checkout.SeatMatrixIDs) && hold != nil {
+			return "", nil
+		}
+
+		return "Some of the seats were booked by someone else after the seat hold expired", nil
+	}
+
+	response, err := c.MovieDB_service.BookSeats(ctx, request)
+
+	if err != nil {
+		return "", err
+	}
+
+	if response.GetStatus() != http.StatusOK {
+		return fmt.Sprintf("The seats could not be booked: %s", response.GetMessage()), nil
+	}
+
+	checkout.BookingIDs = response.GetBookSeatsId()
+
+	seatNumbers := make([]string, 0, len(request.Seats))
+
+	for _, seat := range request.Seats {
+		if seat.SeatNumber != "" {
+			seatNumbers = append(seatNumbers, seat.SeatNumber)
+		}
+	}
+
+	if err := c.recordBooking(ctx, checkout.UserEmail, checkout.MovieID, checkout.MovieTimeSlotID, checkout.VenueID, seatNumbers); err != nil {
+		log.Error("error recording booking history: ", err)
+	}
+
+	return "", nil
+}
+
+// seatNumbersOf names seats by their seat number, or by their id when the seat
+// map does not know it
+func seatNumbersOf(seats *seatMap, seatIDs []int32) []string {
+	seatNumbers := make([]string, 0, len(seatIDs))
+
+	for _, seatID := range seatIDs {
+		if seats != nil && seats.seats[seatID] != nil && seats.seats[seatID].SeatNumber != "" {
+			seatNumbers = append(seatNumbers, seats.seats[seatID].SeatNumber)
+		} else {
+			seatNumbers = append(seatNumbers, strconv.Itoa(int(seatID)))
+		}
+	}
+
+	return seatNumbers
+}
+
+// ticketShowing returns the title of the movie of a checkout and when its
+// showing starts, empty when MovieDB cannot tell. MovieDB does not give time
+// slots an id, the showing is the time slot of the movie at the venue with the
+// date and start time of the checkout, or the only one the venue has.
+func (c *Config) ticketShowing(ctx context.Context, checkout *Checkout) (string, string) {
+	if checkout.MovieID <= 0 {
+		return "", ""
+	}
+
+	response, err := c.MovieDB_service.GetMovie(ctx, &pb.MovieRequest{
+		Movieid: strconv.Itoa(int(checkout.MovieID)),
+	})
+
+	if err != nil {
+		log.Error("error reading the movie of a ticket: ", err)
+		return "", ""
+	}
+
+	movie := response.GetMovie()
+
+	var slots []*pb.MovieTimeSlot
+
+	for _, venue := range movie.GetVenues() {
+		if venue.Id != checkout.VenueID {
+			continue
+		}
+
+		for _, slot := range venue.MovieTimeSlots {
+			if slot.Movieid != checkout.MovieID {
+				continue
+			}
+
+			if checkout.StartTime != "" && slot.StartTime == checkout.StartTime && (checkout.Date == "" || slot.Date == checkout.Date) {
+				return movie.GetTitle(), strings.TrimSpace(slot.Date + " " + slot.StartTime)
+			}
+
+			slots = append(slots, slot)
+		}
+	}
+
+	if len(slots) == 1 {
+		return movie.GetTitle(), strings.TrimSpace(slots[0].Date + " " + slots[0].StartTime)
+	}
+
+	return movie.GetTitle(), ""
+}
+
+// sendTicket sends the ticket of a confirmed checkout
+func (c *Config) sendTicket(ctx context.Context, checkout *Checkout) error {
+	seats, err := c.showtimeSeatMap(ctx, checkout.MovieTimeSlotID, checkout.VenueID)
+
+	if err != nil {
+		return err
+	}
+
+	seatNumbers := seatNumbersOf(seats, checkout.SeatMatrixIDs)
+	title, startsAt := c.ticketShowing(ctx, checkout)
+
+	return c.sendMail(utils.SendTicketMailTemplate(checkout.Customer.Email, checkout.Customer.CustomerName, checkout.IdempotentKey, title, startsAt, checkout.MovieTimeSlotID, seatNumbers))
+}
+
+// confirmCheckout books the seats of a checkout that was paid for and sends
+// the ticket, each at most once. A checkout whose seats cannot be booked owes
+// a refund, see refunds.go.
+func (c *Config) confirmCheckout(ctx context.Context, checkout *Checkout, paymentID string) error {
+	// the seats of a paid checkout could not be booked before
+	if checkout.Status == checkoutFailed && checkout.PaymentID != "" {
+		return c.noticeRefund(ctx, checkout)
+	}
+
+	if checkout.Status != checkoutConfirmed {
+		reason, err := c.bookCheckout(ctx, checkout)
+
+		if err != nil {
+			return err
+		}
+
+		checkout.PaymentID = paymentID
+
+		if reason != "" {
+			log.Errorf("payment %s of checkout %s went through but the seats were not booked: %s", paymentID, checkout.IdempotentKey, reason)
+			c.failCheckout(ctx, checkout, reason)
+			checkout.RefundOwed = true
+
+			if err := c.saveCheckout(ctx, checkout); err != nil {
+				return err
+			}
+
+			return c.noticeRefund(ctx, checkout)
+		}
+
+		now := time.Now().UTC()
+		checkout.Status = checkoutConfirmed
+		checkout.ConfirmedAt = &now
+
+		if err := c.saveCheckout(ctx, checkout); err != nil {
+			return err
+		}
+
+		if hold, err := c.seatHold(ctx, checkout.MovieTimeSlotID, checkout.HoldID); err == nil && hold != nil {
+			if err := c.releaseSeatHold(ctx, hold); err != nil {
+				log.Error("error releasing seat hold of checkout: ", err)
+			}
+		}
+	}
+
+	if checkout.TicketSentAt != nil {
+		return nil
+	}
+
+	if err := c.sendTicket(ctx, checkout); err != nil {
+		return fmt.Errorf("error sending ticket: %w", err)
+	}
+
+	now := time.Now().UTC()
+	checkout.TicketSentAt = &now
+
+	return c.saveCheckout(ctx, checkout)
+}
+
+// handlePaymentSucceeded confirms the checkout of a payment that went through
+func (c *Config) handlePaymentSucceeded(ctx context.Context, payment *dodopayments.Payment) error {
+	key, err := c.checkoutKeyOfPayment(ctx, payment)
+
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		log.Warnf("payment %s belongs to no checkout", payment.PaymentID)
+		return nil
+	}
+
+	unlock, locked, err := c.lockCheckout(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return errCheckoutLocked
+	}
+
+	defer unlock()
+
+	checkout, err := c.checkout(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if checkout == nil {
+		log.Warnf("payment %s belongs to checkout %s which is gone", payment.PaymentID, key)
+		return nil
+	}
+
+	return c.confirmCheckout(ctx, checkout, payment.PaymentID)
+}
+
+// HandleWebhookEvents handles the webhooks of the payment provider. An error
+// is answered with a status other than 200 so the provider delivers the
+// webhook again.
+func (c *Config) HandleWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	var requestBody PaymentWebhook
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Error reading request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	// webhooks book seats, without a secret to verify them none is taken
+	if c.PaymentWebhookSecret == "" {
+		log.Error("payment webhook refused, no webhook secret is configured")
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Payment webhooks are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := verifyPaymentWebhook(c.PaymentWebhookSecret, r.Header, bodyBytes, time.Now()); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusUnauthorized)
+		return
+	}
+
+	if err := json.Unmarshal(bodyBytes, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error unmarshaling json %v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if c.RedisClient == nil {
+		log.Warnf("payment webhook %s ignored, checkouts are not configured", requestBody.Type)
+		writeJSON(w, http.StatusOK, PaymentWebhookResponse{IsValid: true})
+		return
+	}
+
+	switch requestBody.Type {
+	case paymentSucceeded:
+		err = c.handlePaymentSucceeded(r.Context(), &requestBody.Data)
+	case paymentFailed:
+		err = c.handlePaymentAbandoned(r.Context(), &requestBody.Data, "The payment failed")
+	case paymentCancelled:
+		err = c.handlePaymentAbandoned(r.Context(), &requestBody.Data, "The payment was cancelled")
+	}
+
+	if errors.Is(err, errCheckoutLocked) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("error handling payment webhook %s: %v", requestBody.Type, err)
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error handling webhook: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PaymentWebhookResponse{IsValid: true})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// parseCastAndCrewType parses a role such as "DIRECTOR" or "director". An empty
+// role means any role and returns nil.
+func parseCastAndCrewType(role string) (*pb.CastAndCrewType, error) {
+	if role == "" {
+		return nil, nil
+	}
+
+	value, ok := pb.CastAndCrewType_value[strings.ToUpper(role)]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown cast and crew type %q", role)
+	}
+
+	castAndCrewType := pb.CastAndCrewType(value)
+
+	return &castAndCrewType, nil
+}
+
+// filterMoviesByPerson applies the optional "person" and "role" query
+// parameters, for example ?person=christopher-nolan&role=DIRECTOR only keeps
+// the movies directed by Christopher Nolan
+func filterMoviesByPerson(r *http.Request, movies []*pb.Movie) ([]*pb.Movie, error) {
+	person := r.URL.Query().Get("person")
+
+	role, err := parseCastAndCrewType(r.URL.Query().Get("role"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if person == "" {
+		if role != nil {
+			return nil, fmt.Errorf("role can only be used together with person")
+		}
+
+		return movies, nil
+	}
+
+	filtered := []*pb.Movie{}
+
+	for _, movie := range movies {
+		if search.HasPerson(movie, person, role) {
+			filtered = append(filtered, movie)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (c *Config) GetPerson(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	if c.SearchIndex == nil || !c.SearchIndex.Ready() {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "People index is not ready yet"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	person, ok := c.SearchIndex.Person(search.PersonID(id))
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No person found"}`, http.StatusNotFound)
+		return
+	}
+
+	jsonResponse, err := utils.MarshalJSON(person)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
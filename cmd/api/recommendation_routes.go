@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+// queryCoordinates reads the optional "latitude" and "longitude" query
+// parameters, ok is false when either of them is missing
+func queryCoordinates(r *http.Request) (latitude float64, longitude float64, ok bool, err error) {
+	rawLatitude := r.URL.Query().Get("latitude")
+	rawLongitude := r.URL.Query().Get("longitude")
+
+	if rawLatitude == "" || rawLongitude == "" {
+		return 0, 0, false, nil
+	}
+
+	latitude, err = strconv.ParseFloat(rawLatitude, 64)
+
+	if err != nil || latitude < -90 || latitude > 90 {
+		return 0, 0, false, fmt.Errorf("latitude must be a number between -90 and 90")
+	}
+
+	longitude, err = strconv.ParseFloat(rawLongitude, 64)
+
+	if err != nil || longitude < -180 || longitude > 180 {
+		return 0, 0, false, fmt.Errorf("longitude must be a number between -180 and 180")
+	}
+
+	return latitude, longitude, true, nil
+}
+
+// nowPlayingNear returns the ids of the movies showing near the given location
+func (c *Config) nowPlayingNear(ctx context.Context, latitude float64, longitude float64) (map[int32]bool, error) {
+	response, err := c.MovieDB_service.GetNowPlayingMovies(ctx, &pb.GetNowPlayingMovieRequest{
+		Longitude: int64(longitude),
+		Latitude:  int64(latitude),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	nearby := make(map[int32]bool)
+
+	if response == nil {
+		return nearby, nil
+	}
+
+	for _, movie := range response.MovieList {
+		nearby[movie.Id] = true
+	}
+
+	return nearby, nil
+}
+
+// catalogIndex returns the search index, building it on the spot if the
+// background indexer has not finished its first run yet
+func (c *Config) catalogIndex(ctx context.Context) (*search.Index, error) {
+	if c.SearchIndex == nil {
+		return nil, fmt.Errorf("search index is not configured")
+	}
+
+	if !c.SearchIndex.Ready() {
+		if err := c.RefreshSearchIndex(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.SearchIndex, nil
+}
+
+func (c *Config) GetSimilarMovies(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	idInt, err := strconv.Atoi(id)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Invalid 'id' parameter in URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryLimit(r, defaultSimilarLimit, maxSimilarLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	latitude, longitude, hasLocation, err := queryCoordinates(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index, err := c.catalogIndex(ctx)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error loading movie catalog: %v"}`, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	target, ok := index.Movie(int32(idInt))
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie details found"}`, http.StatusNotFound)
+		return
+	}
+
+	opts := search.SimilarOptions{}
+
+	if hasLocation {
+		// The boost is a nice to have, recommendations are still returned when
+		// the now playing lookup fails
+		opts.Nearby, err = c.nowPlayingNear(ctx, latitude, longitude)
+
+		if err != nil {
+			log.Error("error getting now playing movies for recommendations: ", err)
+		}
+	}
+
+	if user, ok := UserFromContext(r.Context()); ok {
+		movieIDs, err := c.bookedMovieIDs(ctx, user.Email)
+
+		if err != nil {
+			log.Error("error getting booking history for recommendations: ", err)
+		}
+
+		for _, movieID := range movieIDs {
+			if movie, ok := index.Movie(movieID); ok {
+				opts.History = append(opts.History, movie)
+			}
+		}
+	}
+
+	results := search.Similar(target, index.Movies(), opts, limit)
+
+	jsonResponse, err := utils.MarshalJSON(results)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
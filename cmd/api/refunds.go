@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// A payment can go through for seats that can no longer be booked, when the
+// seat hold expired before the webhook came. The checkout fails and owes the
+// customer a refund, the customer is told by email and the checkout is kept
+// and listed for admins until one of them marks it refunded.
+
+// refundsOwedKey holds the checkouts that owe a refund, scored by the unix
+// millisecond the refund became owed
+const refundsOwedKey = "checkouts:refunds-owed"
+
+type RefundsOwedList struct {
+	Checkouts []Checkout `json:"checkouts"`
+	Total     int64      `json:"total"`
+}
+
+// owesRefund tells whether a checkout was paid for and not refunded yet
+// although its seats were not booked
+func (checkout *Checkout) owesRefund() bool {
+	return checkout.RefundOwed && checkout.RefundedAt == nil
+}
+
+// noticeRefund tells the customer of a checkout that owes a refund, at most
+// once
+func (c *Config) noticeRefund(ctx context.Context, checkout *Checkout) error {
+	if !checkout.RefundOwed || checkout.RefundNoticeSentAt != nil {
+		return nil
+	}
+
+	mail := utils.SendRefundOwedMailTemplate(checkout.Customer.Email, checkout.Customer.CustomerName, checkout.IdempotentKey, checkout.Error)
+
+	if err := c.sendMail(mail); err != nil {
+		return fmt.Errorf("error sending refund notice: %w", err)
+	}
+
+	now := time.Now().UTC()
+	checkout.RefundNoticeSentAt = &now
+
+	return c.saveCheckout(ctx, checkout)
+}
+
+// AdminListRefundsOwed returns the checkouts that owe a refund, oldest first
+func (c *Config) AdminListRefundsOwed(w http.ResponseWriter, r *http.Request) {
+	if c.RedisClient == nil {
+		writeJSON(w, http.StatusOK, RefundsOwedList{Checkouts: []Checkout{}})
+		return
+	}
+
+	limit, err := queryLimit(r, defaultModerationLimit, maxModerationLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	keys, err := c.RedisClient.ZRange(r.Context(), refundsOwedKey, 0, int64(limit-1)).Result()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading refunds owed: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	total, err := c.RedisClient.ZCard(r.Context(), refundsOwedKey).Result()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading refunds owed: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	list := RefundsOwedList{Checkouts: []Checkout{}, Total: total}
+
+	for _, key := range keys {
+		checkout, err := c.checkout(r.Context(), key)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error reading checkout: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if checkout != nil {
+			list.Checkouts = append(list.Checkouts, *checkout)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// AdminMarkRefunded records that the payment of a checkout that owed a refund
+// was refunded, the checkout leaves the refunds owed
+func (c *Config) AdminMarkRefunded(w http.ResponseWriter, r *http.Request) {
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Checkout is not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	key := chi.URLParam(r, "key")
+
+	unlock, locked, err := c.lockCheckout(r.Context(), key)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error locking checkout: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !locked {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, errCheckoutLocked), http.StatusConflict)
+		return
+	}
+
+	defer unlock()
+
+	checkout, err := c.checkout(r.Context(), key)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading checkout: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if checkout == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No checkout found"}`, http.StatusNotFound)
+		return
+	}
+
+	if !checkout.RefundOwed {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "The checkout owes no refund"}`, http.StatusConflict)
+		return
+	}
+
+	// marking it again changes nothing
+	if checkout.RefundedAt == nil {
+		now := time.Now().UTC()
+		checkout.RefundedAt = &now
+
+		if err := c.saveCheckout(r.Context(), checkout); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error saving checkout: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, checkout)
+}
@@ -0,0 +1,1042 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/moderation"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+const (
+	defaultReviewPageSize = 10
+	maxReviewPageSize     = 50
+	// rankedReviewsPageSize is the page size used to read every review of a
+	// movie for the orders MovieDB cannot sort by
+	rankedReviewsPageSize = 100
+	// maxRankedReviews bounds how many of the newest reviews are ranked
+	maxRankedReviews = 1000
+	// maxReviewOffset keeps the offset of a page and of the page after it
+	// within the int32 offsets of MovieDB
+	maxReviewOffset = math.MaxInt32 - maxReviewPageSize
+	// helpfulRankingTTL bounds how stale the helpful order may get, it matches
+	// the cache of the reviews it is computed from. Votes drop it right away.
+	helpfulRankingTTL = time.Minute
+)
+
+// Weights of the helpfulness score
+const (
+	helpfulWordCap    = 300
+	helpfulTitleBonus = 0.5
+)
+
+// Review orders accepted by GetMovieReviews
+const (
+	reviewSortNewest  = "newest"
+	reviewSortOldest  = "oldest"
+	reviewSortHighest = "highest"
+	reviewSortLowest  = "lowest"
+	reviewSortHelpful = "helpful"
+)
+
+// upstreamReviewSorts are the orders MovieDB sorts by itself
+var upstreamReviewSorts = map[string]struct {
+	sortBy   pb.SortBy
+	filterBy pb.FilterBy
+}{
+	reviewSortNewest:  {pb.SortBy_DESCENDING, pb.FilterBy_DATE},
+	reviewSortOldest:  {pb.SortBy_ASCENDING, pb.FilterBy_DATE},
+	reviewSortHighest: {pb.SortBy_DESCENDING, pb.FilterBy_RATING},
+	reviewSortLowest:  {pb.SortBy_ASCENDING, pb.FilterBy_RATING},
+}
+
+// reviewCursor is the position of a page of reviews. Clients get it as an
+// opaque string and send it back unchanged.
+type reviewCursor struct {
+	MovieID int32  `json:"m"`
+	Sort    string `json:"s"`
+	Offset  int    `json:"o"`
+	Limit   int    `json:"l"`
+}
+
+func (r reviewCursor) encode() string {
+	raw, _ := json.Marshal(r)
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeReviewCursor(cursor string) (reviewCursor, error) {
+	var decoded reviewCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return decoded, fmt.Errorf("malformed cursor")
+	}
+
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Offset < 0 || decoded.Offset > maxReviewOffset || decoded.Limit < 0 {
+		return decoded, fmt.Errorf("malformed cursor")
+	}
+
+	return decoded, nil
+}
+
+// reviewHelpfulness scores how useful the content of a review looks before
+// readers vote on it. A substantial comment with a title ranks above a
+// one-line rating.
+func reviewHelpfulness(review *pb.Review) float64 {
+	words := len(strings.Fields(review.Comment))
+
+	score := math.Log1p(float64(min(words, helpfulWordCap)))
+
+	if strings.TrimSpace(review.Title) != "" {
+		score += helpfulTitleBonus
+	}
+
+	return score
+}
+
+// sortByHelpfulness orders reviews most helpful first, by the votes of
+// readers and then by content, ties go to the newest review
+func sortByHelpfulness(reviews []*pb.Review, votes map[int32]ReviewVotes) {
+	scores := make(map[*pb.Review]float64, len(reviews))
+
+	for _, review := range reviews {
+		scores[review] = reviewHelpfulness(review) + voteHelpfulness(votes[review.ReviewID])
+	}
+
+	sort.SliceStable(reviews, func(i, j int) bool {
+		if scores[reviews[i]] != scores[reviews[j]] {
+			return scores[reviews[i]] > scores[reviews[j]]
+		}
+
+		if reviews[i].CreatedAt != reviews[j].CreatedAt {
+			return reviews[i].CreatedAt > reviews[j].CreatedAt
+		}
+
+		return reviews[i].ReviewID > reviews[j].ReviewID
+	})
+}
+
+// allMovieReviews reads up to maxRankedReviews of the newest reviews of a
+// movie. The response of the first page carries the totals.
+func (c *Config) allMovieReviews(ctx context.Context, movieID int32) ([]*pb.Review, *pb.ReviewListResponse, error) {
+	var reviews []*pb.Review
+	var first *pb.ReviewListResponse
+
+	for len(reviews) < maxRankedReviews {
+		response, err := c.MovieDB_service.GetAllMovieReviews(ctx, &pb.GetAllMovieReviewsRequest{
+			MovieID:  movieID,
+			Limit:    rankedReviewsPageSize,
+			Offset:   int32(len(reviews)),
+			SortBy:   pb.SortBy_DESCENDING,
+			FilterBy: pb.FilterBy_DATE,
+		})
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if response == nil || response.ReviewList == nil {
+			break
+		}
+
+		if first == nil {
+			first = response
+		}
+
+		reviews = append(reviews, response.ReviewList.Reviews...)
+
+		if len(response.ReviewList.Reviews) < rankedReviewsPageSize || len(reviews) >= int(response.TotalReviewCount) {
+			break
+		}
+	}
+
+	if len(reviews) > maxRankedReviews {
+		reviews = reviews[:maxRankedReviews]
+	}
+
+	return reviews, first, nil
+}
+
+func helpfulRankingKey(movieID int32) string {
+	return fmt.Sprintf("reviews:helpful:%d", movieID)
+}
+
+// helpfulReviews returns the reviews of a movie most helpful first. The
+// ranking is kept in redis for helpfulRankingTTL so that paging through it
+// does not read every review from MovieDB again for each page.
+func (c *Config) helpfulReviews(ctx context.Context, movieID int32) ([]*pb.Review, *pb.ReviewListResponse, error) {
+	if c.RedisClient != nil {
+		cached, err := c.RedisClient.Get(ctx, helpfulRankingKey(movieID)).Bytes()
+
+		if err == nil {
+			var ranking pb.ReviewListResponse
+
+			if err := proto.Unmarshal(cached, &ranking); err == nil && ranking.ReviewList != nil {
+				return ranking.ReviewList.Reviews, &ranking, nil
+			}
+		} else if err != redis.Nil {
+			log.Error("error reading the helpful ranking: ", err)
+		}
+	}
+
+	ranked, response, err := c.allMovieReviews(ctx, movieID)
+
+	if err != nil || response == nil {
+		return ranked, response, err
+	}
+
+	sortByHelpfulness(ranked, c.reviewVotes(ctx, ranked))
+
+	ranking := &pb.ReviewListResponse{
+		Status:           response.Status,
+		Message:          response.Message,
+		ReviewList:       &pb.ReviewList{Reviews: ranked},
+		TotalReviewCount: response.TotalReviewCount,
+		TotalVotes:       response.TotalVotes,
+	}
+
+	if c.RedisClient != nil {
+		encoded, err := proto.Marshal(ranking)
+
+		if err == nil {
+			err = c.RedisClient.Set(ctx, helpfulRankingKey(movieID), encoded, helpfulRankingTTL).Err()
+		}
+
+		if err != nil {
+			log.Error("error caching the helpful ranking: ", err)
+		}
+	}
+
+	return ranked, ranking, nil
+}
+
+type MovieReviewsRequest struct {
+	// Cursor continues from a nextCursor or prevCursor, its order wins over
+	// Sort and its page size applies unless Limit is set
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort" validate:"omitempty,oneof=newest oldest highest lowest helpful"`
+	Limit  int32  `json:"limit"`
+	// Offset, SortBy and FilterBy are kept for clients that predate cursors
+	Offset   int32           `json:"offset"`
+	SortBy   utils.EnumValue `json:"sortBy" enum:"moviedb_service.SortBy"`
+	FilterBy utils.EnumValue `json:"filterBy" enum:"moviedb_service.FilterBy"`
+}
+
+// legacySort maps the SortBy and FilterBy of older clients onto an order
+func (m MovieReviewsRequest) legacySort() (string, error) {
+	sortBy, err := m.SortBy.Parse(pb.SortBy_value)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid sortBy: %v", err)
+	}
+
+	filterBy, err := m.FilterBy.Parse(pb.FilterBy_value)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid filterBy: %v", err)
+	}
+
+	for order, upstream := range upstreamReviewSorts {
+		if upstream.sortBy == pb.SortBy(sortBy) && upstream.filterBy == pb.FilterBy(filterBy) {
+			return order, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported sortBy and filterBy")
+}
+
+type MovieReviewsPage struct {
+	Reviews          []*pb.Review `json:"reviews"`
+	TotalReviewCount int32        `json:"totalReviewCount"`
+	TotalVotes       int32        `json:"totalVotes"`
+	Sort             string       `json:"sort"`
+	Limit            int          `json:"limit"`
+	NextCursor       string       `json:"nextCursor,omitempty"`
+	PrevCursor       string       `json:"prevCursor,omitempty"`
+	// Votes are the helpful and unhelpful tallies of the reviews of the page
+	// by review id, reviews nobody voted on are left out
+	Votes map[int32]ReviewVotes `json:"votes"`
+	// Verified marks the reviews of the page by verified viewers, viewers who
+	// booked a showing of the movie, by review id
+	Verified map[int32]bool `json:"verified"`
+}
+
+func (c *Config) GetMovieReviews(w http.ResponseWriter, r *http.Request) {
+	var requestBody MovieReviewsRequest
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
+	if err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	// Extract the "id" parameter from the URL
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Missing 'id' parameter in URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	idInt, err := strconv.Atoi(id)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Invalid 'id' parameter in URL"}`, http.StatusBadRequest)
+		return
+	}
+
+	movieID := int32(idInt)
+
+	if requestBody.Limit < 0 || requestBody.Offset < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "limit and offset must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	cursor := reviewCursor{MovieID: movieID, Sort: requestBody.Sort, Offset: int(requestBody.Offset)}
+
+	switch {
+	case requestBody.Cursor != "":
+		cursor, err = decodeReviewCursor(requestBody.Cursor)
+
+		if err == nil && cursor.MovieID != movieID {
+			err = fmt.Errorf("cursor belongs to another movie")
+		}
+	case cursor.Sort == "" && (requestBody.SortBy != "" || requestBody.FilterBy != ""):
+		cursor.Sort, err = requestBody.legacySort()
+	case cursor.Sort == "":
+		cursor.Sort = reviewSortNewest
+	}
+
+	if _, upstream := upstreamReviewSorts[cursor.Sort]; err == nil && !upstream && cursor.Sort != reviewSortHelpful {
+		err = fmt.Errorf("unknown sort %q", cursor.Sort)
+	}
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Invalid reviews page: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	limit := int(requestBody.Limit)
+
+	if limit == 0 {
+		limit = cursor.Limit
+	}
+
+	if limit == 0 {
+		limit = defaultReviewPageSize
+	}
+
+	if limit > maxReviewPageSize {
+		limit = maxReviewPageSize
+	}
+
+	var reviews []*pb.Review
+	var response *pb.ReviewListResponse
+	var total int
+
+	if upstream, ok := upstreamReviewSorts[cursor.Sort]; ok {
+		response, err = c.MovieDB_service.GetAllMovieReviews(r.Context(), &pb.GetAllMovieReviewsRequest{
+			MovieID:  movieID,
+			Offset:   int32(cursor.Offset),
+			SortBy:   upstream.sortBy,
+			FilterBy: upstream.filterBy,
+			Limit:    int32(limit),
+		})
+
+		if err == nil && response != nil && response.ReviewList != nil {
+			reviews = response.ReviewList.Reviews
+			total = int(response.TotalReviewCount)
+
+			// without a total, a full page may have a successor
+			if total == 0 && len(reviews) == limit {
+				total = cursor.Offset + limit + 1
+			}
+		}
+	} else {
+		var ranked []*pb.Review
+
+		ranked, response, err = c.helpfulReviews(r.Context(), movieID)
+
+		total = len(ranked)
+
+		if cursor.Offset < len(ranked) {
+			reviews = ranked[cursor.Offset:min(cursor.Offset+limit, len(ranked))]
+		}
+	}
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error getting movie reviews: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// Validate the gRPC response
+
+	if response == nil || response.ReviewList == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie reviews found"}`, http.StatusNotFound)
+		return
+	}
+
+	votes := c.reviewVotes(r.Context(), reviews)
+
+	page := MovieReviewsPage{
+		Reviews:          reviews,
+		TotalReviewCount: response.TotalReviewCount,
+		TotalVotes:       response.TotalVotes,
+		Sort:             cursor.Sort,
+		Limit:            limit,
+		Votes:            map[int32]ReviewVotes{},
+		Verified:         c.verifiedReviews(r.Context(), movieID, reviews),
+	}
+
+	for _, review := range reviews {
+		if tally, ok := votes[review.ReviewID]; ok {
+			page.Votes[review.ReviewID] = tally
+		}
+	}
+
+	if next := cursor.Offset + len(reviews); len(reviews) > 0 && next < total {
+		page.NextCursor = reviewCursor{MovieID: movieID, Sort: cursor.Sort, Offset: next, Limit: limit}.encode()
+	}
+
+	if cursor.Offset > 0 {
+		page.PrevCursor = reviewCursor{MovieID: movieID, Sort: cursor.Sort, Offset: max(cursor.Offset-limit, 0), Limit: limit}.encode()
+	}
+
+	var body any = page
+
+	// the legacy alias is the only POST and answers with the ReviewListResponse
+	// of MovieDB its clients were written against
+	if r.Method == http.MethodPost {
+		body = &pb.ReviewListResponse{
+			Status:           response.Status,
+			Message:          response.Message,
+			ReviewList:       &pb.ReviewList{Reviews: reviews},
+			TotalReviewCount: response.TotalReviewCount,
+			TotalVotes:       response.TotalVotes,
+		}
+	}
+
+	// Marshal the response to JSON
+
+	jsonResponse, err := utils.MarshalJSON(body)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
+
+// reviewAuthorClaimTTL bounds how long a review being posted blocks another
+// review of the same user, in case the broker stops before MovieDB answers
+const reviewAuthorClaimTTL = 30 * time.Second
+
+// reviewAuthorKey maps a user and a movie to the review the user posted, it
+// is how the broker enforces one review per user per movie
+func reviewAuthorKey(movieID int32, userID int32) string {
+	return fmt.Sprintf("reviews:author:%d:%d", movieID, userID)
+}
+
+// errUncheckedReviews is returned when a movie has more reviews than the
+// broker reads, a review of the user among the older ones could be missed
+var errUncheckedReviews = errors.New("the movie has too many reviews to check")
+
+// userMovieReviewID returns the review userID posted for movieID and whether
+// there is one. A review still being posted or held for a moderator exists
+// without an id yet. Reviews posted before the broker kept the index are found
+// in MovieDB and indexed on the way.
+func (c *Config) userMovieReviewID(ctx context.Context, movieID int32, userID int32) (int32, bool, error) {
+	if c.RedisClient != nil {
+		value, err := c.RedisClient.Get(ctx, reviewAuthorKey(movieID, userID)).Result()
+
+		if err != nil && err != redis.Nil {
+			return 0, false, err
+		}
+
+		if reviewID, err := strconv.Atoi(value); err == nil && reviewID > 0 {
+			return int32(reviewID), true, nil
+		}
+
+		// the claim of a review being posted, or the hold of a pending one
+		if strings.HasPrefix(value, "pending") {
+			return 0, true, nil
+		}
+	}
+
+	reviews, first, err := c.allMovieReviews(ctx, movieID)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, review := range reviews {
+		if review.UserID == userID {
+			if c.RedisClient != nil {
+				c.RedisClient.Set(ctx, reviewAuthorKey(movieID, userID), review.ReviewID, 0)
+			}
+
+			return review.ReviewID, true, nil
+		}
+	}
+
+	if first != nil && len(reviews) < int(first.TotalReviewCount) {
+		return 0, false, errUncheckedReviews
+	}
+
+	return 0, false, nil
+}
+
+// authorizedReview loads a review of movieID and checks that user may change
+// it, only its author and admins may. The status is the one to answer with
+// when err is set.
+func (c *Config) authorizedReview(ctx context.Context, user *AuthUser, movieID int32, reviewID int32) (*pb.Review, int, error) {
+	response, err := c.MovieDB_service.GetReview(ctx, &pb.ReviewRequest{
+		MovieID:  movieID,
+		ReviewID: reviewID,
+	})
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error getting movie review: %v", err)
+	}
+
+	if response == nil || response.Review == nil || (response.Review.MovieID != 0 && response.Review.MovieID != movieID) {
+		return nil, http.StatusNotFound, fmt.Errorf("no movie review found")
+	}
+
+	if response.Review.UserID != user.UserID && !user.IsAdmin() {
+		return nil, http.StatusForbidden, fmt.Errorf("only the author of a review or an admin may change it")
+	}
+
+	return response.Review, http.StatusOK, nil
+}
+
+// reviewPathIDs returns the movie and review ids of a review route, the
+// review id is absent on routes that create a review
+func reviewPathIDs(r *http.Request) (movieID int32, reviewID int32, err error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if err != nil || id <= 0 {
+		return 0, 0, fmt.Errorf("invalid 'id' parameter in URL")
+	}
+
+	if raw := chi.URLParam(r, "reviewId"); raw != "" {
+		review, err := strconv.Atoi(raw)
+
+		if err != nil || review <= 0 {
+			return 0, 0, fmt.Errorf("invalid 'reviewId' parameter in URL")
+		}
+
+		reviewID = int32(review)
+	}
+
+	return int32(id), reviewID, nil
+}
+
+type AddReviewRequest struct {
+	Title   string `json:"title" validate:"required"`
+	Comment string `json:"comment" validate:"required"`
+	Rating  int32  `json:"rating" validate:"required,min=1,max=5"`
+}
+
+// AddMovieReview posts a review by the signed in user, a user reviews a movie
+// at most once
+func (c *Config) AddMovieReview(w http.ResponseWriter, r *http.Request) {
+	var requestBody AddReviewRequest
+
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
+
+	if err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Rating <= 0 || requestBody.Rating > 5 {
+		http.Error(w, `error rating cannot be less than 1 or greater than 5`, http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Comment == "" {
+		http.Error(w, "error comment cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Title == "" {
+		http.Error(w, "error title cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	movieID, _, err := reviewPathIDs(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	existing, reviewed, err := c.userMovieReviewID(r.Context(), movieID, user.UserID)
+
+	// one review per user cannot be enforced when some reviews went unchecked
+	if errors.Is(err, errUncheckedReviews) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Could not confirm you have not reviewed this movie already"}`, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error checking existing reviews: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if reviewed && existing == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "You have already reviewed this movie"}`, http.StatusConflict)
+		return
+	}
+
+	if reviewed {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "You have already reviewed this movie", "reviewId": %d}`, existing), http.StatusConflict)
+		return
+	}
+
+	// A review of a user who booked a showing of the movie gets the verified
+	// viewer badge, some movies only take reviews with the badge
+	verified, verifyErr := c.verifiedViewer(r.Context(), user, movieID)
+
+	if verifyErr != nil {
+		log.Error("error verifying viewer: ", verifyErr)
+	}
+
+	settings, err := c.movieReviewSettings(r.Context(), movieID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading review settings: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if settings.VerifiedOnly && !verified && !user.IsAdmin() {
+		if verifyErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "Could not confirm your bookings, try again later"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Only viewers who booked a showing may review this movie"}`, http.StatusForbidden)
+		return
+	}
+
+	// Claim the review before posting it so that two concurrent requests of the
+	// same user cannot both get through
+	authorKey := reviewAuthorKey(movieID, user.UserID)
+
+	if c.RedisClient != nil {
+		claimed, err := c.RedisClient.SetNX(r.Context(), authorKey, "pending", reviewAuthorClaimTTL).Result()
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error checking existing reviews: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if !claimed {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "You have already reviewed this movie"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	flags, err := c.moderateReview(r.Context(), movieID, user.UserID, requestBody.Title, requestBody.Comment)
+
+	if err == nil && len(flags) > 0 {
+		c.holdMovieReview(w, r, authorKey, PendingReview{
+			MovieID:  movieID,
+			UserID:   user.UserID,
+			Title:    requestBody.Title,
+			Comment:  requestBody.Comment,
+			Rating:   requestBody.Rating,
+			Flags:    flags,
+			Verified: verified,
+		})
+		return
+	}
+
+	if err != nil {
+		if c.RedisClient != nil {
+			c.RedisClient.Del(context.Background(), authorKey)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error moderating review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	review := &pb.Review{
+		MovieID: movieID,
+		UserID:  user.UserID,
+		Rating:  requestBody.Rating,
+		Comment: requestBody.Comment,
+		Title:   requestBody.Title,
+	}
+
+	response, err := c.MovieDB_service.AddReview(r.Context(), review)
+
+	if err != nil || response == nil {
+		if c.RedisClient != nil {
+			c.RedisClient.Del(context.Background(), authorKey)
+		}
+	}
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error adding movie review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if response == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
+		return
+	}
+
+	// Without the id of the new review the claim is left to expire, by then
+	// the review is found in MovieDB
+	if c.RedisClient != nil && response.Review != nil && response.Review.ReviewID > 0 {
+		c.RedisClient.Set(r.Context(), authorKey, response.Review.ReviewID, 0)
+
+		if verified {
+			c.markVerifiedReview(r.Context(), movieID, response.Review.ReviewID)
+		}
+	}
+
+	c.adjustReviewAggregates(r.Context(), movieID, nil, publishedReview(response, review))
+	c.rememberReviewContent(r.Context(), movieID, user.UserID, requestBody.Title, requestBody.Comment)
+	c.recordModeration(r.Context(), ModerationRecord{
+		Action:   moderationPublished,
+		ReviewID: response.GetReview().GetReviewID(),
+		MovieID:  movieID,
+		UserID:   user.UserID,
+		Flags:    flags,
+	})
+
+	jsonResponse, err := utils.MarshalJSON(response)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// holdMovieReview queues a flagged review, or a flagged edit, for a moderator
+// and answers 202 Accepted. authorKey is the claim of a new review, it is
+// kept while the review waits.
+func (c *Config) holdMovieReview(w http.ResponseWriter, r *http.Request, authorKey string, pending PendingReview) {
+	pending, err := c.holdReview(r.Context(), pending)
+
+	if err != nil {
+		if authorKey != "" && c.RedisClient != nil {
+			c.RedisClient.Del(context.Background(), authorKey)
+		}
+
+		status := http.StatusInternalServerError
+
+		if c.RedisClient == nil {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error holding review for moderation: %v"}`, err), status)
+		return
+	}
+
+	if authorKey != "" {
+		c.RedisClient.Set(r.Context(), authorKey, pendingAuthorHold(pending.ID), 0)
+	}
+
+	c.recordModeration(r.Context(), ModerationRecord{
+		Action:    moderationHeld,
+		PendingID: pending.ID,
+		ReviewID:  pending.ReviewID,
+		MovieID:   pending.MovieID,
+		UserID:    pending.UserID,
+		Flags:     pending.Flags,
+	})
+
+	writeJSON(w, http.StatusAccepted, pending)
+}
+
+// UpdateReviewRequest changes the fields that are set, the others are kept
+type UpdateReviewRequest struct {
+	Title   string `json:"title"`
+	Comment string `json:"comment"`
+	Rating  int32  `json:"rating" validate:"omitempty,min=1,max=5"`
+}
+
+// UpdateMovieReview edits a review, the review keeps its author when an admin
+// edits it
+func (c *Config) UpdateMovieReview(w http.ResponseWriter, r *http.Request) {
+	var requestBody UpdateReviewRequest
+
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
+
+	if err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Rating < 0 || requestBody.Rating > 5 {
+		http.Error(w, `error rating cannot be less than 1 or greater than 5`, http.StatusBadRequest)
+		return
+	}
+
+	movieID, reviewID, err := reviewPathIDs(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	review, status, err := c.authorizedReview(r.Context(), user, movieID, reviewID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), status)
+		return
+	}
+
+	update := &pb.ReviewUpdateRequest{
+		UserID:   review.UserID,
+		ReviewID: reviewID,
+		MovieID:  movieID,
+		Title:    review.Title,
+		Comment:  review.Comment,
+		Rating:   review.Rating,
+	}
+
+	if requestBody.Title != "" {
+		update.Title = requestBody.Title
+	}
+
+	if requestBody.Comment != "" {
+		update.Comment = requestBody.Comment
+	}
+
+	if requestBody.Rating != 0 {
+		update.Rating = requestBody.Rating
+	}
+
+	// Edits by the author are moderated like new reviews, admins moderate
+	var flags []moderation.Flag
+
+	if !user.IsAdmin() && (update.Title != review.Title || update.Comment != review.Comment) {
+		flags, err = c.moderateReview(r.Context(), movieID, review.UserID, update.Title, update.Comment)
+
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, fmt.Sprintf(`{"error": "Error moderating review: %v"}`, err), http.StatusInternalServerError)
+			return
+		}
+
+		if len(flags) > 0 {
+			c.holdMovieReview(w, r, "", PendingReview{
+				ReviewID: reviewID,
+				MovieID:  movieID,
+				UserID:   review.UserID,
+				Title:    update.Title,
+				Comment:  update.Comment,
+				Rating:   update.Rating,
+				Flags:    flags,
+			})
+			return
+		}
+	}
+
+	response, err := c.MovieDB_service.UpdateReview(r.Context(), update)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error updating movie review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if response == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
+		return
+	}
+
+	c.adjustReviewAggregates(r.Context(), movieID, review, publishedReview(response, &pb.Review{
+		MovieID:   movieID,
+		UserID:    review.UserID,
+		Title:     update.Title,
+		Comment:   update.Comment,
+		Rating:    update.Rating,
+		CreatedAt: review.CreatedAt,
+	}))
+	c.rememberReviewContent(r.Context(), movieID, review.UserID, update.Title, update.Comment)
+	c.recordModeration(r.Context(), ModerationRecord{
+		Action:   moderationPublished,
+		ReviewID: reviewID,
+		MovieID:  movieID,
+		UserID:   review.UserID,
+		Flags:    flags,
+	})
+
+	jsonResponse, err := utils.MarshalJSON(response)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// DeleteMovieReview deletes a review and frees its author to review the movie
+// again
+func (c *Config) DeleteMovieReview(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	movieID, reviewID, err := reviewPathIDs(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	review, status, err := c.authorizedReview(r.Context(), user, movieID, reviewID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), status)
+		return
+	}
+
+	response, err := c.MovieDB_service.DeleteReview(r.Context(), &pb.ReviewRequest{
+		MovieID:  movieID,
+		UserID:   review.UserID,
+		ReviewID: reviewID,
+	})
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error deleting movie review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if response == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
+		return
+	}
+
+	if c.RedisClient != nil {
+		c.RedisClient.Del(r.Context(), reviewAuthorKey(movieID, review.UserID), reviewVotesKey(reviewID), reviewTallyKey(reviewID))
+		c.RedisClient.SRem(r.Context(), verifiedReviewsKey(movieID), reviewID)
+	}
+
+	c.adjustReviewAggregates(r.Context(), movieID, review, nil)
+
+	jsonResponse, err := utils.MarshalJSON(response)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
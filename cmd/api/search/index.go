@@ -0,0 +1,447 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// Field weights, a hit on the title matters a lot more than a hit somewhere in
+// the description
+const (
+	titleWeight       = 5.0
+	castCrewWeight    = 3.0
+	genreWeight       = 2.0
+	languageWeight    = 2.0
+	descriptionWeight = 1.0
+)
+
+// Match quality multipliers applied on top of the field weight
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.7
+	fuzzyMatch  = 0.4
+)
+
+type Filters struct {
+	Languages []string
+	Genres    []string
+}
+
+type Result struct {
+	Movie *pb.Movie `json:"movie"`
+	Score float64   `json:"score"`
+}
+
+type Index struct {
+	mu sync.RWMutex
+
+	movies map[int32]*pb.Movie
+	// postings maps a term to the movies that contain it and the weight of the
+	// best field it was found in
+	postings map[string]map[int32]float64
+	// terms is the sorted vocabulary, used for prefix lookups
+	terms []string
+	// people is the cast and crew index keyed by person id
+	people map[string]*Person
+
+	builtAt     time.Time
+	fingerprint string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		movies:   make(map[int32]*pb.Movie),
+		postings: make(map[string]map[int32]float64),
+		people:   make(map[string]*Person),
+	}
+}
+
+// Tokenize lower cases s and splits it on anything that is not a letter or a
+// digit
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Build replaces the contents of the index with movies. fingerprint identifies
+// the catalog the index was built from so callers can skip rebuilding when
+// nothing changed.
+func (idx *Index) Build(movies []*pb.Movie, fingerprint string) {
+	docs := make(map[int32]*pb.Movie, len(movies))
+	postings := make(map[string]map[int32]float64)
+
+	add := func(id int32, text string, weight float64) {
+		for _, term := range Tokenize(text) {
+			docsForTerm, ok := postings[term]
+
+			if !ok {
+				docsForTerm = make(map[int32]float64)
+				postings[term] = docsForTerm
+			}
+
+			if weight > docsForTerm[id] {
+				docsForTerm[id] = weight
+			}
+		}
+	}
+
+	for _, movie := range movies {
+		if movie == nil {
+			continue
+		}
+
+		docs[movie.Id] = movie
+
+		add(movie.Id, movie.Title, titleWeight)
+		add(movie.Id, movie.Description, descriptionWeight)
+
+		for _, castCrew := range movie.CastCrew {
+			add(movie.Id, castCrew.Name, castCrewWeight)
+			add(movie.Id, castCrew.CharacterName, castCrewWeight)
+		}
+
+		for _, genre := range movie.Type {
+			add(movie.Id, genre, genreWeight)
+		}
+
+		for _, language := range movie.Language {
+			add(movie.Id, language, languageWeight)
+		}
+	}
+
+	terms := make([]string, 0, len(postings))
+
+	for term := range postings {
+		terms = append(terms, term)
+	}
+
+	sort.Strings(terms)
+
+	people := buildPeople(movies)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.movies = docs
+	idx.postings = postings
+	idx.terms = terms
+	idx.people = people
+	idx.builtAt = time.Now()
+	idx.fingerprint = fingerprint
+}
+
+func (idx *Index) Fingerprint() string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.fingerprint
+}
+
+func (idx *Index) BuiltAt() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.builtAt
+}
+
+// Ready reports whether the index has been built at least once
+func (idx *Index) Ready() bool {
+	return !idx.BuiltAt().IsZero()
+}
+
+// Movies returns every movie in the index
+func (idx *Index) Movies() []*pb.Movie {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	movies := make([]*pb.Movie, 0, len(idx.movies))
+
+	for _, movie := range idx.movies {
+		movies = append(movies, movie)
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		return movies[i].Id < movies[j].Id
+	})
+
+	return movies
+}
+
+// Movie returns the indexed movie with the given id
+func (idx *Index) Movie(id int32) (*pb.Movie, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	movie, ok := idx.movies[id]
+
+	return movie, ok
+}
+
+// prefixTerms returns every term in the vocabulary that starts with prefix.
+// Must be called with the read lock held.
+func (idx *Index) prefixTerms(prefix string) []string {
+	start := sort.SearchStrings(idx.terms, prefix)
+	matches := []string{}
+
+	for i := start; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], prefix); i++ {
+		matches = append(matches, idx.terms[i])
+	}
+
+	return matches
+}
+
+// maxEdits returns how many typos are tolerated for a token of the given length
+func maxEdits(token string) int {
+	switch n := len([]rune(token)); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matchToken scores every movie that matches token, either exactly, as a prefix
+// (only when allowPrefix is set) or within the typo budget. Must be called with
+// the read lock held.
+func (idx *Index) matchToken(token string, allowPrefix bool) map[int32]float64 {
+	scores := make(map[int32]float64)
+
+	merge := func(term string, multiplier float64) {
+		for id, weight := range idx.postings[term] {
+			if score := weight * multiplier; score > scores[id] {
+				scores[id] = score
+			}
+		}
+	}
+
+	merge(token, exactMatch)
+
+	if allowPrefix {
+		for _, term := range idx.prefixTerms(token) {
+			if term != token {
+				merge(term, prefixMatch)
+			}
+		}
+	}
+
+	if len(scores) > 0 {
+		return scores
+	}
+
+	budget := maxEdits(token)
+
+	if budget == 0 {
+		return scores
+	}
+
+	for _, term := range idx.terms {
+		if abs(len(term)-len(token)) > budget {
+			continue
+		}
+
+		if editDistance(token, term) <= budget {
+			merge(term, fuzzyMatch)
+		}
+	}
+
+	return scores
+}
+
+// MatchesAny reports whether any of values is one of wanted, ignoring case. An
+// empty wanted list matches everything.
+func MatchesAny(values []string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		for _, w := range wanted {
+			if strings.EqualFold(value, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Search returns movies that match every token in query, best match first. The
+// last token is treated as a prefix so the results follow the user as they
+// type. An empty query returns every movie that passes the filters.
+func (idx *Index) Search(query string, filters Filters, limit int) []Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	tokens := Tokenize(query)
+	var scores map[int32]float64
+
+	if len(tokens) == 0 {
+		scores = make(map[int32]float64, len(idx.movies))
+
+		for id := range idx.movies {
+			scores[id] = 0
+		}
+	}
+
+	for i, token := range tokens {
+		matched := idx.matchToken(token, i == len(tokens)-1)
+
+		if scores == nil {
+			scores = matched
+			continue
+		}
+
+		for id, score := range scores {
+			tokenScore, ok := matched[id]
+
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+
+			scores[id] = score + tokenScore
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+
+	for id, score := range scores {
+		movie := idx.movies[id]
+
+		if !MatchesAny(movie.Language, filters.Languages) || !MatchesAny(movie.Type, filters.Genres) {
+			continue
+		}
+
+		results = append(results, Result{Movie: movie, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		if results[i].Movie.Votes != results[j].Movie.Votes {
+			return results[i].Movie.Votes > results[j].Movie.Votes
+		}
+
+		return results[i].Movie.Id < results[j].Movie.Id
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// Autocomplete returns up to limit suggestions, movie titles and cast and crew
+// names, for the partially typed query
+func (idx *Index) Autocomplete(query string, limit int) []string {
+	tokens := Tokenize(query)
+
+	if len(tokens) == 0 {
+		return []string{}
+	}
+
+	results := idx.Search(query, Filters{}, 0)
+	seen := make(map[string]bool)
+	suggestions := []string{}
+
+	addSuggestion := func(s string) bool {
+		key := strings.ToLower(s)
+
+		if s == "" || seen[key] {
+			return false
+		}
+
+		seen[key] = true
+		suggestions = append(suggestions, s)
+
+		return limit > 0 && len(suggestions) >= limit
+	}
+
+	last := tokens[len(tokens)-1]
+
+	for _, result := range results {
+		if phraseMatches(result.Movie.Title, last) && addSuggestion(result.Movie.Title) {
+			return suggestions
+		}
+	}
+
+	for _, result := range results {
+		for _, castCrew := range result.Movie.CastCrew {
+			if phraseMatches(castCrew.Name, last) && addSuggestion(castCrew.Name) {
+				return suggestions
+			}
+		}
+	}
+
+	return suggestions
+}
+
+// phraseMatches reports whether any word of phrase starts with prefix or is
+// within the typo budget of it
+func phraseMatches(phrase string, prefix string) bool {
+	for _, word := range Tokenize(phrase) {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+
+		if budget := maxEdits(prefix); budget > 0 && editDistance(prefix, word) <= budget {
+			return true
+		}
+	}
+
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// editDistance is the optimal string alignment distance between a and b, a
+// Levenshtein distance that also counts adjacent transpositions as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+		}
+
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,60 @@
+package search
+
+// minKeywordLength drops tokens too short to say anything about a movie
+const minKeywordLength = 3
+
+// stopWords are the common English words and the review boilerplate that never
+// make a useful keyword
+var stopWords = toSet([]string{
+	"about", "after", "again", "all", "also", "and", "any", "are", "because", "been",
+	"before", "being", "but", "can", "could", "did", "does", "doing", "down", "each",
+	"even", "every", "few", "for", "from", "further", "had", "has", "have", "having",
+	"her", "here", "hers", "him", "his", "how", "into", "its", "just", "like",
+	"more", "most", "much", "not", "now", "off", "once", "only", "other", "our",
+	"out", "over", "own", "really", "same", "she", "should", "some", "such", "than",
+	"that", "the", "their", "them", "then", "there", "these", "they", "this", "those",
+	"through", "too", "under", "until", "very", "was", "were", "what", "when", "where",
+	"which", "while", "who", "whom", "why", "will", "with", "would", "you", "your",
+	"yet", "get", "got", "one", "two", "way", "lot", "bit", "didn", "don",
+	"doesn", "isn", "wasn", "ive", "let",
+	"movie", "movies", "film", "films", "watch", "watched", "watching", "saw", "see", "seen",
+})
+
+func toSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+
+	for _, word := range words {
+		set[word] = true
+	}
+
+	return set
+}
+
+// Keywords returns the distinct words of text worth counting, stop words,
+// numbers and short words are left out
+func Keywords(text string) []string {
+	seen := map[string]bool{}
+
+	var keywords []string
+
+	for _, token := range Tokenize(text) {
+		if len(token) < minKeywordLength || stopWords[token] || seen[token] || isNumber(token) {
+			continue
+		}
+
+		seen[token] = true
+		keywords = append(keywords, token)
+	}
+
+	return keywords
+}
+
+func isNumber(token string) bool {
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+type Credit struct {
+	MovieID       int32  `json:"movieId"`
+	Title         string `json:"title"`
+	PosterURL     string `json:"posterUrl"`
+	ReleaseDate   string `json:"releaseDate"`
+	CharacterName string `json:"characterName,omitempty"`
+}
+
+type Person struct {
+	ID       string              `json:"id"`
+	Name     string              `json:"name"`
+	PhotoURL string              `json:"photoUrl"`
+	Credits  map[string][]Credit `json:"credits"`
+}
+
+// PersonID turns a cast or crew name into the stable id used in person urls,
+// "Christopher Nolan" becomes "christopher-nolan"
+func PersonID(name string) string {
+	return strings.Join(Tokenize(name), "-")
+}
+
+// buildPeople groups every cast and crew entry of the catalog by person, and
+// within a person by CastAndCrewType
+func buildPeople(movies []*pb.Movie) map[string]*Person {
+	people := make(map[string]*Person)
+
+	for _, movie := range movies {
+		if movie == nil {
+			continue
+		}
+
+		for _, castCrew := range movie.CastCrew {
+			id := PersonID(castCrew.Name)
+
+			if id == "" {
+				continue
+			}
+
+			person, ok := people[id]
+
+			if !ok {
+				person = &Person{
+					ID:      id,
+					Name:    castCrew.Name,
+					Credits: make(map[string][]Credit),
+				}
+				people[id] = person
+			}
+
+			if person.PhotoURL == "" {
+				person.PhotoURL = castCrew.Photourl
+			}
+
+			role := castCrew.Type.String()
+
+			person.Credits[role] = append(person.Credits[role], Credit{
+				MovieID:       movie.Id,
+				Title:         movie.Title,
+				PosterURL:     movie.PosterUrl,
+				ReleaseDate:   movie.ReleaseDate,
+				CharacterName: castCrew.CharacterName,
+			})
+		}
+	}
+
+	for _, person := range people {
+		for _, credits := range person.Credits {
+			// Newest release first, release dates are ISO formatted so they
+			// sort lexically
+			sort.SliceStable(credits, func(i, j int) bool {
+				return credits[i].ReleaseDate > credits[j].ReleaseDate
+			})
+		}
+	}
+
+	return people
+}
+
+// Person returns the person with the given id
+func (idx *Index) Person(id string) (*Person, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	person, ok := idx.people[id]
+
+	return person, ok
+}
+
+// HasPerson reports whether movie credits person, optionally restricted to a
+// role. person may either be a person id or a name.
+func HasPerson(movie *pb.Movie, person string, role *pb.CastAndCrewType) bool {
+	id := PersonID(person)
+
+	for _, castCrew := range movie.CastCrew {
+		if PersonID(castCrew.Name) != id {
+			continue
+		}
+
+		if role == nil || castCrew.Type == *role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// Weights of the "you might also like" score. Content similarity decides
+// whether a movie is a candidate at all, popularity, showing nearby and the
+// user's history only reorder candidates.
+const (
+	sharedGenreWeight    = 3.0
+	sharedLanguageWeight = 1.0
+	sharedCastWeight     = 1.0
+	maxSharedCast        = 3
+	sameDirectorWeight   = 2.0
+	popularityWeight     = 1.0
+	rankingWeight        = 0.5
+	nearbyBoost          = 1.5
+	historyWeight        = 1.5
+)
+
+type SimilarOptions struct {
+	// Nearby contains the movies currently showing near the user
+	Nearby map[int32]bool
+	// History contains the movies the user booked before, used to personalise
+	// the ranking. Movies in the history are never recommended again.
+	History []*pb.Movie
+}
+
+// profile is the set of features of a movie, or of a user's history, that the
+// similarity score compares
+type profile struct {
+	genres    map[string]bool
+	languages map[string]bool
+	cast      map[string]bool
+	directors map[string]bool
+}
+
+func newProfile(movies ...*pb.Movie) profile {
+	p := profile{
+		genres:    make(map[string]bool),
+		languages: make(map[string]bool),
+		cast:      make(map[string]bool),
+		directors: make(map[string]bool),
+	}
+
+	for _, movie := range movies {
+		for _, genre := range movie.Type {
+			p.genres[strings.ToLower(genre)] = true
+		}
+
+		for _, language := range movie.Language {
+			p.languages[strings.ToLower(language)] = true
+		}
+
+		for _, castCrew := range movie.CastCrew {
+			switch castCrew.Type {
+			case pb.CastAndCrewType_ACTOR:
+				p.cast[PersonID(castCrew.Name)] = true
+			case pb.CastAndCrewType_DIRECTOR:
+				p.directors[PersonID(castCrew.Name)] = true
+			}
+		}
+	}
+
+	return p
+}
+
+// overlap returns the jaccard similarity of a and b
+func overlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+
+	for key := range a {
+		if b[key] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func countShared(a, b map[string]bool) int {
+	shared := 0
+
+	for key := range a {
+		if b[key] {
+			shared++
+		}
+	}
+
+	return shared
+}
+
+// contentScore is how alike two profiles are, ignoring popularity
+func contentScore(a, b profile) float64 {
+	score := sharedGenreWeight * overlap(a.genres, b.genres)
+
+	if countShared(a.languages, b.languages) > 0 {
+		score += sharedLanguageWeight
+	}
+
+	score += sharedCastWeight * float64(min(countShared(a.cast, b.cast), maxSharedCast))
+
+	if countShared(a.directors, b.directors) > 0 {
+		score += sameDirectorWeight
+	}
+
+	return score
+}
+
+// related reports whether a and b share a genre or a cast or crew member. A
+// shared language alone is too weak a signal, most of the catalog would
+// qualify.
+func related(a, b profile) bool {
+	return countShared(a.genres, b.genres) > 0 || countShared(a.cast, b.cast) > 0 || countShared(a.directors, b.directors) > 0
+}
+
+// Similar ranks candidates by how much they resemble target. Only candidates
+// that share at least a genre or a cast or crew member with target are
+// returned, a shared language adds to the score but is not enough on its own.
+func Similar(target *pb.Movie, candidates []*pb.Movie, opts SimilarOptions, limit int) []Result {
+	targetProfile := newProfile(target)
+
+	var historyProfile *profile
+
+	booked := make(map[int32]bool, len(opts.History))
+
+	if len(opts.History) > 0 {
+		p := newProfile(opts.History...)
+		historyProfile = &p
+
+		for _, movie := range opts.History {
+			booked[movie.Id] = true
+		}
+	}
+
+	var maxVotes int64
+
+	for _, candidate := range candidates {
+		if candidate.Votes > maxVotes {
+			maxVotes = candidate.Votes
+		}
+	}
+
+	results := []Result{}
+
+	for _, candidate := range candidates {
+		if candidate == nil || candidate.Id == target.Id || booked[candidate.Id] {
+			continue
+		}
+
+		candidateProfile := newProfile(candidate)
+
+		if !related(targetProfile, candidateProfile) {
+			continue
+		}
+
+		score := contentScore(targetProfile, candidateProfile)
+
+		if maxVotes > 0 {
+			score += popularityWeight * math.Log1p(float64(candidate.Votes)) / math.Log1p(float64(maxVotes))
+		}
+
+		// Ranking 1 is the top movie, 0 means the movie is not ranked
+		if candidate.Ranking > 0 {
+			score += rankingWeight / float64(candidate.Ranking)
+		}
+
+		if opts.Nearby[candidate.Id] {
+			score += nearbyBoost
+		}
+
+		if historyProfile != nil {
+			score += historyWeight * contentScore(*historyProfile, candidateProfile) / (sharedGenreWeight + sharedLanguageWeight + sharedCastWeight*maxSharedCast + sameDirectorWeight)
+		}
+
+		results = append(results, Result{Movie: candidate, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		return results[i].Movie.Id < results[j].Movie.Id
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
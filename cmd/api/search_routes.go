@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// searchIndexRefreshInterval is how often the catalog is pulled from MovieDB to
+// check whether the search index has to be rebuilt
+const searchIndexRefreshInterval = 5 * time.Minute
+
+const (
+	defaultSearchLimit       = 20
+	maxSearchLimit           = 100
+	defaultAutocompleteLimit = 8
+)
+
+// RefreshSearchIndex pulls the whole catalog from MovieDB and rebuilds the
+// search index if the catalog changed since the last build
+func (c *Config) RefreshSearchIndex(ctx context.Context) error {
+	if c.SearchIndex == nil {
+		return fmt.Errorf("search index is not configured")
+	}
+
+	response, err := c.MovieDB_service.GetAllMovies(ctx, &emptypb.Empty{})
+
+	if err != nil {
+		return fmt.Errorf("error getting all movies: %w", err)
+	}
+
+	if response == nil || response.MovieList == nil {
+		return fmt.Errorf("no movies found")
+	}
+
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(response.MovieList)
+
+	if err != nil {
+		return fmt.Errorf("error fingerprinting movie catalog: %w", err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	if fingerprint == c.SearchIndex.Fingerprint() {
+		return nil
+	}
+
+	c.SearchIndex.Build(response.MovieList.Movies, fingerprint)
+
+	log.Infof("search index rebuilt with %d movies", len(response.MovieList.Movies))
+
+	return nil
+}
+
+// StartSearchIndexer builds the search index right away and then keeps it in
+// sync with the catalog until ctx is cancelled
+func (c *Config) StartSearchIndexer(ctx context.Context) {
+	refresh := func() {
+		refreshCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		if err := c.RefreshSearchIndex(refreshCtx); err != nil {
+			log.Error("error refreshing search index: ", err)
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(searchIndexRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// queryList reads a comma separated or repeated query parameter
+func queryList(r *http.Request, name string) []string {
+	values := []string{}
+
+	for _, raw := range r.URL.Query()[name] {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values
+}
+
+// queryLimit reads the "limit" query parameter, falling back to def and capping
+// it at max
+func queryLimit(r *http.Request, def int, max int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+
+	if raw == "" {
+		return def, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+
+	if limit > max {
+		limit = max
+	}
+
+	return limit, nil
+}
+
+func (c *Config) SearchMovies(w http.ResponseWriter, r *http.Request) {
+	if c.SearchIndex == nil || !c.SearchIndex.Ready() {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Search index is not ready yet"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, err := queryLimit(r, defaultSearchLimit, maxSearchLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	results := c.SearchIndex.Search(r.URL.Query().Get("q"), search.Filters{
+		Languages: queryList(r, "language"),
+		Genres:    queryList(r, "genre"),
+	}, limit)
+
+	jsonResponse, err := utils.MarshalJSON(results)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
+
+func (c *Config) AutocompleteMovies(w http.ResponseWriter, r *http.Request) {
+	if c.SearchIndex == nil || !c.SearchIndex.Ready() {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Search index is not ready yet"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, err := queryLimit(r, defaultAutocompleteLimit, maxSearchLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	suggestions := c.SearchIndex.Autocomplete(r.URL.Query().Get("q"), limit)
+
+	jsonResponse, err := utils.MarshalJSON(map[string][]string{
+		"suggestions": suggestions,
+	})
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	redis "github.com/redis/go-redis/v9"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// Seat selection rules are checked against the seat matrix of the venue before
+// seats are held or booked. Seats are neighbours when they are in the same row
+// and in columns next to each other, a missing cell of the matrix or an aisle
+// of the venue rules separates them.
+
+// seatRuleNoOrphans names the rule against leaving single seats behind
+const seatRuleNoOrphans = "noOrphanSeats"
+
+// venueSeatRulesKey holds the seat selection rules of a venue
+func venueSeatRulesKey(venueID int32) string {
+	return fmt.Sprintf("venues:seat-rules:%d", venueID)
+}
+
+type SeatRules struct {
+	// AllowOrphanSeats turns the rule against leaving a single empty seat
+	// between taken seats off
+	AllowOrphanSeats bool `json:"allowOrphanSeats"`
+	// Aisles are the columns with an aisle after them, the seats on both sides
+	// of an aisle are not neighbours
+	Aisles []int32 `json:"aisles" validate:"dive,gt=0"`
+}
+
+// SeatRuleViolation is the answer when a selection breaks a seat rule
+type SeatRuleViolation struct {
+	Error string `json:"error"`
+	Rule  string `json:"rule"`
+	// SeatMatrixIDs are the seats the selection would leave behind
+	SeatMatrixIDs []int32 `json:"seatMatrixIds"`
+}
+
+// seatMap is the seat matrix of the venue of a showtime with the seats that
+// are booked or held for the showtime
+type seatMap struct {
+	slotID  int32
+	venueID int32
+	seats   map[int32]*pb.SeatMatrix
+	// cells lays the seats out by row and column
+	cells  map[int32]map[int32]*pb.SeatMatrix
+	booked map[int32]bool
+	held   map[int32]bool
+}
+
+// showtimeSeatMap reads the seat map of a showtime, nil when the venue has no
+// seat matrix
+func (c *Config) showtimeSeatMap(ctx context.Context, slotID int32, venueID int32) (*seatMap, error) {
+	matrix, err := c.MovieDB_service.GetSeatMatrix(ctx, &pb.GetSeatMatrixRequest{
+		Venueid: venueID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting seat matrix: %w", err)
+	}
+
+	if len(matrix.GetSeats()) == 0 {
+		return nil, nil
+	}
+
+	booked, err := c.MovieDB_service.GetBookedSeats(ctx, &pb.GetBookedSeatsRequest{
+		MovieTimeSlotId: slotID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting booked seats: %w", err)
+	}
+
+	held, err := c.heldSeatIDs(ctx, slotID)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading held seats: %w", err)
+	}
+
+	seats := &seatMap{
+		slotID:  slotID,
+		venueID: venueID,
+		seats:   map[int32]*pb.SeatMatrix{},
+		cells:   map[int32]map[int32]*pb.SeatMatrix{},
+		booked:  map[int32]bool{},
+		held:    held,
+	}
+
+	for _, seat := range matrix.GetSeats() {
+		seats.seats[seat.Id] = seat
+
+		if seats.cells[seat.Row] == nil {
+			seats.cells[seat.Row] = map[int32]*pb.SeatMatrix{}
+		}
+
+		seats.cells[seat.Row][seat.Column] = seat
+	}
+
+	for _, seat := range booked.GetBookedSeats() {
+		if seat.SeatMatrixID > 0 {
+			seats.booked[seat.SeatMatrixID] = true
+		} else if id, ok := seats.seatID(seat.SeatNumber); ok {
+			seats.booked[id] = true
+		}
+	}
+
+	return seats, nil
+}
+
+// seatID finds a seat by its seat number
+func (m *seatMap) seatID(seatNumber string) (int32, bool) {
+	if seatNumber == "" {
+		return 0, false
+	}
+
+	for id, seat := range m.seats {
+		if seat.SeatNumber == seatNumber {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// taken reports whether a seat is booked or held
+func (m *seatMap) taken(seatID int32) bool {
+	return m.booked[seatID] || m.held[seatID]
+}
+
+// unknown returns the seat ids that are not seats of the venue
+func (m *seatMap) unknown(seatIDs []int32) []int32 {
+	var unknown []int32
+
+	for _, seatID := range seatIDs {
+		if m.seats[seatID] == nil {
+			unknown = append(unknown, seatID)
+		}
+	}
+
+	return unknown
+}
+
+// neighbour returns the seat next to seat in direction, -1 for the left and 1
+// for the right, nil when a missing cell or an aisle is next to the seat
+func (m *seatMap) neighbour(seat *pb.SeatMatrix, direction int32, aisles map[int32]bool) *pb.SeatMatrix {
+	if (direction > 0 && aisles[seat.Column]) || (direction < 0 && aisles[seat.Column-1]) {
+		return nil
+	}
+
+	return m.cells[seat.Row][seat.Column+direction]
+}
+
+// orphanSeats returns the empty seats that selecting seatIDs would leave on
+// their own between taken seats. Seats that were on their own already are not
+// the doing of the selection and are left out.
+func (m *seatMap) orphanSeats(rules SeatRules, seatIDs []int32) []*pb.SeatMatrix {
+	aisles := make(map[int32]bool, len(rules.Aisles))
+
+	for _, column := range rules.Aisles {
+		aisles[column] = true
+	}
+
+	selected := make(map[int32]bool, len(seatIDs))
+
+	for _, seatID := range seatIDs {
+		selected[seatID] = true
+	}
+
+	occupied := func(seat *pb.SeatMatrix) bool {
+		return seat != nil && (selected[seat.Id] || m.taken(seat.Id))
+	}
+
+	found := map[int32]bool{}
+	var orphans []*pb.SeatMatrix
+
+	for _, seatID := range seatIDs {
+		seat := m.seats[seatID]
+
+		if seat == nil {
+			continue
+		}
+
+		for _, direction := range []int32{-1, 1} {
+			next := m.neighbour(seat, direction, aisles)
+
+			if next == nil || occupied(next) || found[next.Id] {
+				continue
+			}
+
+			if occupied(m.neighbour(next, direction, aisles)) {
+				found[next.Id] = true
+				orphans = append(orphans, next)
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Row != orphans[j].Row {
+			return orphans[i].Row < orphans[j].Row
+		}
+
+		return orphans[i].Column < orphans[j].Column
+	})
+
+	return orphans
+}
+
+// seatLabel names a seat the way the venue does, by row and column when the
+// seat has no number
+func seatLabel(seat *pb.SeatMatrix) string {
+	if seat.SeatNumber != "" {
+		return seat.SeatNumber
+	}
+
+	return fmt.Sprintf("row %d seat %d", seat.Row, seat.Column)
+}
+
+// checkSeatRules returns why selecting seatIDs breaks the seat rules of the
+// venue, nil when it does not
+func (m *seatMap) checkSeatRules(rules SeatRules, seatIDs []int32) *SeatRuleViolation {
+	if rules.AllowOrphanSeats {
+		return nil
+	}
+
+	orphans := m.orphanSeats(rules, seatIDs)
+
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	violation := &SeatRuleViolation{Rule: seatRuleNoOrphans}
+	labels := make([]string, len(orphans))
+
+	for i, seat := range orphans {
+		violation.SeatMatrixIDs = append(violation.SeatMatrixIDs, seat.Id)
+		labels[i] = seatLabel(seat)
+	}
+
+	if len(orphans) == 1 {
+		violation.Error = fmt.Sprintf("Seat %s would be left empty on its own between taken seats, pick it as well or move the selection over by one seat", labels[0])
+	} else {
+		violation.Error = fmt.Sprintf("Seats %s would each be left empty on their own between taken seats, pick them as well or move the selection over by one seat", strings.Join(labels, ", "))
+	}
+
+	return violation
+}
+
+// venueSeatRules returns the seat rules of a venue, venues without rules of
+// their own do not allow orphan seats and have no aisles
+func (c *Config) venueSeatRules(ctx context.Context, venueID int32) (SeatRules, error) {
+	var rules SeatRules
+
+	if c.RedisClient == nil {
+		return rules, nil
+	}
+
+	encoded, err := c.RedisClient.Get(ctx, venueSeatRulesKey(venueID)).Bytes()
+
+	if err == redis.Nil {
+		return rules, nil
+	}
+
+	if err != nil {
+		return rules, err
+	}
+
+	err = json.Unmarshal(encoded, &rules)
+
+	return rules, err
+}
+
+// checkSelection checks seats picked for a showtime against the seat matrix
+// and the seat rules of the venue. It writes the error response and returns
+// false when the seats cannot be picked.
+func (c *Config) checkSelection(w http.ResponseWriter, r *http.Request, seats *seatMap, seatIDs []int32) bool {
+	if unknown := seats.unknown(seatIDs); len(unknown) > 0 {
+		writeJSON(w, http.StatusBadRequest, SeatHoldConflict{Error: "Some of the seats are not seats of the venue", SeatMatrixIDs: unknown})
+		return false
+	}
+
+	rules, err := c.venueSeatRules(r.Context(), seats.venueID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading seat rules: %v"}`, err), http.StatusInternalServerError)
+		return false
+	}
+
+	if violation := seats.checkSeatRules(rules, seatIDs); violation != nil {
+		writeJSON(w, http.StatusBadRequest, violation)
+		return false
+	}
+
+	return true
+}
+
+func (c *Config) AdminGetSeatRules(w http.ResponseWriter, r *http.Request) {
+	venueID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := c.venueSeatRules(r.Context(), venueID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading seat rules: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if rules.Aisles == nil {
+		rules.Aisles = []int32{}
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (c *Config) AdminUpdateSeatRules(w http.ResponseWriter, r *http.Request) {
+	venueID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	var requestBody SeatRules
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	for _, column := range requestBody.Aisles {
+		if column <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error": "aisles must be columns of the venue"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Seat rules are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	sort.Slice(requestBody.Aisles, func(i, j int) bool { return requestBody.Aisles[i] < requestBody.Aisles[j] })
+
+	encoded, err := json.Marshal(requestBody)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling seat rules: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.RedisClient.Set(r.Context(), venueSeatRulesKey(venueID), encoded, 0).Err(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error saving seat rules: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, requestBody)
+}
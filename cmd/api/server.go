@@ -1,7 +1,9 @@
 package api
 
 import (
+	"expvar"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -10,16 +12,49 @@ import (
 
 	validator "github.com/go-playground/validator/v10"
 	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
+	"github.com/kartik7120/booking_broker-service/cmd/api/graph"
 	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/moderation"
 	ps "github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
 )
 
+// The routes from before /v1 are kept as deprecated aliases until the sunset
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// legacy marks a pre /v1 route as a deprecated alias of successor
+func legacy(successor string) func(http.Handler) http.Handler {
+	return utils.Deprecated(successor, legacyDeprecatedAt, legacySunset)
+}
+
+// legacyPrefix marks the routes below a pre /v1 prefix as deprecated aliases
+// of the same routes below /v1
+func legacyPrefix() func(http.Handler) http.Handler {
+	return utils.DeprecatedPrefix("/v1", legacyDeprecatedAt, legacySunset)
+}
+
 type Config struct {
 	MovieDB_service pb.MovieDBServiceClient
 	Payment_service ps.PaymentServiceClient
 	Auth_Service    at.AuthServiceClient
 	Validator       *validator.Validate
 	RedisClient     *redis.Client
+	SearchIndex     *search.Index
+	Trending        *TrendingRanking
+	ReviewFilter    *moderation.Filter
+	// PaymentWebhookSecret verifies the signature of payment webhooks, they
+	// are refused when it is empty
+	PaymentWebhookSecret string
+	// CheckoutRetryURL is the page a failed checkout is retried on, the
+	// showtime and the seats are added to its query. No retry email is sent
+	// when it is empty.
+	CheckoutRetryURL string
+	// Mailer sends emails, utils.SendMail when nil
+	Mailer func(utils.SendMailStruct) error
 }
 
 func (c *Config) Routes() http.Handler {
@@ -28,8 +63,8 @@ func (c *Config) Routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*", "http://127.0.0.1:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag", "Deprecation", "Sunset"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -43,28 +78,192 @@ func (c *Config) Routes() http.Handler {
 		w.Write([]byte("Welcome to the booking broker service"))
 	})
 
-	mux.Get("/getupcomingmovies/{date}", c.GetUpcomingMovies)
-	mux.Post("/getnowplayingmovies", c.GetNowPlayingMovies)
-	mux.Get("/getMovie/{id}", c.GetMovieDetails)
-	mux.Post("/getAllMovieReview/{id}", c.GetMovieReviews)
-	mux.Post("/addReview/{id}", c.AddMovieReview)
-	mux.Post("/getMovieTimeSlots", c.GetMovieTimeSlots)
-	mux.Post("/GetBookedSeats", c.GetBookedSeats)
-	mux.Post("/BookSeats", c.BookSeats)
-	mux.Post("/GetSeatMatrix", c.GetSeatMatrix)
-	mux.Post("/webhook/events", c.HandleWebhookEvents)
-	mux.Get("/getIdempotentKey", c.GetIdempotentKey)
-	mux.Get("/isValidIdempotentKey", c.IsValidIdempotentKey)
-	mux.Post("/commitIdempotentKey", c.CommitIdempotentKey)
-	mux.Post("/createCustomer", c.Create_Customer)
-	mux.Post("/createOrder", c.CreateOrder)
-	mux.Post("/createPaymentLink", c.CreatePaymentLink)
-	mux.Get("/validateToken", c.ValidateToken)
-	mux.Post("/generateOTP", c.GenerateOTP)
-	mux.Post("/validateOTP", c.ValidateOTP)
-	mux.Post("/registerUser", c.RegisterUser)
-	mux.Post("/loginUser", c.Login)
-	mux.Get("/checkIfUserExists/{email}", c.CheckIfUserExists)
+	// The API description changes only with a deploy
+	mux.Group(func(meta chi.Router) {
+		meta.Use(utils.CacheControl(utils.CachePublic))
+		meta.Use(utils.ETag)
+
+		meta.Get("/openapi.json", c.GetOpenAPI)
+		meta.Get("/docs", c.GetDocs)
+	})
+
+	// Public catalog, the same for every client so CDNs may cache it
+	mux.Group(func(catalog chi.Router) {
+		catalog.Use(utils.CacheControl(utils.CachePublic))
+		catalog.Use(utils.ETag)
+
+		catalog.Get("/v1/movies/upcoming", c.GetUpcomingMovies)
+		catalog.With(utils.BindParams(nil)).Get("/v1/movies/now-playing", c.GetNowPlayingMovies)
+		catalog.Get("/v1/movies/search", c.SearchMovies)
+		catalog.Get("/v1/movies/autocomplete", c.AutocompleteMovies)
+		catalog.Get("/v1/movies/trending", c.GetTrendingMovies)
+		catalog.Get("/v1/movies/{id}", c.GetMovieDetails)
+		catalog.With(utils.BindParams(nil)).Get("/v1/movies/{id}/reviews", c.GetMovieReviews)
+		catalog.Get("/v1/movies/{id}/reviews/aggregates", c.GetMovieReviewAggregates)
+		catalog.With(utils.BindParams(map[string]string{"id": "movieId"})).Get("/v1/movies/{id}/showtimes", c.GetMovieTimeSlots)
+		catalog.Get("/v1/people/{id}", c.GetPerson)
+		catalog.Get("/v1/releases", c.GetReleasesCalendar)
+
+		catalog.With(legacy("/v1/movies/upcoming?date={date}")).Get("/getupcomingmovies/{date}", c.GetUpcomingMovies)
+		catalog.With(legacy("/v1/releases")).Get("/getReleasesCalendar", c.GetReleasesCalendar)
+		catalog.With(legacy("/v1/movies/now-playing")).Post("/getnowplayingmovies", c.GetNowPlayingMovies)
+		catalog.With(legacy("/v1/movies/search")).Get("/searchMovies", c.SearchMovies)
+		catalog.With(legacy("/v1/movies/autocomplete")).Get("/autocompleteMovies", c.AutocompleteMovies)
+		catalog.With(legacy("/v1/movies/{id}")).Get("/getMovie/{id}", c.GetMovieDetails)
+		catalog.With(legacy("/v1/people/{id}")).Get("/getPerson/{id}", c.GetPerson)
+		catalog.With(legacy("/v1/movies/trending")).Get("/getTrendingMovies", c.GetTrendingMovies)
+		catalog.With(legacy("/v1/movies/{id}/reviews")).Post("/getAllMovieReview/{id}", c.GetMovieReviews)
+		catalog.With(legacy("/v1/movies/{movieId}/showtimes")).Post("/getMovieTimeSlots", c.GetMovieTimeSlots)
+	})
+
+	mux.Group(func(feeds chi.Router) {
+		feeds.Use(utils.CacheControl(utils.CachePublicLong))
+		feeds.Use(utils.ETag)
+
+		feeds.Get("/v1/releases.ics", c.GetReleasesCalendarICS)
+
+		feeds.With(legacy("/v1/releases.ics")).Get("/getReleasesCalendar.ics", c.GetReleasesCalendarICS)
+	})
+
+	// Live seat data, clients keep a copy but revalidate it on every poll
+	mux.Group(func(seats chi.Router) {
+		seats.Use(utils.CacheControl(utils.CacheRevalidate))
+		seats.Use(utils.ETag)
+
+		seats.With(utils.BindParams(map[string]string{"id": "movieTimeSlotId"})).Get("/v1/showtimes/{id}/seats", c.GetBookedSeats)
+		seats.Get("/v1/showtimes/availability", c.GetShowtimeAvailability)
+		seats.With(utils.BindParams(map[string]string{"id": "venueId"})).Get("/v1/venues/{id}/seats", c.GetSeatMatrix)
+
+		seats.With(legacy("/v1/showtimes/{movieTimeSlotId}/seats")).Post("/GetBookedSeats", c.GetBookedSeats)
+		seats.With(legacy("/v1/venues/{venueId}/seats")).Post("/GetSeatMatrix", c.GetSeatMatrix)
+		seats.With(legacy("/v1/showtimes/availability")).Post("/getShowtimeAvailability", c.GetShowtimeAvailability)
+	})
+
+	// Personalised for the signed in user
+	mux.Group(func(personal chi.Router) {
+		personal.Use(c.OptionalAuth)
+		personal.Use(utils.CacheControl(utils.CachePrivate))
+		personal.Use(utils.ETag)
+
+		personal.Get("/v1/movies/{id}/similar", c.GetSimilarMovies)
+
+		personal.With(legacy("/v1/movies/{id}/similar")).Get("/getSimilarMovies/{id}", c.GetSimilarMovies)
+	})
+
+	// Auth, booking and payment endpoints are never cached
+	mux.Group(func(private chi.Router) {
+		private.Use(utils.CacheControl(utils.CacheNoStore))
+
+		private.With(c.OptionalAuth).Post("/v1/bookings", c.BookSeats)
+		private.Post("/v1/webhooks/payments", c.HandleWebhookEvents)
+		private.Post("/v1/idempotency-keys", c.GetIdempotentKey)
+		private.With(utils.BindParams(map[string]string{"key": "key"})).Get("/v1/idempotency-keys/{key}", c.IsValidIdempotentKey)
+		private.With(utils.BindParams(map[string]string{"key": "idempotentKey"})).Post("/v1/idempotency-keys/{key}/commit", c.CommitIdempotentKey)
+		private.Post("/v1/customers", c.Create_Customer)
+		private.Post("/v1/orders", c.CreateOrder)
+		private.Post("/v1/payment-links", c.CreatePaymentLink)
+		private.Get("/v1/auth/token", c.ValidateToken)
+		private.Post("/v1/auth/otp", c.GenerateOTP)
+		private.Post("/v1/auth/otp/verify", c.ValidateOTP)
+		private.Post("/v1/auth/login", c.Login)
+		private.Post("/v1/users", c.RegisterUser)
+		private.Get("/v1/users/{email}/exists", c.CheckIfUserExists)
+
+		private.With(legacy("/v1/bookings"), c.OptionalAuth).Post("/BookSeats", c.BookSeats)
+		private.With(legacy("/v1/webhooks/payments")).Post("/webhook/events", c.HandleWebhookEvents)
+		private.With(legacy("/v1/idempotency-keys")).Get("/getIdempotentKey", c.GetIdempotentKey)
+		private.With(legacy("/v1/idempotency-keys/{key}"), utils.BindParams(nil)).Get("/isValidIdempotentKey", c.IsValidIdempotentKey)
+		private.With(legacy("/v1/idempotency-keys/{key}/commit")).Post("/commitIdempotentKey", c.CommitIdempotentKey)
+		private.With(legacy("/v1/customers")).Post("/createCustomer", c.Create_Customer)
+		private.With(legacy("/v1/orders")).Post("/createOrder", c.CreateOrder)
+		private.With(legacy("/v1/payment-links")).Post("/createPaymentLink", c.CreatePaymentLink)
+		private.With(legacy("/v1/auth/token")).Get("/validateToken", c.ValidateToken)
+		private.With(legacy("/v1/auth/otp")).Post("/generateOTP", c.GenerateOTP)
+		private.With(legacy("/v1/auth/otp/verify")).Post("/validateOTP", c.ValidateOTP)
+		private.With(legacy("/v1/users")).Post("/registerUser", c.RegisterUser)
+		private.With(legacy("/v1/auth/login")).Post("/loginUser", c.Login)
+		private.With(legacy("/v1/users/{email}/exists")).Get("/checkIfUserExists/{email}", c.CheckIfUserExists)
+
+		// Reviews are written as the signed in user
+		private.Group(func(reviews chi.Router) {
+			reviews.Use(c.RequireAuth)
+
+			reviews.Post("/v1/movies/{id}/reviews", c.AddMovieReview)
+			reviews.Put("/v1/movies/{id}/reviews/{reviewId}", c.UpdateMovieReview)
+			reviews.Delete("/v1/movies/{id}/reviews/{reviewId}", c.DeleteMovieReview)
+			reviews.Put("/v1/movies/{id}/reviews/{reviewId}/vote", c.VoteOnReview)
+			reviews.Delete("/v1/movies/{id}/reviews/{reviewId}/vote", c.RetractReviewVote)
+
+			reviews.With(legacy("/v1/movies/{id}/reviews")).Post("/addReview/{id}", c.AddMovieReview)
+		})
+
+		// Seats are held for the signed in user until they are paid for
+		private.Group(func(holds chi.Router) {
+			holds.Use(c.RequireAuth)
+
+			holds.Post("/v1/showtimes/{id}/holds", c.HoldSeats)
+			holds.Post("/v1/showtimes/{id}/best-seats", c.HoldBestSeats)
+			holds.Get("/v1/showtimes/{id}/holds/{holdId}", c.GetSeatHold)
+			holds.Post("/v1/showtimes/{id}/holds/{holdId}/extend", c.ExtendSeatHold)
+			holds.Delete("/v1/showtimes/{id}/holds/{holdId}", c.ReleaseSeatHold)
+		})
+
+		// Checkouts pay for the seats of a hold of the signed in user
+		private.Group(func(checkouts chi.Router) {
+			checkouts.Use(c.RequireAuth)
+
+			checkouts.Post("/v1/checkouts", c.Checkout)
+			checkouts.Get("/v1/checkouts/{key}", c.GetCheckout)
+		})
+	})
+
+	// GraphQL gateway, a query may select the viewer so it is never cached
+	gateway := graph.NewHandler(&graph.Resolver{
+		MovieDB: c.MovieDB_service,
+		Payment: c.Payment_service,
+		Auth:    c.Auth_Service,
+	}, requestToken)
+
+	mux.Group(func(graphql chi.Router) {
+		graphql.Use(utils.CacheControl(utils.CacheNoStore))
+
+		graphql.Get("/graphql", gateway.ServeHTTP)
+		graphql.Post("/graphql", gateway.ServeHTTP)
+	})
+
+	mux.Route("/v1/admin", c.adminRoutes)
+	mux.With(legacyPrefix()).Route("/admin", c.adminRoutes)
 
 	return mux
 }
+
+func (c *Config) adminRoutes(admin chi.Router) {
+	admin.Use(c.RequireAuth)
+	admin.Use(c.RequireAdmin)
+	admin.Use(utils.CacheControl(utils.CacheNoStore))
+
+	admin.Post("/movie", c.AdminAddMovie)
+	admin.Put("/movie", c.AdminUpdateMovie)
+	admin.Delete("/movie/{id}", c.AdminDeleteMovie)
+	admin.Post("/venue", c.AdminAddVenue)
+	admin.Put("/venue", c.AdminUpdateVenue)
+	admin.Delete("/venue/{id}", c.AdminDeleteVenue)
+	admin.Post("/movieTimeSlot", c.AdminAddMovieTimeSlot)
+	admin.Put("/movieTimeSlot", c.AdminUpdateMovieTimeSlot)
+	admin.Delete("/movieTimeSlot/{id}", c.AdminDeleteMovieTimeSlot)
+	admin.Post("/seatMatrix", c.AdminAddSeatMatrix)
+	admin.Put("/seatMatrix", c.AdminUpdateSeatMatrix)
+	admin.Delete("/seatMatrix/{venueId}", c.AdminDeleteSeatMatrix)
+	admin.Delete("/seatMatrix/{venueId}/{seatId}", c.AdminDeleteSeatMatrix)
+	admin.Get("/metrics", expvar.Handler().ServeHTTP)
+	admin.Get("/checkouts/refunds-owed", c.AdminListRefundsOwed)
+	admin.Post("/checkouts/{key}/refunded", c.AdminMarkRefunded)
+	admin.Get("/reviews/pending", c.AdminListPendingReviews)
+	admin.Post("/reviews/pending/{id}/approve", c.AdminApprovePendingReview)
+	admin.Post("/reviews/pending/{id}/reject", c.AdminRejectPendingReview)
+	admin.Get("/reviews/moderation-log", c.AdminGetModerationLog)
+	admin.Get("/movie/{id}/review-settings", c.AdminGetReviewSettings)
+	admin.Put("/movie/{id}/review-settings", c.AdminUpdateReviewSettings)
+	admin.Get("/venue/{id}/seat-rules", c.AdminGetSeatRules)
+	admin.Put("/venue/{id}/seat-rules", c.AdminUpdateSeatRules)
+}
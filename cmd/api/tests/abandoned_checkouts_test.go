@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+func TestAbandonedCheckouts(t *testing.T) {
+	seats := make([]*pb.SeatMatrix, 0, 8)
+
+	for i := int32(1); i <= 8; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, SeatNumber: fmt.Sprintf("A%d", i), Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	mr := miniredis.RunT(t)
+	movieDB := newSeatMapMovieDB(seats)
+
+	var mails []utils.SendMailStruct
+
+	app := api.Config{
+		MovieDB_service:      movieDB,
+		Payment_service:      &checkoutPayments{},
+		Auth_Service:         acceptingAuth{},
+		Validator:            validator.New(),
+		RedisClient:          redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		CheckoutRetryURL:     "https://tickets.example.test/retry",
+		PaymentWebhookSecret: testWebhookSecret,
+		Mailer: func(mail utils.SendMailStruct) error {
+			mails = append(mails, mail)
+			return nil
+		},
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		if target == "/v1/webhooks/payments" {
+			signWebhook(request, body)
+		}
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+
+	checkout := func(t *testing.T, key, seatIDs string) string {
+		t.Helper()
+
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds", user, `{"venueId": 9, "seatMatrixIds": [`+seatIDs+`]}`)
+
+		var hold api.SeatHold
+
+		if err := json.Unmarshal(response.Body.Bytes(), &hold); err != nil || response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seats to be held, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/checkouts", user, `{"idempotentKey": "`+key+`", "movieTimeSlotId": 5, "holdId": "`+hold.ID+`"}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected the checkout to await payment, got %d: %s", response.Code, response.Body.String())
+		}
+
+		return hold.ID
+	}
+
+	state := func(t *testing.T, key string) api.Checkout {
+		t.Helper()
+
+		var decoded api.Checkout
+
+		response := serve(http.MethodGet, "/v1/checkouts/"+key, user, "")
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("Error decoding the checkout: %v: %s", err, response.Body.String())
+		}
+
+		return decoded
+	}
+
+	t.Run("Test if a failed payment releases the seats and emails a retry link", func(t *testing.T) {
+		holdID := checkout(t, "key-1", "1, 2")
+		webhook := paymentWebhook("payment.failed", "pay_1", map[string]string{"idempotentKey": "key-1"})
+
+		for delivery := 1; delivery <= 2; delivery++ {
+			if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+				t.Fatalf("Expected delivery %d to be taken, got %d: %s", delivery, response.Code, response.Body.String())
+			}
+		}
+
+		if failed := state(t, "key-1"); failed.Status != "failed" || failed.Error != "The payment failed" {
+			t.Errorf("Expected the checkout to fail, got %+v", failed)
+		}
+
+		if mr.Exists("seats:{5}:holds:"+holdID) || mr.Exists("seats:{5}:held:1") {
+			t.Errorf("Expected the hold to be released")
+		}
+
+		if len(mails) != 1 || !strings.Contains(mails[0].Text, "https://tickets.example.test/retry?movieTimeSlotId=5&seatMatrixIds=1%2C2&venueId=9") {
+			t.Errorf("Expected one retry email with the seats, got %+v", mails)
+		}
+	})
+
+	t.Run("Test if no retry link is sent for seats taken meanwhile", func(t *testing.T) {
+		mails = nil
+		checkout(t, "key-2", "4, 5")
+
+		// booked at the box office while the payment was open
+		movieDB.booked[5] = append(movieDB.booked[5], &pb.BookedSeats{SeatMatrixID: 5, IsBooked: true})
+
+		webhook := paymentWebhook("payment.cancelled", "pay_2", map[string]string{"order_id": "ord_key-2"})
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+			t.Fatalf("Expected the delivery to be taken, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if failed := state(t, "key-2"); failed.Status != "failed" || failed.Error != "The payment was cancelled" {
+			t.Errorf("Expected the checkout to fail, got %+v", failed)
+		}
+
+		if len(mails) != 0 {
+			t.Errorf("Expected no retry email, got %+v", mails)
+		}
+	})
+
+	t.Run("Test if overdue checkouts are swept", func(t *testing.T) {
+		mails = nil
+		holdID := checkout(t, "key-3", "6, 7, 8")
+
+		if err := app.SweepCheckouts(context.Background(), time.Now()); err != nil {
+			t.Fatalf("Error sweeping checkouts: %v", err)
+		}
+
+		if pending := state(t, "key-3"); pending.Status != "awaitingPayment" {
+			t.Fatalf("Expected a checkout within its payment window to be kept, got %s", pending.Status)
+		}
+
+		// the hold lasts another 10 minutes, the payment is overdue with it
+		if pending := state(t, "key-3"); pending.PaymentDueAt == nil || pending.PaymentDueAt.After(time.Now().Add(11*time.Minute)) {
+			t.Fatalf("Expected the payment to be due when the hold expires, got %v", pending.PaymentDueAt)
+		}
+
+		if err := app.SweepCheckouts(context.Background(), time.Now().Add(15*time.Minute)); err != nil {
+			t.Fatalf("Error sweeping checkouts: %v", err)
+		}
+
+		if failed := state(t, "key-3"); failed.Status != "failed" || failed.Error != "The payment was not made in time" {
+			t.Errorf("Expected the overdue checkout to fail, got %+v", failed)
+		}
+
+		if mr.Exists("seats:{5}:holds:" + holdID) {
+			t.Errorf("Expected the hold to be released")
+		}
+
+		if len(mails) != 1 {
+			t.Errorf("Expected a retry email, got %d", len(mails))
+		}
+
+		if members, _ := mr.ZMembers("checkouts:awaiting-payment"); len(members) != 0 {
+			t.Errorf("Expected no checkout left awaiting payment, got %v", members)
+		}
+	})
+
+	t.Run("Test if confirmed checkouts are not swept", func(t *testing.T) {
+		checkout(t, "key-4", "1, 2")
+
+		webhook := paymentWebhook("payment.succeeded", "pay_4", map[string]string{"idempotentKey": "key-4"})
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+			t.Fatalf("Expected the delivery to be taken, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if err := app.SweepCheckouts(context.Background(), time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Error sweeping checkouts: %v", err)
+		}
+
+		if confirmed := state(t, "key-4"); confirmed.Status != "confirmed" {
+			t.Errorf("Expected the checkout to stay confirmed, got %s", confirmed.Status)
+		}
+
+		webhook = paymentWebhook("payment.failed", "pay_4", map[string]string{"idempotentKey": "key-4"})
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK || state(t, "key-4").Status != "confirmed" {
+			t.Errorf("Expected a late failure to leave the checkout confirmed, got %d", response.Code)
+		}
+	})
+}
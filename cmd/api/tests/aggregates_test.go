@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+func TestReviewAggregates(t *testing.T) {
+	mr := miniredis.RunT(t)
+	movieDB := newReviewStoreMovieDB()
+
+	seed := []*pb.Review{
+		{MovieID: 7, UserID: 1, Rating: 5, Title: "Stunning visuals", Comment: "The visuals and the soundtrack carry it."},
+		{MovieID: 7, UserID: 2, Rating: 4, Title: "Great soundtrack", Comment: "A great soundtrack, the pacing drags."},
+		{MovieID: 7, UserID: 3, Rating: 2, Title: "Too long", Comment: "The pacing killed it for me."},
+		{MovieID: 8, UserID: 1, Rating: 1, Title: "Other movie", Comment: "Not counted."},
+	}
+
+	for _, review := range seed {
+		movieDB.AddReview(context.Background(), review)
+	}
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	aggregates := func(t *testing.T) api.ReviewAggregates {
+		t.Helper()
+
+		response := serve(http.MethodGet, "/v1/movies/7/reviews/aggregates", "", "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var aggregates api.ReviewAggregates
+
+		if err := json.Unmarshal(response.Body.Bytes(), &aggregates); err != nil {
+			t.Fatalf("Error decoding aggregates: %v", err)
+		}
+
+		return aggregates
+	}
+
+	histogram := func(aggregates api.ReviewAggregates) []int64 {
+		var counts []int64
+
+		for _, bucket := range aggregates.Histogram {
+			counts = append(counts, bucket.Count)
+		}
+
+		return counts
+	}
+
+	keywords := func(aggregates api.ReviewAggregates) map[string]int64 {
+		counts := map[string]int64{}
+
+		for _, keyword := range aggregates.Keywords {
+			counts[keyword.Keyword] = keyword.Count
+		}
+
+		return counts
+	}
+
+	t.Run("Test if aggregates are computed from the reviews", func(t *testing.T) {
+		got := aggregates(t)
+
+		if got.ReviewCount != 3 || got.AverageRating != 3.67 {
+			t.Errorf("Expected 3 reviews averaging 3.67, got %d averaging %v", got.ReviewCount, got.AverageRating)
+		}
+
+		if want := []int64{1, 1, 0, 1, 0}; !reflect.DeepEqual(histogram(got), want) {
+			t.Errorf("Expected the histogram %v from 5 stars down, got %v", want, histogram(got))
+		}
+
+		if len(got.ReviewsByMonth) != 1 || got.ReviewsByMonth[0] != (api.ReviewPeriod{Month: "2023-11", Count: 3}) {
+			t.Errorf("Expected 3 reviews in 2023-11, got %+v", got.ReviewsByMonth)
+		}
+
+		if len(got.Keywords) == 0 || got.Keywords[0].Keyword != "pacing" || got.Keywords[0].Count != 2 {
+			t.Errorf("Expected pacing to lead the keywords, got %+v", got.Keywords)
+		}
+
+		if words := keywords(got); words["the"] != 0 || words["counted"] != 0 {
+			t.Errorf("Expected no stop words nor words of other movies, got %+v", got.Keywords)
+		}
+	})
+
+	t.Run("Test if aggregates are cached", func(t *testing.T) {
+		// a review MovieDB got behind the broker's back
+		movieDB.AddReview(context.Background(), &pb.Review{MovieID: 7, UserID: 9, Rating: 1, Title: "Bad", Comment: "Bad"})
+
+		if got := aggregates(t); got.ReviewCount != 3 {
+			t.Errorf("Expected the cached 3 reviews, got %d", got.ReviewCount)
+		}
+
+		mr.Del("reviews:aggregates:7")
+
+		if got := aggregates(t); got.ReviewCount != 4 {
+			t.Errorf("Expected the 4 reviews once the cache is gone, got %d", got.ReviewCount)
+		}
+	})
+
+	t.Run("Test if reviews posted through the broker update the aggregates", func(t *testing.T) {
+		user := testToken(map[string]any{"user_id": 4, "role": "user"})
+
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", user, `{"title": "Gorgeous", "comment": "Gorgeous visuals and a moving soundtrack.", "rating": 5}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		got := aggregates(t)
+
+		if got.ReviewCount != 5 || got.AverageRating != 3.4 {
+			t.Errorf("Expected 5 reviews averaging 3.4, got %d averaging %v", got.ReviewCount, got.AverageRating)
+		}
+
+		if words := keywords(got); words["soundtrack"] != 3 || words["gorgeous"] != 1 {
+			t.Errorf("Expected the keywords of the new review, got %+v", got.Keywords)
+		}
+
+		response = serve(http.MethodPut, "/v1/movies/7/reviews/6", user, `{"rating": 3}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if got := aggregates(t); !reflect.DeepEqual(histogram(got), []int64{1, 1, 1, 1, 1}) || got.ReviewCount != 5 {
+			t.Errorf("Expected the edit to move a review from 5 to 3 stars, got %v", histogram(got))
+		}
+
+		response = serve(http.MethodDelete, "/v1/movies/7/reviews/6", user, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		got = aggregates(t)
+
+		if got.ReviewCount != 4 || !reflect.DeepEqual(histogram(got), []int64{1, 1, 0, 1, 1}) {
+			t.Errorf("Expected the deleted review to be taken out, got %d reviews and %v", got.ReviewCount, histogram(got))
+		}
+
+		if words := keywords(got); words["gorgeous"] != 0 || words["soundtrack"] != 2 {
+			t.Errorf("Expected the keywords of the deleted review to be taken out, got %+v", got.Keywords)
+		}
+	})
+
+	t.Run("Test if aggregates are computed without Redis", func(t *testing.T) {
+		uncached := api.Config{MovieDB_service: movieDB}
+
+		request := httptest.NewRequest(http.MethodGet, "/v1/movies/8/reviews/aggregates?keywords=1", nil)
+		response := httptest.NewRecorder()
+		uncached.Routes().ServeHTTP(response, request)
+
+		var got api.ReviewAggregates
+
+		if err := json.Unmarshal(response.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Error decoding aggregates: %v", err)
+		}
+
+		if got.ReviewCount != 1 || got.AverageRating != 1 || len(got.Keywords) != 1 {
+			t.Errorf("Expected the one review of movie 8 and one keyword, got %+v", got)
+		}
+	})
+}
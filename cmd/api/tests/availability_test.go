@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// availabilityMovieDB only has a seat matrix for venue 9 and counts the seat
+// matrix calls that reach the backend
+type availabilityMovieDB struct {
+	*seatMapMovieDB
+	seatMatrixCalls atomic.Int32
+}
+
+func (m *availabilityMovieDB) GetSeatMatrix(ctx context.Context, in *pb.GetSeatMatrixRequest, opts ...grpc.CallOption) (*pb.GetSeatMatrixResponse, error) {
+	m.seatMatrixCalls.Add(1)
+
+	if in.Venueid != 9 {
+		return &pb.GetSeatMatrixResponse{Status: 404}, nil
+	}
+
+	return m.seatMapMovieDB.GetSeatMatrix(ctx, in, opts...)
+}
+
+func TestShowtimeAvailability(t *testing.T) {
+	seats := make([]*pb.SeatMatrix, 0, 4)
+
+	for i := int32(1); i <= 4; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, Row: 1, Column: i, Price: 100 * i, Type: pb.SeatType_NORMAL})
+	}
+
+	mr := miniredis.RunT(t)
+	movieDB := &availabilityMovieDB{seatMapMovieDB: newSeatMapMovieDB(seats)}
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Validator:       validator.New(),
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	availability := func(t *testing.T, showtimes string) []api.ShowtimeAvailability {
+		t.Helper()
+
+		request := httptest.NewRequest(http.MethodGet, "/v1/showtimes/availability?showtime="+showtimes, nil)
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var summaries []api.ShowtimeAvailability
+
+		if err := json.Unmarshal(response.Body.Bytes(), &summaries); err != nil {
+			t.Fatalf("Error decoding the availability: %v", err)
+		}
+
+		return summaries
+	}
+
+	t.Run("Test if more showtimes than the batch limit are rejected", func(t *testing.T) {
+		refs := make([]string, 0, 51)
+
+		for i := 1; i <= 51; i++ {
+			refs = append(refs, fmt.Sprintf(`{"movieTimeSlotId": %d, "venueId": 9}`, i))
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/getShowtimeAvailability", strings.NewReader(`{"showtimes": [`+strings.Join(refs, ",")+`]}`))
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for 51 showtimes, got %d", response.Code)
+		}
+
+		if calls := movieDB.seatMatrixCalls.Load(); calls != 0 {
+			t.Errorf("Expected no backend call, got %d", calls)
+		}
+	})
+
+	t.Run("Test if a showtime that fails does not fail the others", func(t *testing.T) {
+		summaries := availability(t, "5:9,6:8")
+
+		if len(summaries) != 2 {
+			t.Fatalf("Expected 2 summaries, got %d", len(summaries))
+		}
+
+		if summaries[0].Error != "" || summaries[0].AvailableSeats != 4 || summaries[0].MinPrice != 100 || summaries[0].MaxPrice != 400 {
+			t.Errorf("Expected showtime 5 to be summarised, got %+v", summaries[0])
+		}
+
+		if summaries[1].Error != "no seat matrix could be found for venue 8" || summaries[1].MovieTimeSlotID != 6 {
+			t.Errorf("Expected showtime 6 to carry its error, got %+v", summaries[1])
+		}
+
+		if mr.Exists("availability:6:8") {
+			t.Errorf("Expected the failed showtime not to be cached")
+		}
+	})
+
+	t.Run("Test if summaries are cached for 30 seconds", func(t *testing.T) {
+		if ttl := mr.TTL("availability:5:9"); ttl <= 0 || ttl > 30*time.Second {
+			t.Fatalf("Expected the summary to be cached for at most 30s, got %v", ttl)
+		}
+
+		calls := movieDB.seatMatrixCalls.Load()
+		movieDB.booked[5] = append(movieDB.booked[5], &pb.BookedSeats{SeatMatrixID: 1, IsBooked: true})
+
+		if cached := availability(t, "5:9"); cached[0].AvailableSeats != 4 {
+			t.Errorf("Expected the cached summary, got %+v", cached[0])
+		}
+
+		if movieDB.seatMatrixCalls.Load() != calls {
+			t.Errorf("Expected the cached summary to make no backend call")
+		}
+
+		mr.FastForward(31 * time.Second)
+
+		if fresh := availability(t, "5:9"); fresh[0].AvailableSeats != 3 || fresh[0].MinPrice != 200 {
+			t.Errorf("Expected the booking to show once the cache expired, got %+v", fresh[0])
+		}
+	})
+}
+
+func TestShowtimeAvailabilityFreeSeats(t *testing.T) {
+	seats := []*pb.SeatMatrix{
+		{Id: 1, Row: 1, Column: 1, Price: 0, Type: pb.SeatType_NORMAL},
+		{Id: 2, Row: 1, Column: 2, Price: 150, Type: pb.SeatType_NORMAL},
+	}
+
+	app := api.Config{MovieDB_service: &availabilityMovieDB{seatMapMovieDB: newSeatMapMovieDB(seats)}, Validator: validator.New()}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/showtimes/availability?showtime=5:9", nil)
+	response := httptest.NewRecorder()
+	app.Routes().ServeHTTP(response, request)
+
+	var summaries []api.ShowtimeAvailability
+
+	if err := json.Unmarshal(response.Body.Bytes(), &summaries); err != nil || len(summaries) != 1 {
+		t.Fatalf("Expected one summary, got %d: %s", response.Code, response.Body.String())
+	}
+
+	if summaries[0].MinPrice != 0 || summaries[0].MaxPrice != 150 {
+		t.Errorf("Expected the free seat to be the minimum, got %+v", summaries[0])
+	}
+}
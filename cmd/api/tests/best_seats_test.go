@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// bestSeats is the part of a best seats hold the tests look at
+type bestSeats struct {
+	ID            string  `json:"id"`
+	SeatMatrixIDs []int32 `json:"seatMatrixIds"`
+	TotalPrice    int32   `json:"totalPrice"`
+	Together      bool    `json:"together"`
+}
+
+func TestBestSeats(t *testing.T) {
+	// five rows of eight seats, the first row is at the screen and the last
+	// row is VIP
+	var seats []*pb.SeatMatrix
+
+	for row := int32(1); row <= 5; row++ {
+		for column := int32(1); column <= 8; column++ {
+			seat := &pb.SeatMatrix{Id: row*10 + column, Row: row, Column: column, Price: 200, Type: pb.SeatType_NORMAL}
+
+			if row == 5 {
+				seat.Price, seat.Type = 400, pb.SeatType_VIP
+			}
+
+			seats = append(seats, seat)
+		}
+	}
+
+	mr := miniredis.RunT(t)
+
+	app := api.Config{
+		MovieDB_service: newSeatMapMovieDB(seats),
+		Auth_Service:    acceptingAuth{},
+		Validator:       validator.New(),
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+
+	pick := func(t *testing.T, body string) (bestSeats, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		request := httptest.NewRequest(http.MethodPost, "/v1/showtimes/5/best-seats", strings.NewReader(body))
+		request.Header.Set("Authorization", user)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		var decoded bestSeats
+
+		if response.Code == http.StatusCreated {
+			if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("Error decoding the hold: %v", err)
+			}
+
+			sort.Slice(decoded.SeatMatrixIDs, func(i, j int) bool { return decoded.SeatMatrixIDs[i] < decoded.SeatMatrixIDs[j] })
+		}
+
+		return decoded, response
+	}
+
+	t.Run("Test if the middle of a row a little back is picked", func(t *testing.T) {
+		best, response := pick(t, `{"venueId": 9, "count": 2, "seatType": "normal"}`)
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if len(best.SeatMatrixIDs) != 2 || best.SeatMatrixIDs[0] != 34 || best.SeatMatrixIDs[1] != 35 || !best.Together {
+			t.Errorf("Expected the middle of the third row, got %v", best.SeatMatrixIDs)
+		}
+
+		if best.TotalPrice != 400 {
+			t.Errorf("Expected a total of 400, got %d", best.TotalPrice)
+		}
+
+		if !mr.Exists("seats:{5}:holds:" + best.ID) {
+			t.Errorf("Expected the seats to be held")
+		}
+	})
+
+	t.Run("Test if the seat type and the price are kept to", func(t *testing.T) {
+		if _, response := pick(t, `{"venueId": 9, "count": 2, "seatType": "VIP", "maxPrice": 300}`); response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 when no seat is cheap enough, got %d", response.Code)
+		}
+
+		best, response := pick(t, `{"venueId": 9, "count": 2, "seatType": "VIP"}`)
+
+		if response.Code != http.StatusCreated || len(best.SeatMatrixIDs) != 2 || best.SeatMatrixIDs[0] != 54 || best.SeatMatrixIDs[1] != 55 {
+			t.Errorf("Expected the middle of the VIP row, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if _, response := pick(t, `{"venueId": 9, "count": 2, "seatType": "balcony"}`); response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown seat type, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if a party is only split when no row has room", func(t *testing.T) {
+		best, response := pick(t, `{"venueId": 9, "count": 10, "maxPrice": 200}`)
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", response.Code, response.Body.String())
+		}
+
+		want := []int32{24, 25, 41, 42, 43, 44, 45, 46, 47, 48}
+
+		if best.Together || len(best.SeatMatrixIDs) != len(want) {
+			t.Fatalf("Expected the party to be split over two rows, got %v", best.SeatMatrixIDs)
+		}
+
+		for i, seatID := range want {
+			if best.SeatMatrixIDs[i] != seatID {
+				t.Errorf("Expected the fourth row and the middle of the second, got %v", best.SeatMatrixIDs)
+				break
+			}
+		}
+	})
+}
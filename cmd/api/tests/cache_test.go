@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/cache"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// fakeMovieDB counts the GetMovie calls that reach the backend
+type fakeMovieDB struct {
+	pb.MovieDBServiceClient
+	getMovieCalls atomic.Int32
+}
+
+func (f *fakeMovieDB) GetMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	f.getMovieCalls.Add(1)
+
+	return &pb.MovieResponse{Status: 200, Movie: &pb.Movie{Id: 1, Title: "Interstellar"}}, nil
+}
+
+func (f *fakeMovieDB) UpdateMovie(ctx context.Context, in *pb.Movie, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	return &pb.MovieResponse{Status: 200, Movie: in}, nil
+}
+
+func (f *fakeMovieDB) AddMovieTimeSlot(ctx context.Context, in *pb.MovieTimeSlot, opts ...grpc.CallOption) (*pb.MovieTimeSlotResponse, error) {
+	return &pb.MovieTimeSlotResponse{Status: 200}, nil
+}
+
+func (f *fakeMovieDB) UpdateVenue(ctx context.Context, in *pb.Venue, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	return &pb.VenueResponse{Status: 200}, nil
+}
+
+func TestMovieDBCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	backend := &fakeMovieDB{}
+
+	client := cache.NewMovieDBCache(backend, redisClient, cache.TTLs{
+		GetMovie: cache.TTL{Fresh: time.Minute, Stale: time.Minute},
+	})
+
+	ctx := context.Background()
+
+	t.Run("Test if repeated reads are served from the cache", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			response, err := client.GetMovie(ctx, &pb.MovieRequest{Movieid: "1"})
+
+			if err != nil || response.Movie.Title != "Interstellar" {
+				t.Fatalf("Expected Interstellar, got %v %v", response, err)
+			}
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 1 {
+			t.Errorf("Expected 1 backend call, got %d", calls)
+		}
+	})
+
+	t.Run("Test if request parameters are part of the cache key", func(t *testing.T) {
+		if _, err := client.GetMovie(ctx, &pb.MovieRequest{Movieid: "2"}); err != nil {
+			t.Fatalf("Error getting movie: %v", err)
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 2 {
+			t.Errorf("Expected 2 backend calls, got %d", calls)
+		}
+	})
+
+	t.Run("Test if writes invalidate the cached reads", func(t *testing.T) {
+		if _, err := client.UpdateMovie(ctx, &pb.Movie{Id: 1, Title: "Interstellar"}); err != nil {
+			t.Fatalf("Error updating movie: %v", err)
+		}
+
+		if _, err := client.GetMovie(ctx, &pb.MovieRequest{Movieid: "1"}); err != nil {
+			t.Fatalf("Error getting movie: %v", err)
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 3 {
+			t.Errorf("Expected 3 backend calls, got %d", calls)
+		}
+	})
+	t.Run("Test if time slot and venue writes invalidate the cached movies", func(t *testing.T) {
+		if _, err := client.AddMovieTimeSlot(ctx, &pb.MovieTimeSlot{Movieid: 1, Venueid: 9}); err != nil {
+			t.Fatalf("Error adding time slot: %v", err)
+		}
+
+		if _, err := client.GetMovie(ctx, &pb.MovieRequest{Movieid: "1"}); err != nil {
+			t.Fatalf("Error getting movie: %v", err)
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 4 {
+			t.Errorf("Expected 4 backend calls after a time slot write, got %d", calls)
+		}
+
+		if _, err := client.UpdateVenue(ctx, &pb.Venue{Id: 9}); err != nil {
+			t.Fatalf("Error updating venue: %v", err)
+		}
+
+		if _, err := client.GetMovie(ctx, &pb.MovieRequest{Movieid: "1"}); err != nil {
+			t.Fatalf("Error getting movie: %v", err)
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 5 {
+			t.Errorf("Expected 5 backend calls after a venue write, got %d", calls)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	ps "github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+)
+
+// checkoutPayments counts the payment service calls of a checkout. An order
+// fails with orderErrors in turn before it goes through.
+type checkoutPayments struct {
+	ps.PaymentServiceClient
+	customers, orders, commits, links int
+	orderErrors                       []error
+	orderResponse                     *ps.Create_Order_Response
+	committed                         *ps.CommitIdempotentKeyRequest
+}
+
+func (p *checkoutPayments) CreateCustomer(ctx context.Context, in *ps.CreateCustomerRequest, opts ...grpc.CallOption) (*ps.CreateCustomerResponse, error) {
+	p.customers++
+	return &ps.CreateCustomerResponse{Status: 200, CustomerId: "cus_" + in.IdempotentKey}, nil
+}
+
+func (p *checkoutPayments) CreateOrder(ctx context.Context, in *ps.Create_Order_Request, opts ...grpc.CallOption) (*ps.Create_Order_Response, error) {
+	p.orders++
+
+	if len(p.orderErrors) > 0 {
+		err := p.orderErrors[0]
+		p.orderErrors = p.orderErrors[1:]
+
+		return nil, err
+	}
+
+	if p.orderResponse != nil {
+		return p.orderResponse, nil
+	}
+
+	return &ps.Create_Order_Response{Status: 200, OrderId: []string{"ord_" + in.IdempotentKey}}, nil
+}
+
+func (p *checkoutPayments) CommitIdempotentKey(ctx context.Context, in *ps.CommitIdempotentKeyRequest, opts ...grpc.CallOption) (*ps.Create_Payment_Intent_INR_Response, error) {
+	p.commits++
+	p.committed = in
+
+	return &ps.Create_Payment_Intent_INR_Response{Status: 200}, nil
+}
+
+func (p *checkoutPayments) GeneratePaymentLink(ctx context.Context, in *ps.CreatePaymentLinkRequest, opts ...grpc.CallOption) (*ps.CreatePaymentLinkResponse, error) {
+	p.links++
+	return &ps.CreatePaymentLinkResponse{Status: 200, PaymentLink: "https://pay.example.test/" + in.IdempotentKey}, nil
+}
+
+func TestCheckout(t *testing.T) {
+	seats := make([]*pb.SeatMatrix, 0, 8)
+
+	for i := int32(1); i <= 8; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	mr := miniredis.RunT(t)
+	payments := &checkoutPayments{}
+
+	app := api.Config{
+		MovieDB_service: newSeatMapMovieDB(seats),
+		Payment_service: payments,
+		Auth_Service:    acceptingAuth{},
+		Validator:       validator.New(),
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+	other := testToken(map[string]any{"user_id": 2, "email": "other@example.test", "role": "user"})
+
+	hold := func(t *testing.T, seatIDs string) string {
+		t.Helper()
+
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds", user, `{"venueId": 9, "seatMatrixIds": [`+seatIDs+`]}`)
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seats to be held, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var decoded api.SeatHold
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("Error decoding the hold: %v", err)
+		}
+
+		return decoded.ID
+	}
+
+	checkout := func(t *testing.T, token, key, holdID string) (api.Checkout, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		response := serve(http.MethodPost, "/v1/checkouts", token, `{"idempotentKey": "`+key+`", "movieTimeSlotId": 5, "holdId": "`+holdID+`", "customer": {"customerName": "Test User", "phoneNumber": "9999999999"}}`)
+
+		var decoded api.Checkout
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil && response.Code != http.StatusNotFound {
+			t.Fatalf("Error decoding the checkout: %v: %s", err, response.Body.String())
+		}
+
+		return decoded, response
+	}
+
+	t.Run("Test if a checkout runs every step once", func(t *testing.T) {
+		holdID := hold(t, "1, 2")
+
+		done, response := checkout(t, user, "key-1", holdID)
+
+		if response.Code != http.StatusOK || done.Status != "awaitingPayment" {
+			t.Fatalf("Expected the checkout to await payment, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if done.PaymentLink != "https://pay.example.test/key-1" || done.CustomerID != "cus_key-1" || len(done.OrderIDs) != 1 {
+			t.Errorf("Expected the results of the steps to be kept, got %s", response.Body.String())
+		}
+
+		if done.Customer.Email != "user@example.test" {
+			t.Errorf("Expected the email of the user, got %q", done.Customer.Email)
+		}
+
+		if _, response := checkout(t, user, "key-1", holdID); response.Code != http.StatusOK {
+			t.Errorf("Expected a retry to answer the same, got %d", response.Code)
+		}
+
+		if payments.customers != 1 || payments.orders != 1 || payments.commits != 1 || payments.links != 1 {
+			t.Errorf("Expected every step to run once, got %d customers, %d orders, %d commits and %d links", payments.customers, payments.orders, payments.commits, payments.links)
+		}
+
+		if committed := payments.committed; committed.IdempotentKey != "key-1" || committed.CustomerId != "cus_key-1" || len(committed.OrderIds) != 1 || committed.OrderIds[0] != "ord_key-1" {
+			t.Errorf("Expected the customer and order of the checkout to be committed, got %+v", committed)
+		}
+
+		if response := serve(http.MethodGet, "/v1/checkouts/key-1", other, ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected the checkout of another user to be hidden, got %d", response.Code)
+		}
+
+		if _, response := checkout(t, other, "key-1", holdID); response.Code != http.StatusConflict {
+			t.Errorf("Expected the key of another checkout to be turned away, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if a retry resumes after the last step that went through", func(t *testing.T) {
+		*payments = checkoutPayments{orderErrors: []error{status.Error(codes.Unavailable, "payment service is down")}}
+		holdID := hold(t, "3, 4")
+
+		pending, response := checkout(t, user, "key-2", holdID)
+
+		if response.Code != http.StatusServiceUnavailable || pending.Status != "pending" {
+			t.Fatalf("Expected the checkout to be left to retry, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if pending.Steps[0].Status != "done" || pending.Steps[1].Attempts != 1 {
+			t.Errorf("Expected the customer to be done and the order tried once, got %+v", pending.Steps)
+		}
+
+		if pending.Steps[2].Name != "commit" || payments.commits != 0 {
+			t.Errorf("Expected nothing to be committed before the order, got %d commits", payments.commits)
+		}
+
+		done, response := checkout(t, user, "key-2", holdID)
+
+		if response.Code != http.StatusOK || done.Status != "awaitingPayment" {
+			t.Fatalf("Expected the retry to finish the checkout, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if payments.customers != 1 || payments.orders != 2 {
+			t.Errorf("Expected the customer to be made once, got %d customers and %d orders", payments.customers, payments.orders)
+		}
+	})
+
+	t.Run("Test if a step that fails for good releases the hold", func(t *testing.T) {
+		*payments = checkoutPayments{orderResponse: &ps.Create_Order_Response{Status: 400, Error: "seats are not for sale"}}
+		holdID := hold(t, "5, 6")
+
+		failed, response := checkout(t, user, "key-3", holdID)
+
+		if response.Code != http.StatusConflict || failed.Status != "failed" || !strings.Contains(failed.Error, "seats are not for sale") {
+			t.Fatalf("Expected the checkout to fail, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if mr.Exists("seats:{5}:holds:"+holdID) || mr.Exists("seats:{5}:held:5") {
+			t.Errorf("Expected the hold to be released")
+		}
+
+		if _, response := checkout(t, user, "key-3", holdID); response.Code != http.StatusConflict || payments.orders != 1 {
+			t.Errorf("Expected a failed checkout to stay failed, got %d after %d orders", response.Code, payments.orders)
+		}
+	})
+
+	t.Run("Test if a step is tried a bounded number of times", func(t *testing.T) {
+		unavailable := status.Error(codes.Unavailable, "payment service is down")
+		*payments = checkoutPayments{orderErrors: []error{unavailable, unavailable, unavailable}}
+		holdID := hold(t, "7, 8")
+
+		for attempt := 1; attempt < 3; attempt++ {
+			if _, response := checkout(t, user, "key-4", holdID); response.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Expected attempt %d to be left to retry, got %d", attempt, response.Code)
+			}
+		}
+
+		failed, response := checkout(t, user, "key-4", holdID)
+
+		if response.Code != http.StatusConflict || failed.Steps[1].Status != "failed" {
+			t.Fatalf("Expected the third attempt to fail the checkout, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if mr.Exists("seats:{5}:holds:" + holdID) {
+			t.Errorf("Expected the hold to be released")
+		}
+	})
+
+	t.Run("Test if a checkout needs a hold of the user", func(t *testing.T) {
+		if _, response := checkout(t, user, "key-5", "missing"); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 without a hold, got %d", response.Code)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/cache"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// slowMovieDB blocks GetSeatMatrix until release is closed
+type slowMovieDB struct {
+	pb.MovieDBServiceClient
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *slowMovieDB) GetSeatMatrix(ctx context.Context, in *pb.GetSeatMatrixRequest, opts ...grpc.CallOption) (*pb.GetSeatMatrixResponse, error) {
+	s.calls.Add(1)
+	<-s.release
+
+	return &pb.GetSeatMatrixResponse{Status: 200, Seats: []*pb.SeatMatrix{{SeatNumber: "A1"}}}, nil
+}
+
+func TestCoalescingClient(t *testing.T) {
+	backend := &slowMovieDB{release: make(chan struct{})}
+	client := cache.NewCoalescingClient(backend)
+
+	const callers = 20
+
+	var wg sync.WaitGroup
+	responses := make([]*pb.GetSeatMatrixResponse, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			response, err := client.GetSeatMatrix(context.Background(), &pb.GetSeatMatrixRequest{Venueid: 7})
+
+			if err != nil {
+				t.Errorf("Error getting seat matrix: %v", err)
+			}
+
+			responses[i] = response
+		}(i)
+	}
+
+	// let every caller join the in flight call before it completes
+	requests := client.Metrics().Get("requests").(*expvar.Map)
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if count, ok := requests.Get("GetSeatMatrix").(*expvar.Int); ok && count.Value() == callers {
+			break
+		}
+	}
+
+	// the counter is bumped just before a caller joins the call
+	time.Sleep(20 * time.Millisecond)
+
+	close(backend.release)
+	wg.Wait()
+
+	t.Run("Test if concurrent identical reads share one backend call", func(t *testing.T) {
+		if calls := backend.calls.Load(); calls != 1 {
+			t.Errorf("Expected 1 backend call, got %d", calls)
+		}
+
+		if deduplicated := client.Deduplicated("GetSeatMatrix"); deduplicated != callers-1 {
+			t.Errorf("Expected %d deduplicated calls, got %d", callers-1, deduplicated)
+		}
+	})
+
+	t.Run("Test if every caller gets its own copy of the response", func(t *testing.T) {
+		responses[0].Seats[0].SeatNumber = "B1"
+
+		if responses[1].Seats[0].SeatNumber != "A1" {
+			t.Errorf("Expected a change to one response to leave the others untouched")
+		}
+	})
+}
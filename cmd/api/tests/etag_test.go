@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+func TestETag(t *testing.T) {
+	handler := utils.CacheControl(utils.CachePublic)(utils.ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "error getting movie", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"movie":{"id":1,"title":"Interstellar"}}`))
+	})))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/getMovie/1", nil))
+
+	etag := first.Header().Get("ETag")
+
+	t.Run("Test if successful responses are tagged", func(t *testing.T) {
+		if first.Code != http.StatusOK || etag == "" {
+			t.Fatalf("Expected a 200 with an ETag, got %d %q", first.Code, etag)
+		}
+
+		if policy := first.Header().Get("Cache-Control"); policy != utils.CachePublic {
+			t.Errorf("Expected Cache-Control %q, got %q", utils.CachePublic, policy)
+		}
+	})
+
+	t.Run("Test if a matching If-None-Match returns 304", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/getMovie/1", nil)
+		request.Header.Set("If-None-Match", `"stale", W/`+etag)
+
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusNotModified || response.Body.Len() != 0 {
+			t.Errorf("Expected an empty 304, got %d with %d bytes", response.Code, response.Body.Len())
+		}
+	})
+
+	t.Run("Test if a stale If-None-Match returns the body", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/getMovie/1", nil)
+		request.Header.Set("If-None-Match", `"stale"`)
+
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK || response.Body.Len() == 0 {
+			t.Errorf("Expected a 200 with a body, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if errors are neither tagged nor cached", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/getMovie/1?fail=1", nil))
+
+		if response.Code != http.StatusInternalServerError || response.Header().Get("ETag") != "" {
+			t.Errorf("Expected an untagged 500, got %d %q", response.Code, response.Header().Get("ETag"))
+		}
+
+		if policy := response.Header().Get("Cache-Control"); policy != utils.CacheNoStore {
+			t.Errorf("Expected Cache-Control %q, got %q", utils.CacheNoStore, policy)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/graph"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// graphMovieDB serves a tiny catalog and counts the calls that reach it
+type graphMovieDB struct {
+	pb.MovieDBServiceClient
+	getMovieCalls atomic.Int32
+	getVenueCalls atomic.Int32
+	// catalogSize is the number of movies in the catalog
+	catalogSize atomic.Int32
+}
+
+func (g *graphMovieDB) GetAllMovies(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*pb.MovieListResponse, error) {
+	// the movie service leaves the list out of an empty catalog
+	if g.catalogSize.Load() == 0 {
+		return &pb.MovieListResponse{Status: 200}, nil
+	}
+
+	movies := make([]*pb.Movie, g.catalogSize.Load())
+
+	for i := range movies {
+		movies[i] = &pb.Movie{Id: int32(i + 1), Title: "Interstellar"}
+	}
+
+	return &pb.MovieListResponse{Status: 200, MovieList: &pb.MovieList{Movies: movies}}, nil
+}
+
+func (g *graphMovieDB) GetMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	g.getMovieCalls.Add(1)
+
+	id, _ := strconv.Atoi(in.Movieid)
+
+	return &pb.MovieResponse{Status: 200, Movie: &pb.Movie{Id: int32(id), Title: "Interstellar"}}, nil
+}
+
+func (g *graphMovieDB) GetVenue(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.VenueResponse, error) {
+	g.getVenueCalls.Add(1)
+
+	return &pb.VenueResponse{Status: 200, Venue: &pb.Venue{Id: 9, Name: "PVR Select City"}}, nil
+}
+
+func (g *graphMovieDB) GetMovieTimeSlots(ctx context.Context, in *pb.GetMovieTimeSlotRequest, opts ...grpc.CallOption) (*pb.GetMovieTimeSlotResponse, error) {
+	return &pb.GetMovieTimeSlotResponse{
+		Status: 200,
+		MovieTimeSlots: []*pb.MovieTimeSlot{
+			{StartTime: "10:00", Movieid: 1, Venueid: 9},
+			{StartTime: "14:00", Movieid: 1, Venueid: 9},
+			{StartTime: "18:00", Movieid: 1, Venueid: 9},
+		},
+		Venues: []*pb.Venue{{Id: 9, Name: "PVR Select City"}},
+	}, nil
+}
+
+func (g *graphMovieDB) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	return &pb.ReviewListResponse{
+		Status:           200,
+		TotalReviewCount: 1,
+		ReviewList:       &pb.ReviewList{Reviews: []*pb.Review{{ReviewID: 3, MovieID: in.MovieID, Rating: 5, Title: "Loved it"}}},
+	}, nil
+}
+
+func execGraphQL(t *testing.T, handler http.Handler, query string, variables map[string]any) (int, map[string]any) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+
+	var result map[string]any
+
+	if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Error decoding response %q: %v", response.Body.String(), err)
+	}
+
+	return response.Code, result
+}
+
+func TestGraphQLGateway(t *testing.T) {
+	backend := &graphMovieDB{}
+	backend.catalogSize.Store(20)
+	handler := graph.NewHandler(&graph.Resolver{MovieDB: backend}, nil)
+
+	t.Run("Test if nested lookups are batched and deduplicated", func(t *testing.T) {
+		status, result := execGraphQL(t, handler, `{
+			showtimes(movieId: "1", startDate: "2026-10-19", endDate: "2026-10-20", latitude: 28.5, longitude: 77.2) {
+				startTime
+				movie { title }
+				venue { name }
+			}
+		}`, nil)
+
+		if status != http.StatusOK || result["errors"] != nil {
+			t.Fatalf("Expected a 200 without errors, got %d %v", status, result["errors"])
+		}
+
+		if calls := backend.getMovieCalls.Load(); calls != 1 {
+			t.Errorf("Expected 1 GetMovie call for 3 showtimes of the same movie, got %d", calls)
+		}
+
+		if calls := backend.getVenueCalls.Load(); calls != 0 {
+			t.Errorf("Expected the venues of the time slot response to be reused, got %d GetVenue calls", calls)
+		}
+	})
+
+	t.Run("Test if reviews are paginated", func(t *testing.T) {
+		status, result := execGraphQL(t, handler, `{ movie(id: "1") { title reviews(limit: 5) { totalCount reviews { title rating } } } }`, nil)
+
+		if status != http.StatusOK || result["errors"] != nil {
+			t.Fatalf("Expected a 200 without errors, got %d %v", status, result["errors"])
+		}
+
+		reviews := result["data"].(map[string]any)["movie"].(map[string]any)["reviews"].(map[string]any)
+
+		if reviews["totalCount"] != float64(1) {
+			t.Errorf("Expected a total count of 1, got %v", reviews["totalCount"])
+		}
+	})
+
+	t.Run("Test if deep queries are rejected", func(t *testing.T) {
+		status, _ := execGraphQL(t, handler, `{ movie(id: "1") { reviews { reviews { movie { reviews { reviews { movie { reviews { reviews { movie { title } } } } } } } } } } }`, nil)
+
+		if status != http.StatusBadRequest {
+			t.Errorf("Expected a 400 for a query deeper than %d, got %d", graph.MaxDepth, status)
+		}
+	})
+
+	t.Run("Test if expensive queries are rejected", func(t *testing.T) {
+		status, result := execGraphQL(t, handler, `
+			query { movies { ...details venues { seats { id seatNumber row column price type } } } }
+			fragment details on Movie { title description }
+		`, nil)
+
+		if status != http.StatusBadRequest || !strings.Contains(result["errors"].([]any)[0].(map[string]any)["message"].(string), "complexity") {
+			t.Errorf("Expected a 400 for a query above the complexity limit, got %d %v", status, result["errors"])
+		}
+	})
+	t.Run("Test if review pages are costed at the size the resolver returns", func(t *testing.T) {
+		query := `query ($n: Int) { movie(id: "1") { reviews(limit: $n) { reviews { movie { venues { id name } } } } } }`
+
+		if status, result := execGraphQL(t, handler, query, map[string]any{"n": 10}); status != http.StatusOK {
+			t.Errorf("Expected a page of 10 reviews to be taken, got %d %v", status, result["errors"])
+		}
+
+		// the resolver caps the page at 50 reviews
+		if status, _ := execGraphQL(t, handler, query, map[string]any{"n": 1000}); status != http.StatusBadRequest {
+			t.Errorf("Expected a page of 1000 reviews to be costed at 50 and rejected, got %d", status)
+		}
+
+		if status, _ := execGraphQL(t, handler, query, map[string]any{"n": 0}); status != http.StatusBadRequest {
+			t.Errorf("Expected a page of 0 reviews to be costed at 50 and rejected, got %d", status)
+		}
+
+		defaulted := `query ($n: Int = 50) { movie(id: "1") { reviews(limit: $n) { reviews { movie { venues { id name } } } } } }`
+
+		if status, _ := execGraphQL(t, handler, defaulted, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected the default of the variable to be costed, got %d", status)
+		}
+
+		if status, result := execGraphQL(t, handler, `{ movie(id: "1") { reviews { reviews { movie { venues { id name } } } } } }`, nil); status != http.StatusOK {
+			t.Errorf("Expected the default page of 10 reviews to be taken, got %d %v", status, result["errors"])
+		}
+	})
+
+	t.Run("Test if movies without ids are costed at the size of the catalog", func(t *testing.T) {
+		query := `{ movies { venues { id name } } }`
+
+		backend.catalogSize.Store(30)
+
+		if status, result := execGraphQL(t, handler, query, nil); status != http.StatusOK {
+			t.Errorf("Expected a catalog of 30 movies to be taken, got %d %v", status, result["errors"])
+		}
+
+		backend.catalogSize.Store(60)
+
+		if status, _ := execGraphQL(t, handler, query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected a catalog of 60 movies to be rejected, got %d", status)
+		}
+
+		if status, result := execGraphQL(t, handler, `query ($ids: [ID!]) { movies(ids: $ids) { venues { id name } } }`, map[string]any{"ids": []string{"1", "2"}}); status != http.StatusOK {
+			t.Errorf("Expected 2 movies by id to be taken, got %d %v", status, result["errors"])
+		}
+	})
+	t.Run("Test if an empty catalog is an empty list of movies", func(t *testing.T) {
+		backend.catalogSize.Store(0)
+
+		status, result := execGraphQL(t, handler, `{ movies { id title } }`, nil)
+
+		if status != http.StatusOK || result["errors"] != nil {
+			t.Fatalf("Expected an empty catalog to be taken, got %d %v", status, result["errors"])
+		}
+
+		if movies := result["data"].(map[string]any)["movies"].([]any); len(movies) != 0 {
+			t.Errorf("Expected no movies, got %v", movies)
+		}
+	})
+}
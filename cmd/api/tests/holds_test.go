@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// seatMapMovieDB adds the seat matrix of a venue to the bookings
+type seatMapMovieDB struct {
+	*bookingMovieDB
+	seats []*pb.SeatMatrix
+}
+
+func newSeatMapMovieDB(seats []*pb.SeatMatrix) *seatMapMovieDB {
+	return &seatMapMovieDB{
+		bookingMovieDB: &bookingMovieDB{reviewStoreMovieDB: newReviewStoreMovieDB(), booked: map[int32][]*pb.BookedSeats{}},
+		seats:          seats,
+	}
+}
+
+func (m *seatMapMovieDB) GetSeatMatrix(ctx context.Context, in *pb.GetSeatMatrixRequest, opts ...grpc.CallOption) (*pb.GetSeatMatrixResponse, error) {
+	return &pb.GetSeatMatrixResponse{Status: 200, Seats: m.seats}, nil
+}
+
+func TestSeatHolds(t *testing.T) {
+	mr := miniredis.RunT(t)
+	seats := make([]*pb.SeatMatrix, 0, 4)
+
+	for i := int32(1); i <= 4; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	movieDB := newSeatMapMovieDB(seats)
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		Validator:       validator.New(),
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	first := testToken(map[string]any{"user_id": 1, "email": "first@example.test", "role": "user"})
+	second := testToken(map[string]any{"user_id": 2, "email": "second@example.test", "role": "user"})
+
+	hold := func(t *testing.T, token, body string) (api.SeatHold, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds", token, body)
+
+		var decoded api.SeatHold
+
+		if response.Code == http.StatusCreated {
+			if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("Error decoding the hold: %v", err)
+			}
+		}
+
+		return decoded, response
+	}
+
+	var held api.SeatHold
+
+	t.Run("Test if seats are held all or nothing", func(t *testing.T) {
+		var response *httptest.ResponseRecorder
+
+		held, response = hold(t, first, `{"venueId": 9, "seatMatrixIds": [1, 2]}`)
+
+		if response.Code != http.StatusCreated || held.ID == "" || len(held.SeatMatrixIDs) != 2 {
+			t.Fatalf("Expected the seats to be held, got %d: %s", response.Code, response.Body.String())
+		}
+
+		_, response = hold(t, second, `{"venueId": 9, "seatMatrixIds": [2, 3]}`)
+
+		if response.Code != http.StatusConflict || !strings.Contains(response.Body.String(), `"seatMatrixIds":[2]`) {
+			t.Fatalf("Expected 409 listing the held seat, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if mr.Exists("seats:{5}:held:3") {
+			t.Errorf("Expected the free seat of a conflicting hold not to be held")
+		}
+
+		_, response = hold(t, second, `{"venueId": 9, "seatMatrixIds": []}`)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a hold without seats, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if only the owner sees the hold", func(t *testing.T) {
+		if response := serve(http.MethodGet, "/v1/showtimes/5/holds/"+held.ID, first, ""); response.Code != http.StatusOK {
+			t.Errorf("Expected 200 for the owner, got %d", response.Code)
+		}
+
+		if response := serve(http.MethodGet, "/v1/showtimes/5/holds/"+held.ID, second, ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for someone else, got %d", response.Code)
+		}
+
+		if response := serve(http.MethodDelete, "/v1/showtimes/5/holds/"+held.ID, second, ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected someone else not to release the hold, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if held seats are in the seat map and the availability", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/showtimes/5/seats", "", "")
+
+		if response.Code != http.StatusOK || strings.Count(response.Body.String(), "seatMatrixID") != 2 {
+			t.Errorf("Expected the two held seats, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodGet, "/v1/showtimes/availability?showtime=5:9", "", "")
+
+		if !strings.Contains(response.Body.String(), `"availableSeats":2`) {
+			t.Errorf("Expected two seats left, got %s", response.Body.String())
+		}
+	})
+
+	t.Run("Test if a hold is extended", func(t *testing.T) {
+		mr.FastForward(5 * time.Minute)
+
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds/"+held.ID+"/extend", first, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		for _, key := range []string{"seats:{5}:holds:" + held.ID, "seats:{5}:held:1", "seats:{5}:held:2"} {
+			if ttl := mr.TTL(key); ttl < 9*time.Minute {
+				t.Errorf("Expected %s to last another 10 minutes, got %v", key, ttl)
+			}
+		}
+	})
+
+	t.Run("Test if held seats are only booked under the hold", func(t *testing.T) {
+		booking := `{"movieId": 7, "movieTimeSlotId": 5, "venueId": 9, "email": "second@example.test", "seats": [{"seatNumber": "A2", "seatMatrixID": 2}]}`
+
+		response := serve(http.MethodPost, "/v1/bookings", "", booking)
+
+		if response.Code != http.StatusConflict {
+			t.Fatalf("Expected 409 for a held seat, got %d: %s", response.Code, response.Body.String())
+		}
+
+		booking = `{"movieId": 7, "movieTimeSlotId": 5, "email": "first@example.test", "holdId": "` + held.ID + `", "seats": [{"seatNumber": "A1", "seatMatrixID": 1}, {"seatNumber": "A2", "seatMatrixID": 2}]}`
+
+		// the hold id alone does not book the seats of another user
+		for _, token := range []string{"", second} {
+			if response := serve(http.MethodPost, "/v1/bookings", token, booking); response.Code != http.StatusConflict {
+				t.Fatalf("Expected 409 for a hold of someone else, got %d: %s", response.Code, response.Body.String())
+			}
+		}
+
+		response = serve(http.MethodPost, "/v1/bookings", first, booking)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected the seats to be booked under the hold, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if mr.Exists("seats:{5}:holds:" + held.ID) {
+			t.Errorf("Expected the hold to be released once the seats are booked")
+		}
+
+		_, response = hold(t, second, `{"venueId": 9, "seatMatrixIds": [1]}`)
+
+		if response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 for a booked seat, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if seats that cannot be found are rejected", func(t *testing.T) {
+		for _, booking := range []string{
+			`{"movieId": 7, "movieTimeSlotId": 5, "email": "second@example.test", "seats": [{"seatNumber": "A4"}]}`,
+			`{"movieId": 7, "movieTimeSlotId": 5, "venueId": 9, "email": "second@example.test", "seats": [{"seatNumber": "A4", "seatMatrixID": 4}, {"seatNumber": "Z9"}]}`,
+		} {
+			if response := serve(http.MethodPost, "/v1/bookings", "", booking); response.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for %s, got %d: %s", booking, response.Code, response.Body.String())
+			}
+		}
+
+		movieDB.bookingsMu.Lock()
+		defer movieDB.bookingsMu.Unlock()
+
+		if len(movieDB.booked[5]) != 2 {
+			t.Errorf("Expected nothing more to be booked, got %v", movieDB.booked[5])
+		}
+	})
+
+	t.Run("Test if seats at a venue without a seat matrix are rejected", func(t *testing.T) {
+		movieDB.seats = nil
+		defer func() { movieDB.seats = seats }()
+
+		booking := `{"movieId": 7, "movieTimeSlotId": 5, "venueId": 8, "email": "second@example.test", "seats": [{"seatNumber": "A4", "seatMatrixID": 4}]}`
+
+		if response := serve(http.MethodPost, "/v1/bookings", "", booking); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if holds expire and are released", func(t *testing.T) {
+		expiring, response := hold(t, first, `{"venueId": 9, "seatMatrixIds": [3]}`)
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seat to be held, got %d: %s", response.Code, response.Body.String())
+		}
+
+		mr.FastForward(11 * time.Minute)
+
+		if response := serve(http.MethodGet, "/v1/showtimes/5/holds/"+expiring.ID, first, ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an expired hold, got %d", response.Code)
+		}
+
+		released, response := hold(t, second, `{"venueId": 9, "seatMatrixIds": [3, 4]}`)
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seat of an expired hold to be free, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if response := serve(http.MethodDelete, "/v1/showtimes/5/holds/"+released.ID, second, ""); response.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d", response.Code)
+		}
+
+		if _, response := hold(t, first, `{"venueId": 9, "seatMatrixIds": [3, 4]}`); response.Code != http.StatusCreated {
+			t.Errorf("Expected a released seat to be free, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if tokens without a user id are refused", func(t *testing.T) {
+		anonymous := testToken(map[string]any{"email": "nobody@example.test", "role": "user"})
+
+		if _, response := hold(t, anonymous, `{"venueId": 9, "seatMatrixIds": [4]}`); response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+func TestBuildICalendar(t *testing.T) {
+	release := time.Date(2026, time.November, 6, 0, 0, 0, 0, time.UTC)
+
+	ics := utils.BuildICalendar("Upcoming releases", []utils.CalendarEvent{
+		{
+			UID:         "movie-1-release@booking-broker-service",
+			Date:        release,
+			Summary:     "Dune, Part Three",
+			Description: strings.Repeat("A long description; ", 10),
+		},
+	}, release)
+
+	t.Run("Test if events are all day events", func(t *testing.T) {
+		if !strings.Contains(ics, "DTSTART;VALUE=DATE:20261106\r\n") || !strings.Contains(ics, "DTEND;VALUE=DATE:20261107\r\n") {
+			t.Errorf("Expected an all day event on 2026-11-06, got %q", ics)
+		}
+	})
+
+	t.Run("Test if text values are escaped", func(t *testing.T) {
+		if !strings.Contains(ics, `SUMMARY:Dune\, Part Three`) {
+			t.Errorf("Expected the comma in the summary to be escaped, got %q", ics)
+		}
+	})
+
+	t.Run("Test if long lines are folded", func(t *testing.T) {
+		for _, line := range strings.Split(ics, "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("Expected lines of at most 75 octets, got %d: %q", len(line), line)
+			}
+		}
+	})
+}
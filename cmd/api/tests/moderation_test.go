@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	"github.com/kartik7120/booking_broker-service/cmd/api/moderation"
+)
+
+func TestModerationFilter(t *testing.T) {
+	filter := moderation.NewFilter(moderation.DefaultWords)
+
+	tests := []struct {
+		name    string
+		title   string
+		comment string
+		want    []moderation.Flag
+	}{
+		{"clean", "A slow burn", "The last twenty minutes make up for a patchy middle act.", nil},
+		{"profanity", "Meh", "What a load of bullshit", []moderation.Flag{moderation.FlagProfanity}},
+		{"obfuscated profanity", "Meh", "Pure sh1t from start to end", []moderation.Flag{moderation.FlagProfanity}},
+		{"phrase", "Deals", "Click here for cheap tickets", []moderation.Flag{moderation.FlagProfanity}},
+		{"link", "Great", "Full review at https://example.test/review", []moderation.Flag{moderation.FlagLink}},
+		{"bare domain", "Great", "Stream it on cheapmovies.xyz tonight", []moderation.Flag{moderation.FlagLink}},
+		{"shouting", "BEST MOVIE EVER", "GO WATCH IT RIGHT NOW", []moderation.Flag{moderation.FlagSpam}},
+		{"repetition", "Good", "good good good good good good good movie", []moderation.Flag{moderation.FlagSpam}},
+		{"phone number", "Tickets", "Call 98765 43210 for tickets", []moderation.Flag{moderation.FlagSpam}},
+		{"years are not phone numbers", "Remake", "The 1999 original beats the 2001 remake", nil},
+	}
+
+	for _, test := range tests {
+		t.Run("Test if "+test.name+" is flagged correctly", func(t *testing.T) {
+			got := filter.Check(test.title, test.comment)
+
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected %v, got %v", test.want, got)
+			}
+		})
+	}
+
+	t.Run("Test if the word list is configurable", func(t *testing.T) {
+		words, err := moderation.ParseWordList(strings.NewReader("# spoilers\nrosebud\n\nsnape kills\n"))
+
+		if err != nil {
+			t.Fatalf("Error parsing word list: %v", err)
+		}
+
+		custom := moderation.NewFilter(words)
+
+		if flags := custom.Check("", "Rosebud was the sled"); len(flags) != 1 {
+			t.Errorf("Expected the custom word to be flagged, got %v", flags)
+		}
+
+		if flags := custom.Check("", "Then Snape kills Dumbledore"); len(flags) != 1 {
+			t.Errorf("Expected the custom phrase to be flagged, got %v", flags)
+		}
+
+		if flags := custom.Check("", "What a load of bullshit"); len(flags) != 0 {
+			t.Errorf("Expected the default words to be replaced, got %v", flags)
+		}
+	})
+
+	t.Run("Test if fingerprints ignore case and punctuation", func(t *testing.T) {
+		if moderation.Fingerprint("Great", "Loved it!") != moderation.Fingerprint("great", "loved   it") {
+			t.Errorf("Expected the same fingerprint")
+		}
+	})
+}
+
+func TestReviewModeration(t *testing.T) {
+	mr := miniredis.RunT(t)
+	movieDB := newReviewStoreMovieDB()
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	admin := testToken(map[string]any{"user_id": 100, "role": "admin"})
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := func(id int) string {
+		return testToken(map[string]any{"user_id": id, "role": "user"})
+	}
+
+	pending := func(t *testing.T) api.PendingReviewList {
+		t.Helper()
+
+		response := serve(http.MethodGet, "/v1/admin/reviews/pending", admin, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var list api.PendingReviewList
+
+		if err := json.Unmarshal(response.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Error decoding pending reviews: %v", err)
+		}
+
+		return list
+	}
+
+	t.Run("Test if clean reviews are published", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", user(1), `{"title": "A slow burn", "comment": "The last twenty minutes make up for a patchy middle act.", "rating": 4}`)
+
+		if response.Code != http.StatusOK || len(movieDB.reviews) != 1 {
+			t.Fatalf("Expected the review to be published, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if flagged reviews are held", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", user(2), `{"title": "Great", "comment": "Full review at https://example.test/review", "rating": 5}`)
+
+		if response.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if len(movieDB.reviews) != 1 {
+			t.Errorf("Expected the held review to stay out of MovieDB")
+		}
+
+		list := pending(t)
+
+		if list.Total != 1 || list.Reviews[0].UserID != 2 || list.Reviews[0].Flags[0] != moderation.FlagLink {
+			t.Fatalf("Expected the review in the queue, got %+v", list)
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/7/reviews", user(2), `{"title": "Great", "comment": "Really great", "rating": 5}`)
+
+		if response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 while the first review waits, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if duplicate content is held", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/8/reviews", user(3), `{"title": "a slow burn", "comment": "The last twenty minutes make up for a patchy middle act", "rating": 4}`)
+
+		if response.Code != http.StatusAccepted || !strings.Contains(response.Body.String(), `"duplicate"`) {
+			t.Errorf("Expected the copied review to be held as a duplicate, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if only admins moderate", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/admin/reviews/pending", user(1), "")
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if approving publishes the review", func(t *testing.T) {
+		id := pending(t).Reviews[0].ID
+
+		response := serve(http.MethodPost, "/v1/admin/reviews/pending/"+strconv.FormatInt(id, 10)+"/approve", admin, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if len(movieDB.reviews) != 2 {
+			t.Errorf("Expected the approved review in MovieDB")
+		}
+
+		response = serve(http.MethodPost, "/v1/admin/reviews/pending/"+strconv.FormatInt(id, 10)+"/approve", admin, "")
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expected a review to be approved once, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if rejecting frees the author", func(t *testing.T) {
+		id := pending(t).Reviews[0].ID
+
+		response := serve(http.MethodPost, "/v1/admin/reviews/pending/"+strconv.FormatInt(id, 10)+"/reject", admin, `{"reason": "copied"}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if list := pending(t); list.Total != 0 {
+			t.Errorf("Expected an empty queue, got %+v", list)
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/8/reviews", user(3), `{"title": "My own words", "comment": "Sharp dialogue and a great score.", "rating": 4}`)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("Expected the author to post a new review, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if edits are moderated", func(t *testing.T) {
+		response := serve(http.MethodPut, "/v1/movies/7/reviews/1", user(1), `{"comment": "Cheap tickets at cheapmovies.xyz"}`)
+
+		if response.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if movieDB.reviews[1].Comment == "Cheap tickets at cheapmovies.xyz" {
+			t.Errorf("Expected the held edit to stay out of MovieDB")
+		}
+
+		if list := pending(t); list.Total != 1 || list.Reviews[0].ReviewID != 1 {
+			t.Errorf("Expected the edit in the queue, got %+v", list)
+		}
+	})
+
+	t.Run("Test if outcomes are logged", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/admin/reviews/moderation-log", admin, "")
+
+		var records []api.ModerationRecord
+
+		if err := json.Unmarshal(response.Body.Bytes(), &records); err != nil {
+			t.Fatalf("Error decoding moderation log: %v", err)
+		}
+
+		var actions []string
+
+		for _, record := range records {
+			actions = append(actions, record.Action)
+		}
+
+		want := []string{"held", "published", "rejected", "approved", "held", "held", "published"}
+
+		if !reflect.DeepEqual(actions, want) {
+			t.Errorf("Expected %v, got %v", want, actions)
+		}
+
+		if records[2].ModeratorID != 100 || records[2].Reason != "copied" {
+			t.Errorf("Expected the moderator and reason of the rejection, got %+v", records[2])
+		}
+	})
+
+	t.Run("Test if held content is only claimed once it is approved", func(t *testing.T) {
+		body := `{"title": "Deal", "comment": "Tickets at https://example.test/deal", "rating": 3}`
+
+		held := serve(http.MethodPost, "/v1/movies/9/reviews", user(6), body)
+
+		var first api.PendingReview
+
+		if err := json.Unmarshal(held.Body.Bytes(), &first); err != nil || held.Code != http.StatusAccepted {
+			t.Fatalf("Expected the review to be held, got %d: %s", held.Code, held.Body.String())
+		}
+
+		if response := serve(http.MethodPost, "/v1/movies/9/reviews", user(7), body); strings.Contains(response.Body.String(), `"duplicate"`) {
+			t.Errorf("Expected held content not to make copies duplicates, got %s", response.Body.String())
+		}
+
+		response := serve(http.MethodPost, "/v1/admin/reviews/pending/"+strconv.FormatInt(first.ID, 10)+"/approve", admin, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if response := serve(http.MethodPost, "/v1/movies/9/reviews", user(8), body); !strings.Contains(response.Body.String(), `"duplicate"`) {
+			t.Errorf("Expected approved content to make copies duplicates, got %s", response.Body.String())
+		}
+	})
+}
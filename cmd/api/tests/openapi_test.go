@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+)
+
+func TestOpenAPI(t *testing.T) {
+	app := api.Config{}
+	routes := app.Routes()
+	doc := api.OpenAPI()
+
+	t.Run("Test if the spec and the routes match", func(t *testing.T) {
+		served := map[string]bool{}
+
+		err := chi.Walk(routes.(chi.Routes), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			served[method+" "+strings.TrimSuffix(route, "/*")] = true
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("Error walking the routes: %v", err)
+		}
+
+		described := map[string]bool{}
+
+		for path, item := range doc.Paths {
+			for method := range item.Operations() {
+				described[method+" "+path] = true
+			}
+		}
+
+		if missing := difference(served, described); len(missing) > 0 {
+			t.Errorf("Routes missing from the spec: %v", missing)
+		}
+
+		if stale := difference(described, served); len(stale) > 0 {
+			t.Errorf("Spec describes routes that are not served: %v", stale)
+		}
+	})
+
+	t.Run("Test if operation ids are unique", func(t *testing.T) {
+		seen := map[string]string{}
+
+		for path, item := range doc.Paths {
+			for method, operation := range item.Operations() {
+				if other, ok := seen[operation.OperationID]; ok {
+					t.Errorf("Operation id %q is used by %s and %s %s", operation.OperationID, other, method, path)
+				}
+
+				seen[operation.OperationID] = method + " " + path
+			}
+		}
+	})
+
+	response := httptest.NewRecorder()
+	routes.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var spec map[string]any
+
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Expected /openapi.json to be JSON, got %d %q", response.Code, response.Body.String())
+	}
+
+	t.Run("Test if every reference resolves", func(t *testing.T) {
+		for _, ref := range references(spec) {
+			parts := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+
+			var node any = spec
+
+			for _, part := range parts {
+				object, ok := node.(map[string]any)
+
+				if !ok {
+					node = nil
+					break
+				}
+
+				node = object[part]
+			}
+
+			if node == nil {
+				t.Errorf("Reference %q does not resolve", ref)
+			}
+		}
+	})
+
+	t.Run("Test if enums are described by name", func(t *testing.T) {
+		schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+		seatType, ok := schemas["SeatType"].(map[string]any)
+
+		if !ok || seatType["type"] != "string" || len(seatType["enum"].([]any)) == 0 {
+			t.Errorf("Expected SeatType to be a string enum, got %v", schemas["SeatType"])
+		}
+	})
+
+	t.Run("Test if the docs page loads the spec", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+		if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"/openapi.json"`) {
+			t.Errorf("Expected a docs page pointing at /openapi.json, got %d", response.Code)
+		}
+	})
+}
+
+func difference(a, b map[string]bool) []string {
+	var missing []string
+
+	for key := range a {
+		if !b[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+func references(node any) []string {
+	var refs []string
+
+	switch value := node.(type) {
+	case map[string]any:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				refs = append(refs, ref)
+				continue
+			}
+
+			refs = append(refs, references(child)...)
+		}
+	case []any:
+		for _, child := range value {
+			refs = append(refs, references(child)...)
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,319 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// paymentWebhook is the body of a webhook for a payment with metadata
+func paymentWebhook(eventType, paymentID string, metadata map[string]string) string {
+	encoded, _ := json.Marshal(map[string]any{
+		"business_id": "bus_test",
+		"type":        eventType,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"data":        map[string]any{"payment_id": paymentID, "metadata": metadata},
+	})
+
+	return string(encoded)
+}
+
+// webhookSecret is the key payment webhooks are signed with in the tests
+var webhookSecret = []byte("webhook secret")
+
+// testWebhookSecret is webhookSecret as the payment provider hands it out
+var testWebhookSecret = "whsec_" + base64.StdEncoding.EncodeToString(webhookSecret)
+
+// signWebhook signs a webhook request the way the payment provider does
+func signWebhook(request *http.Request, body string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, webhookSecret)
+	mac.Write([]byte("msg_1." + timestamp + "." + body))
+
+	request.Header.Set("webhook-id", "msg_1")
+	request.Header.Set("webhook-timestamp", timestamp)
+	request.Header.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func TestPaymentWebhooks(t *testing.T) {
+	seats := make([]*pb.SeatMatrix, 0, 6)
+
+	for i := int32(1); i <= 6; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, SeatNumber: fmt.Sprintf("A%d", i), Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	mr := miniredis.RunT(t)
+	movieDB := newSeatMapMovieDB(seats)
+
+	var mails []utils.SendMailStruct
+	var mailErr error
+
+	app := api.Config{
+		MovieDB_service:      movieDB,
+		Payment_service:      &checkoutPayments{},
+		Auth_Service:         acceptingAuth{},
+		Validator:            validator.New(),
+		RedisClient:          redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		PaymentWebhookSecret: testWebhookSecret,
+		Mailer: func(mail utils.SendMailStruct) error {
+			if mailErr != nil {
+				return mailErr
+			}
+
+			mails = append(mails, mail)
+			return nil
+		},
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		if target == "/v1/webhooks/payments" {
+			signWebhook(request, body)
+		}
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+	other := testToken(map[string]any{"user_id": 2, "email": "other@example.test", "role": "user"})
+	admin := testToken(map[string]any{"user_id": 3, "email": "admin@example.test", "role": "admin"})
+
+	// checkout holds seats for the user and checks them out under key
+	checkout := func(t *testing.T, key, seatIDs string) string {
+		t.Helper()
+
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds", user, `{"venueId": 9, "seatMatrixIds": [`+seatIDs+`]}`)
+
+		var hold api.SeatHold
+
+		if err := json.Unmarshal(response.Body.Bytes(), &hold); err != nil || response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seats to be held, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/checkouts", user, `{"idempotentKey": "`+key+`", "movieId": 7, "movieTimeSlotId": 5, "date": "2026-10-20", "startTime": "18:00", "holdId": "`+hold.ID+`", "customer": {"customerName": "Test User"}}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected the checkout to await payment, got %d: %s", response.Code, response.Body.String())
+		}
+
+		return hold.ID
+	}
+
+	state := func(t *testing.T, key string) api.Checkout {
+		t.Helper()
+
+		var decoded api.Checkout
+
+		response := serve(http.MethodGet, "/v1/checkouts/"+key, user, "")
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("Error decoding the checkout: %v: %s", err, response.Body.String())
+		}
+
+		return decoded
+	}
+
+	t.Run("Test if a payment that went through books the seats once", func(t *testing.T) {
+		holdID := checkout(t, "key-1", "1, 2")
+		webhook := paymentWebhook("payment.succeeded", "pay_1", map[string]string{"idempotentKey": "key-1"})
+
+		for delivery := 1; delivery <= 2; delivery++ {
+			if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+				t.Fatalf("Expected delivery %d to be taken, got %d: %s", delivery, response.Code, response.Body.String())
+			}
+		}
+
+		confirmed := state(t, "key-1")
+
+		if confirmed.Status != "confirmed" || confirmed.PaymentID != "pay_1" || confirmed.TicketSentAt == nil {
+			t.Errorf("Expected the checkout to be confirmed, got %+v", confirmed)
+		}
+
+		if len(movieDB.booked[5]) != 2 {
+			t.Errorf("Expected the two seats to be booked once, got %d bookings", len(movieDB.booked[5]))
+		}
+
+		if len(mails) != 1 || mails[0].To != "user@example.test" || !strings.Contains(mails[0].Text, "A1, A2") {
+			t.Errorf("Expected one ticket with the seats, got %+v", mails)
+		}
+
+		if !strings.Contains(mails[0].Text, "Interstellar at 2026-10-20 18:00") {
+			t.Errorf("Expected the ticket to name the movie and its start, got %q", mails[0].Text)
+		}
+
+		if mr.Exists("seats:{5}:holds:" + holdID) {
+			t.Errorf("Expected the hold to be released once the seats are booked")
+		}
+	})
+
+	t.Run("Test if a ticket that failed is sent on the next delivery", func(t *testing.T) {
+		checkout(t, "key-2", "3")
+		webhook := paymentWebhook("payment.succeeded", "pay_2", map[string]string{"order_id": "ord_key-2"})
+
+		mailErr = errors.New("mail is down")
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected the webhook to be delivered again, got %d", response.Code)
+		}
+
+		if booked := state(t, "key-2"); booked.Status != "confirmed" || booked.TicketSentAt != nil {
+			t.Errorf("Expected the seats to be booked without a ticket, got %+v", booked)
+		}
+
+		mailErr = nil
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+			t.Fatalf("Expected the delivery to be taken, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if len(movieDB.booked[5]) != 3 || len(mails) != 2 {
+			t.Errorf("Expected the seat to be booked once and the ticket sent, got %d bookings and %d mails", len(movieDB.booked[5]), len(mails))
+		}
+	})
+
+	t.Run("Test if seats taken after the hold expired are not booked", func(t *testing.T) {
+		holdID := checkout(t, "key-3", "4")
+
+		serve(http.MethodDelete, "/v1/showtimes/5/holds/"+holdID, user, "")
+
+		if response := serve(http.MethodPost, "/v1/showtimes/5/holds", other, `{"venueId": 9, "seatMatrixIds": [4]}`); response.Code != http.StatusCreated {
+			t.Fatalf("Expected the seat to be held by someone else, got %d", response.Code)
+		}
+
+		webhook := paymentWebhook("payment.succeeded", "pay_3", map[string]string{"idempotentKey": "key-3"})
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+			t.Fatalf("Expected the delivery to be taken, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if failed := state(t, "key-3"); failed.Status != "failed" || failed.PaymentID != "pay_3" {
+			t.Errorf("Expected the paid checkout to fail, got %+v", failed)
+		}
+
+		if len(movieDB.booked[5]) != 3 {
+			t.Errorf("Expected no seat to be booked, got %d bookings", len(movieDB.booked[5]))
+		}
+	})
+
+	t.Run("Test if a paid checkout whose seats were not booked owes a refund", func(t *testing.T) {
+		owed := state(t, "key-3")
+
+		if !owed.RefundOwed || owed.RefundNoticeSentAt == nil {
+			t.Errorf("Expected the checkout to owe a refund, got %+v", owed)
+		}
+
+		if notice := mails[len(mails)-1]; notice.To != "user@example.test" || !strings.Contains(notice.Text, "refunded") {
+			t.Errorf("Expected the customer to be told of the refund, got %+v", notice)
+		}
+
+		// kept until it is refunded, the other checkouts expire
+		if ttl := mr.TTL("checkouts:key-3"); ttl != 0 {
+			t.Errorf("Expected the checkout to be kept, got a TTL of %v", ttl)
+		}
+
+		webhook := paymentWebhook("payment.succeeded", "pay_3", map[string]string{"idempotentKey": "key-3"})
+		sent := len(mails)
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK || len(mails) != sent {
+			t.Errorf("Expected a delivery again to send nothing, got %d and %d more mails", response.Code, len(mails)-sent)
+		}
+
+		var list api.RefundsOwedList
+
+		response := serve(http.MethodGet, "/v1/admin/checkouts/refunds-owed", admin, "")
+
+		if err := json.Unmarshal(response.Body.Bytes(), &list); err != nil || list.Total != 1 || len(list.Checkouts) != 1 || list.Checkouts[0].IdempotentKey != "key-3" {
+			t.Fatalf("Expected the checkout among the refunds owed, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if response := serve(http.MethodGet, "/v1/admin/checkouts/refunds-owed", user, ""); response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a user, got %d", response.Code)
+		}
+
+		if response := serve(http.MethodPost, "/v1/admin/checkouts/key-1/refunded", admin, ""); response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 for a checkout that owes no refund, got %d", response.Code)
+		}
+
+		if response := serve(http.MethodPost, "/v1/admin/checkouts/key-3/refunded", admin, ""); response.Code != http.StatusOK {
+			t.Fatalf("Expected the refund to be recorded, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if refunded := state(t, "key-3"); refunded.RefundedAt == nil {
+			t.Errorf("Expected the checkout to be refunded, got %+v", refunded)
+		}
+
+		if members, _ := mr.ZMembers("checkouts:refunds-owed"); len(members) != 0 {
+			t.Errorf("Expected no refund left owed, got %v", members)
+		}
+	})
+
+	t.Run("Test if payments of no checkout are ignored", func(t *testing.T) {
+		webhook := paymentWebhook("payment.succeeded", "pay_4", map[string]string{"idempotentKey": "missing"})
+
+		if response := serve(http.MethodPost, "/v1/webhooks/payments", "", webhook); response.Code != http.StatusOK {
+			t.Errorf("Expected the delivery to be taken, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if webhooks that are not signed are refused", func(t *testing.T) {
+		checkout(t, "key-5", "5")
+		webhook := paymentWebhook("payment.succeeded", "pay_5", map[string]string{"idempotentKey": "key-5"})
+
+		deliver := func(routes http.Handler, signature string) int {
+			request := httptest.NewRequest(http.MethodPost, "/v1/webhooks/payments", strings.NewReader(webhook))
+
+			if signature != "" {
+				signWebhook(request, webhook)
+				request.Header.Set("webhook-signature", signature)
+			}
+
+			response := httptest.NewRecorder()
+			routes.ServeHTTP(response, request)
+
+			return response.Code
+		}
+
+		if code := deliver(routes, ""); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a webhook without a signature, got %d", code)
+		}
+
+		if code := deliver(routes, "v1,bm90IGEgc2lnbmF0dXJl"); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a wrong signature, got %d", code)
+		}
+
+		unconfigured := app
+		unconfigured.PaymentWebhookSecret = ""
+
+		if code := deliver(unconfigured.Routes(), ""); code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 without a webhook secret, got %d", code)
+		}
+
+		if pending := state(t, "key-5"); pending.Status != "awaitingPayment" || len(movieDB.booked[5]) != 3 {
+			t.Errorf("Expected nothing to be booked, got %s and %d bookings", pending.Status, len(movieDB.booked[5]))
+		}
+	})
+}
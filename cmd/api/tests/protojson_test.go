@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	createdAt := time.Date(2026, time.March, 14, 18, 30, 0, 0, time.UTC)
+
+	body, err := utils.MarshalJSON(map[string]any{
+		"reviews": []*pb.Review{{MovieID: 1, ReviewID: 7, Rating: 5, CreatedAt: int32(createdAt.Unix())}},
+		"seat":    &pb.SeatMatrix{SeatNumber: "A1", Type: pb.SeatType_VIP},
+		"updated": createdAt,
+		"role":    pb.CastAndCrewType(0),
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	encoded := string(body)
+
+	t.Run("Test if field names are camel case", func(t *testing.T) {
+		if !strings.Contains(encoded, `"seatNumber":"A1"`) || !strings.Contains(encoded, `"reviewID":7`) {
+			t.Errorf("Expected proto JSON field names, got %s", encoded)
+		}
+	})
+
+	t.Run("Test if enums are encoded by name", func(t *testing.T) {
+		if !strings.Contains(encoded, `"type":"VIP"`) || !strings.Contains(encoded, `"role":"`+pb.CastAndCrewType(0).String()+`"`) {
+			t.Errorf("Expected enums as strings, got %s", encoded)
+		}
+	})
+
+	t.Run("Test if timestamps are RFC 3339", func(t *testing.T) {
+		if !strings.Contains(encoded, `"createdAt":"2026-03-14T18:30:00Z"`) || !strings.Contains(encoded, `"updated":"2026-03-14T18:30:00Z"`) {
+			t.Errorf("Expected RFC 3339 timestamps, got %s", encoded)
+		}
+	})
+
+	t.Run("Test if unpopulated fields are emitted", func(t *testing.T) {
+		if !strings.Contains(encoded, `"comment":""`) {
+			t.Errorf("Expected empty fields to be present, got %s", encoded)
+		}
+	})
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	t.Run("Test if proto requests accept snake case and enum names", func(t *testing.T) {
+		var request pb.GetAllMovieReviewsRequest
+
+		if err := utils.UnmarshalJSON([]byte(`{"movieID": 3, "sort_by": "DESCENDING", "filterBy": 1}`), &request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if request.MovieID != 3 || request.SortBy != pb.SortBy_DESCENDING || request.FilterBy != pb.FilterBy_DATE {
+			t.Errorf("Expected movie 3 sorted descending by date, got %v", &request)
+		}
+	})
+
+	t.Run("Test if BookSeats decodes camel case requests", func(t *testing.T) {
+		var request pb.BookSeatsRequest
+
+		if err := utils.UnmarshalJSON([]byte(`{"movieTimeSlotId": 5, "phoneNumber": 9876543210, "seats": [{"seatNumber": "A1", "seatMatrixID": 1}]}`), &request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if request.MovieTimeSlotId != 5 || request.PhoneNumber != 9876543210 || len(request.Seats) != 1 || request.Seats[0].SeatMatrixID != 1 {
+			t.Fatalf("Expected the camel case keys to be decoded, got %v", &request)
+		}
+
+		movieDB := newSeatMapMovieDB([]*pb.SeatMatrix{{Id: 1, SeatNumber: "A1", Row: 1, Column: 1, Price: 200, Type: pb.SeatType_NORMAL}})
+		app := api.Config{MovieDB_service: movieDB}
+
+		response := httptest.NewRecorder()
+		app.Routes().ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/v1/bookings", strings.NewReader(`{"movieTimeSlotId": 5, "venueId": 9, "seats": [{"seatNumber": "A1", "seatMatrixID": 1}]}`)))
+
+		if response.Code != http.StatusOK || len(movieDB.booked[5]) != 1 {
+			t.Errorf("Expected the seat to be booked for time slot 5, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if plain requests accept snake case keys", func(t *testing.T) {
+		var request struct {
+			MovieID   string          `json:"movieId"`
+			StartDate string          `json:"startDate"`
+			SortBy    utils.EnumValue `json:"sortBy"`
+		}
+
+		if err := utils.UnmarshalJSON([]byte(`{"movie_id": "3", "start_date": "2026-03-14", "sort_by": "descending"}`), &request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if request.MovieID != "3" || request.StartDate != "2026-03-14" {
+			t.Errorf("Expected the snake case keys to be decoded, got %+v", request)
+		}
+
+		if sortBy, err := request.SortBy.Parse(pb.SortBy_value); err != nil || sortBy != int32(pb.SortBy_DESCENDING) {
+			t.Errorf("Expected DESCENDING, got %d %v", sortBy, err)
+		}
+	})
+
+	t.Run("Test if unknown enum names are rejected", func(t *testing.T) {
+		if _, err := utils.EnumValue("SIDEWAYS").Parse(pb.SortBy_value); err == nil {
+			t.Errorf("Expected an error for an unknown enum name")
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// acceptingAuth accepts every token, the claims of the token decide who the
+// user is
+type acceptingAuth struct {
+	at.AuthServiceClient
+}
+
+func (acceptingAuth) ValidateToken(ctx context.Context, in *at.ValdateTokenRequest, opts ...grpc.CallOption) (*at.ValidateTokenResponse, error) {
+	return &at.ValidateTokenResponse{Valid: true, Status: 200}, nil
+}
+
+// testToken returns an unsigned jwt carrying the given claims
+func testToken(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+}
+
+// reviewStoreMovieDB keeps reviews in memory like MovieDB does
+type reviewStoreMovieDB struct {
+	pb.MovieDBServiceClient
+	mu      sync.Mutex
+	nextID  int32
+	reviews map[int32]*pb.Review
+	// listCalls counts the reads of every review of a movie
+	listCalls int
+}
+
+func newReviewStoreMovieDB() *reviewStoreMovieDB {
+	return &reviewStoreMovieDB{reviews: map[int32]*pb.Review{}}
+}
+
+func (m *reviewStoreMovieDB) AddReview(ctx context.Context, in *pb.Review, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+
+	review := &pb.Review{
+		ReviewID:  m.nextID,
+		MovieID:   in.MovieID,
+		UserID:    in.UserID,
+		Rating:    in.Rating,
+		Title:     in.Title,
+		Comment:   in.Comment,
+		CreatedAt: 1700000000 + m.nextID,
+	}
+
+	m.reviews[review.ReviewID] = review
+
+	return &pb.ReviewResponse{Status: 200, Message: "review added", Review: review}, nil
+}
+
+func (m *reviewStoreMovieDB) GetReview(ctx context.Context, in *pb.ReviewRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	review, ok := m.reviews[in.ReviewID]
+
+	if !ok {
+		return &pb.ReviewResponse{Status: 404}, nil
+	}
+
+	// a copy, like a review read over the wire
+	return &pb.ReviewResponse{Status: 200, Review: proto.Clone(review).(*pb.Review)}, nil
+}
+
+func (m *reviewStoreMovieDB) UpdateReview(ctx context.Context, in *pb.ReviewUpdateRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	review := m.reviews[in.ReviewID]
+	review.UserID, review.Title, review.Comment, review.Rating = in.UserID, in.Title, in.Comment, in.Rating
+
+	return &pb.ReviewResponse{Status: 200, Message: "review updated", Review: review}, nil
+}
+
+func (m *reviewStoreMovieDB) DeleteReview(ctx context.Context, in *pb.ReviewRequest, opts ...grpc.CallOption) (*pb.ReviewResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	review := m.reviews[in.ReviewID]
+	delete(m.reviews, in.ReviewID)
+
+	return &pb.ReviewResponse{Status: 200, Message: "review deleted", Review: review}, nil
+}
+
+func (m *reviewStoreMovieDB) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listCalls++
+
+	var reviews []*pb.Review
+
+	for _, review := range m.reviews {
+		if review.MovieID == in.MovieID {
+			reviews = append(reviews, review)
+		}
+	}
+
+	start := min(int(in.Offset), len(reviews))
+	end := min(start+int(in.Limit), len(reviews))
+
+	return &pb.ReviewListResponse{
+		Status:           200,
+		ReviewList:       &pb.ReviewList{Reviews: reviews[start:end]},
+		TotalReviewCount: int32(len(reviews)),
+	}, nil
+}
+
+func TestReviewLifecycle(t *testing.T) {
+	mr := miniredis.RunT(t)
+	movieDB := newReviewStoreMovieDB()
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	author := testToken(map[string]any{"user_id": 1, "role": "user"})
+	other := testToken(map[string]any{"user_id": 2, "role": "user"})
+	admin := testToken(map[string]any{"user_id": 3, "role": "admin"})
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+
+		if token != "" {
+			request.Header.Set("Authorization", token)
+		}
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	t.Run("Test if reviews need a signed in user", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", "", `{"title": "Great", "comment": "Loved it", "rating": 5}`)
+
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if the review is posted as the signed in user", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", author, `{"userId": 99, "title": "Great", "comment": "Loved it", "rating": 5}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if review := movieDB.reviews[1]; review == nil || review.UserID != 1 {
+			t.Errorf("Expected the review of user 1, got %v", review)
+		}
+	})
+
+	t.Run("Test if a user reviews a movie once", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", author, `{"title": "Again", "comment": "Still great", "rating": 4}`)
+
+		if response.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d", response.Code)
+		}
+
+		// a review MovieDB has but the broker never indexed counts as well
+		movieDB.reviews[50] = &pb.Review{ReviewID: 50, MovieID: 8, UserID: 2, Title: "Old", Comment: "Posted long ago", Rating: 3}
+
+		response = serve(http.MethodPost, "/v1/movies/8/reviews", other, `{"title": "New", "comment": "Posted today", "rating": 4}`)
+
+		if response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 for a review already in MovieDB, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if a review held for a moderator counts without reading every review", func(t *testing.T) {
+		mr.Set("reviews:author:9:2", "pending:4")
+		listCalls := movieDB.listCalls
+
+		response := serve(http.MethodPost, "/v1/movies/9/reviews", other, `{"title": "New", "comment": "Posted today", "rating": 4}`)
+
+		if response.Code != http.StatusConflict || movieDB.listCalls != listCalls {
+			t.Errorf("Expected 409 without reading the reviews, got %d after %d reads", response.Code, movieDB.listCalls-listCalls)
+		}
+	})
+
+	t.Run("Test if a review is refused when older reviews cannot be checked", func(t *testing.T) {
+		for id := int32(100); id < 1101; id++ {
+			movieDB.reviews[id] = &pb.Review{ReviewID: id, MovieID: 10, UserID: 1000 + id, Title: "Fine", Comment: "Fine", Rating: 3}
+		}
+
+		response := serve(http.MethodPost, "/v1/movies/10/reviews", other, `{"title": "New", "comment": "Posted today", "rating": 4}`)
+
+		if response.Code != http.StatusConflict {
+			t.Errorf("Expected 409 when some reviews went unchecked, got %d: %s", response.Code, response.Body.String())
+		}
+
+		for id := int32(100); id < 1101; id++ {
+			delete(movieDB.reviews, id)
+		}
+	})
+
+	t.Run("Test if only the author edits a review", func(t *testing.T) {
+		response := serve(http.MethodPut, "/v1/movies/7/reviews/1", other, `{"title": "Hijacked"}`)
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for another user, got %d", response.Code)
+		}
+
+		response = serve(http.MethodPut, "/v1/movies/7/reviews/1", author, `{"title": "Great, mostly"}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if review := movieDB.reviews[1]; review.Title != "Great, mostly" || review.Rating != 5 || review.Comment != "Loved it" {
+			t.Errorf("Expected only the title to change, got %v", review)
+		}
+
+		response = serve(http.MethodPut, "/v1/movies/8/reviews/1", author, `{"title": "Wrong movie"}`)
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a review of another movie, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if an admin deletes any review", func(t *testing.T) {
+		response := serve(http.MethodDelete, "/v1/movies/7/reviews/1", other, "")
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for another user, got %d", response.Code)
+		}
+
+		response = serve(http.MethodDelete, "/v1/movies/7/reviews/1", admin, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/7/reviews", author, `{"title": "Second look", "comment": "Better the second time", "rating": 5}`)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("Expected the author to review the movie again, got %d", response.Code)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// reviewsMovieDB serves the reviews of a single movie with the paging and
+// ordering of MovieDB
+type reviewsMovieDB struct {
+	pb.MovieDBServiceClient
+	mu      sync.Mutex
+	reviews []*pb.Review
+	calls   int
+}
+
+func (m *reviewsMovieDB) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls++
+
+	sorted := append([]*pb.Review(nil), m.reviews...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].CreatedAt, sorted[j].CreatedAt
+
+		if in.FilterBy == pb.FilterBy_RATING {
+			a, b = sorted[i].Rating, sorted[j].Rating
+		}
+
+		if in.SortBy == pb.SortBy_DESCENDING {
+			return a > b
+		}
+
+		return a < b
+	})
+
+	start := min(int(in.Offset), len(sorted))
+	end := min(start+int(in.Limit), len(sorted))
+
+	return &pb.ReviewListResponse{
+		Status:           200,
+		ReviewList:       &pb.ReviewList{Reviews: sorted[start:end]},
+		TotalReviewCount: int32(len(sorted)),
+		TotalVotes:       int32(len(sorted)),
+	}, nil
+}
+
+// reviewsPage is the part of a page of reviews the tests look at
+type reviewsPage struct {
+	Reviews []struct {
+		ReviewID int32 `json:"reviewID"`
+	} `json:"reviews"`
+	TotalReviewCount int32                     `json:"totalReviewCount"`
+	TotalVotes       int32                     `json:"totalVotes"`
+	Sort             string                    `json:"sort"`
+	Limit            int                       `json:"limit"`
+	NextCursor       string                    `json:"nextCursor"`
+	PrevCursor       string                    `json:"prevCursor"`
+	Votes            map[int32]api.ReviewVotes `json:"votes"`
+	Verified         map[int32]bool            `json:"verified"`
+}
+
+func TestMovieReviewPages(t *testing.T) {
+	movieDB := &reviewsMovieDB{}
+
+	for i := 1; i <= 120; i++ {
+		movieDB.reviews = append(movieDB.reviews, &pb.Review{
+			MovieID:   7,
+			ReviewID:  int32(i),
+			CreatedAt: int32(1700000000 + i),
+			Rating:    int32(i%5 + 1),
+			Comment:   "ok",
+		})
+	}
+
+	// the oldest review is the only substantial one
+	movieDB.reviews[0].Title = "Worth the ticket"
+	movieDB.reviews[0].Comment = "The second act drags, but the score and the final chase carry it home."
+
+	mr := miniredis.RunT(t)
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	page := func(t *testing.T, target string) reviewsPage {
+		t.Helper()
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var decoded reviewsPage
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("Error decoding the page: %v", err)
+		}
+
+		return decoded
+	}
+
+	t.Run("Test if the first page is the newest reviews", func(t *testing.T) {
+		first := page(t, "/v1/movies/7/reviews")
+
+		if first.Sort != "newest" || len(first.Reviews) != 10 || first.Reviews[0].ReviewID != 120 {
+			t.Fatalf("Expected the 10 newest reviews, got %s %v", first.Sort, first.Reviews)
+		}
+
+		if first.TotalReviewCount != 120 || first.TotalVotes != 120 {
+			t.Errorf("Expected the totals of the movie, got %d and %d", first.TotalReviewCount, first.TotalVotes)
+		}
+
+		if first.NextCursor == "" || first.PrevCursor != "" {
+			t.Errorf("Expected only a next cursor on the first page")
+		}
+
+		second := page(t, "/v1/movies/7/reviews?cursor="+first.NextCursor)
+
+		if second.Reviews[0].ReviewID != 110 || second.PrevCursor == "" {
+			t.Fatalf("Expected the second page to follow the first, got %v", second.Reviews)
+		}
+
+		back := page(t, "/v1/movies/7/reviews?cursor="+second.PrevCursor)
+
+		if back.Reviews[0].ReviewID != 120 {
+			t.Errorf("Expected the previous cursor to return to the first page, got %v", back.Reviews)
+		}
+	})
+
+	t.Run("Test if the page size is bounded", func(t *testing.T) {
+		bounded := page(t, "/v1/movies/7/reviews?limit=500")
+
+		if len(bounded.Reviews) != 50 || bounded.Limit != 50 {
+			t.Errorf("Expected at most 50 reviews, got %d", len(bounded.Reviews))
+		}
+	})
+
+	t.Run("Test if the last page has no next cursor", func(t *testing.T) {
+		cursor := page(t, "/v1/movies/7/reviews?sort=highest&limit=50").NextCursor
+		cursor = page(t, "/v1/movies/7/reviews?cursor="+cursor).NextCursor
+		last := page(t, "/v1/movies/7/reviews?cursor="+cursor)
+
+		if len(last.Reviews) != 20 || last.Limit != 50 || last.NextCursor != "" || last.Sort != "highest" {
+			t.Errorf("Expected the last 20 reviews without a next cursor, got %d %q", len(last.Reviews), last.NextCursor)
+		}
+	})
+
+	t.Run("Test if the most helpful reviews come first", func(t *testing.T) {
+		helpful := page(t, "/v1/movies/7/reviews?sort=helpful&limit=3")
+
+		if helpful.Reviews[0].ReviewID != 1 || helpful.Reviews[1].ReviewID != 120 {
+			t.Errorf("Expected the substantial review first and then the newest, got %v", helpful.Reviews)
+		}
+
+		next := page(t, "/v1/movies/7/reviews?cursor="+helpful.NextCursor)
+
+		if next.Sort != "helpful" || next.Reviews[0].ReviewID != 118 {
+			t.Errorf("Expected the cursor to keep the helpful order, got %s %v", next.Sort, next.Reviews)
+		}
+	})
+
+	t.Run("Test if the helpful order is ranked once for every page", func(t *testing.T) {
+		movieDB.mu.Lock()
+		calls := movieDB.calls
+		movieDB.mu.Unlock()
+
+		helpful := page(t, "/v1/movies/7/reviews?sort=helpful&limit=3")
+		page(t, "/v1/movies/7/reviews?cursor="+helpful.NextCursor)
+
+		movieDB.mu.Lock()
+		cached := movieDB.calls
+		movieDB.mu.Unlock()
+
+		if cached != calls {
+			t.Errorf("Expected the cached ranking to be served, got %d calls to MovieDB", cached-calls)
+		}
+
+		mr.FastForward(61 * time.Second)
+		page(t, "/v1/movies/7/reviews?sort=helpful&limit=3")
+
+		movieDB.mu.Lock()
+		defer movieDB.mu.Unlock()
+
+		if movieDB.calls == cached {
+			t.Errorf("Expected the ranking to be computed again once it expired")
+		}
+	})
+
+	t.Run("Test if the legacy alias keeps the ReviewListResponse shape", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/getAllMovieReview/7", strings.NewReader(`{"limit": 5}`)))
+
+		var legacy struct {
+			ReviewList struct {
+				Reviews []struct {
+					ReviewID int32 `json:"reviewID"`
+				} `json:"reviews"`
+			} `json:"reviewList"`
+			TotalReviewCount int32 `json:"totalReviewCount"`
+		}
+
+		if err := json.Unmarshal(response.Body.Bytes(), &legacy); err != nil || response.Code != http.StatusOK {
+			t.Fatalf("Expected a page of reviews, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if len(legacy.ReviewList.Reviews) != 5 || legacy.ReviewList.Reviews[0].ReviewID != 120 || legacy.TotalReviewCount != 120 {
+			t.Errorf("Expected the 5 newest reviews under reviewList, got %s", response.Body.String())
+		}
+	})
+
+	t.Run("Test if invalid cursors are rejected", func(t *testing.T) {
+		cursor := page(t, "/v1/movies/7/reviews").NextCursor
+		beyond := base64.RawURLEncoding.EncodeToString([]byte(`{"m": 7, "s": "newest", "o": 4294967296, "l": 10}`))
+
+		for _, target := range []string{
+			"/v1/movies/8/reviews?cursor=" + cursor,
+			"/v1/movies/7/reviews?cursor=" + beyond,
+			"/v1/movies/7/reviews?cursor=not-a-cursor",
+			"/v1/movies/7/reviews?sort=loudest",
+		} {
+			response := httptest.NewRecorder()
+			routes.ServeHTTP(response, httptest.NewRequest(http.MethodGet, target, nil))
+
+			if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), "Invalid reviews page") {
+				t.Errorf("Expected 400 for %s, got %d", target, response.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"testing"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+)
+
+func testCatalog() []*pb.Movie {
+	return []*pb.Movie{
+		{
+			Id:          1,
+			Title:       "Interstellar",
+			Description: "A team of explorers travel through a wormhole in space",
+			Language:    []string{"English"},
+			Type:        []string{"Sci-Fi", "Drama"},
+			CastCrew: []*pb.CastAndCrew{
+				{Name: "Christopher Nolan", Type: pb.CastAndCrewType_DIRECTOR},
+				{Name: "Matthew McConaughey", Type: pb.CastAndCrewType_ACTOR, CharacterName: "Cooper"},
+			},
+			Votes: 100,
+		},
+		{
+			Id:          2,
+			Title:       "Inception",
+			Description: "A thief who steals corporate secrets through dream-sharing technology",
+			Language:    []string{"English", "Japanese"},
+			Type:        []string{"Sci-Fi", "Action"},
+			CastCrew: []*pb.CastAndCrew{
+				{Name: "Christopher Nolan", Type: pb.CastAndCrewType_DIRECTOR},
+			},
+			Votes: 200,
+		},
+		{
+			Id:       3,
+			Title:    "Jawan",
+			Language: []string{"Hindi"},
+			Type:     []string{"Action"},
+		},
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	idx := search.NewIndex()
+	idx.Build(testCatalog(), "v1")
+
+	t.Run("Test if prefix query matches titles", func(t *testing.T) {
+		results := idx.Search("inc", search.Filters{}, 10)
+
+		if len(results) != 1 || results[0].Movie.Id != 2 {
+			t.Fatalf("Expected only Inception, got %v", results)
+		}
+	})
+
+	t.Run("Test if typos are tolerated", func(t *testing.T) {
+		results := idx.Search("intersteller", search.Filters{}, 10)
+
+		if len(results) != 1 || results[0].Movie.Id != 1 {
+			t.Fatalf("Expected only Interstellar, got %v", results)
+		}
+	})
+
+	t.Run("Test if cast names and filters are applied", func(t *testing.T) {
+		results := idx.Search("nolan", search.Filters{Languages: []string{"japanese"}}, 10)
+
+		if len(results) != 1 || results[0].Movie.Id != 2 {
+			t.Fatalf("Expected only Inception, got %v", results)
+		}
+	})
+
+	t.Run("Test if autocomplete suggests titles and names", func(t *testing.T) {
+		suggestions := idx.Autocomplete("chris", 5)
+
+		if len(suggestions) != 1 || suggestions[0] != "Christopher Nolan" {
+			t.Fatalf("Expected Christopher Nolan, got %v", suggestions)
+		}
+	})
+
+	t.Run("Test if people are grouped by role", func(t *testing.T) {
+		person, ok := idx.Person(search.PersonID("Christopher Nolan"))
+
+		if !ok {
+			t.Fatalf("Expected christopher-nolan to be indexed")
+		}
+
+		if len(person.Credits[pb.CastAndCrewType_DIRECTOR.String()]) != 2 {
+			t.Errorf("Expected 2 directing credits, got %v", person.Credits)
+		}
+	})
+}
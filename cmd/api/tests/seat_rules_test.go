@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+func TestSeatRules(t *testing.T) {
+	// row A has eight columns with the fifth left out, row B has three
+	var seats []*pb.SeatMatrix
+
+	for row, columns := range map[int32]int32{1: 8, 2: 3} {
+		for column := int32(1); column <= columns; column++ {
+			if row == 1 && column == 5 {
+				continue
+			}
+
+			seats = append(seats, &pb.SeatMatrix{
+				Id:         row*10 + column,
+				SeatNumber: fmt.Sprintf("%c%d", 'A'+row-1, column),
+				Row:        row,
+				Column:     column,
+				Price:      200,
+			})
+		}
+	}
+
+	mr := miniredis.RunT(t)
+	movieDB := newSeatMapMovieDB(seats)
+	movieDB.booked[5] = []*pb.BookedSeats{
+		{SeatMatrixID: 11, SeatNumber: "A1", IsBooked: true},
+		{SeatMatrixID: 16, SeatNumber: "A6", IsBooked: true},
+		{SeatNumber: "B1", IsBooked: true},
+	}
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		Validator:       validator.New(),
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+	admin := testToken(map[string]any{"user_id": 100, "email": "admin@example.test", "role": "admin"})
+
+	hold := func(seatIDs string) *httptest.ResponseRecorder {
+		return serve(http.MethodPost, "/v1/showtimes/5/holds", user, `{"venueId": 9, "seatMatrixIds": [`+seatIDs+`]}`)
+	}
+
+	t.Run("Test if a hold needs the venue", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/showtimes/5/holds", user, `{"seatMatrixIds": [12]}`)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 without a venue, got %d", response.Code)
+		}
+
+		response = hold("12, 99")
+
+		if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), `"seatMatrixIds":[99]`) {
+			t.Errorf("Expected 400 for a seat of another venue, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if a seat left on its own is rejected", func(t *testing.T) {
+		response := hold("13, 14")
+
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if !strings.Contains(response.Body.String(), "Seat A2 would be left empty") || !strings.Contains(response.Body.String(), `"seatMatrixIds":[12]`) {
+			t.Errorf("Expected the error to name the orphan seat, got %s", response.Body.String())
+		}
+	})
+
+	t.Run("Test if seats next to a missing cell are exempt", func(t *testing.T) {
+		response := hold("12, 13")
+
+		if response.Code != http.StatusCreated {
+			t.Errorf("Expected A4 next to the missing cell to be left, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if seats next to an aisle are exempt", func(t *testing.T) {
+		if response := hold("18"); response.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for leaving A7 between A6 and A8, got %d", response.Code)
+		}
+
+		response := serve(http.MethodPut, "/v1/admin/venue/9/seat-rules", admin, `{"aisles": [6]}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if response := hold("18"); response.Code != http.StatusCreated {
+			t.Errorf("Expected A7 next to the aisle to be left, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if a booking needs the venue", func(t *testing.T) {
+		booking := `{"movieId": 7, "movieTimeSlotId": 5, "email": "user@example.test", "seats": [{"seatNumber": "B3", "seatMatrixID": 23}]}`
+
+		if response := serve(http.MethodPost, "/v1/bookings", "", booking); response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 without a venue or a hold, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if bookings keep to the seat rules", func(t *testing.T) {
+		booking := `{"movieId": 7, "movieTimeSlotId": 5, "venueId": 9, "email": "user@example.test", "seats": [{"seatNumber": "B3"}]}`
+
+		response := serve(http.MethodPost, "/v1/bookings", "", booking)
+
+		if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), "Seat B2") {
+			t.Errorf("Expected 400 for leaving B2 between B1 and B3, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if venues can allow orphan seats", func(t *testing.T) {
+		response := serve(http.MethodPut, "/v1/admin/venue/9/seat-rules", admin, `{"allowOrphanSeats": true, "aisles": [6]}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodGet, "/v1/admin/venue/9/seat-rules", admin, "")
+
+		if !strings.Contains(response.Body.String(), `"allowOrphanSeats":true`) {
+			t.Errorf("Expected the rules to be kept, got %s", response.Body.String())
+		}
+
+		if response := hold("23"); response.Code != http.StatusCreated {
+			t.Errorf("Expected B2 to be left once allowed, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+}
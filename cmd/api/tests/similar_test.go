@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+)
+
+// similarCatalog adds to the test catalog a movie sharing only a language with
+// Interstellar and one sharing a single genre of many
+func similarCatalog() []*pb.Movie {
+	return append(testCatalog(),
+		&pb.Movie{Id: 4, Title: "Notting Hill", Language: []string{"English"}, Type: []string{"Romance"}, Votes: 500},
+		&pb.Movie{Id: 5, Title: "Ra.One", Language: []string{"Hindi"}, Type: []string{"Sci-Fi", "Action", "Comedy", "Family"}, Votes: 50},
+	)
+}
+
+func similarIDs(results []search.Result) []int32 {
+	ids := make([]int32, len(results))
+
+	for i, result := range results {
+		ids[i] = result.Movie.Id
+	}
+
+	return ids
+}
+
+func TestSimilar(t *testing.T) {
+	catalog := similarCatalog()
+	target := catalog[0]
+
+	t.Run("Test if candidates sharing a genre or crew are ranked by likeness", func(t *testing.T) {
+		ids := similarIDs(search.Similar(target, catalog, search.SimilarOptions{}, 10))
+
+		if fmt.Sprint(ids) != "[2 5]" {
+			t.Errorf("Expected Inception then Ra.One, got %v", ids)
+		}
+	})
+
+	t.Run("Test if a shared language alone is not enough", func(t *testing.T) {
+		for _, result := range search.Similar(target, catalog, search.SimilarOptions{}, 10) {
+			if result.Movie.Id == 4 || result.Movie.Id == 3 {
+				t.Errorf("Expected movies sharing no genre or crew to be left out, got %d", result.Movie.Id)
+			}
+		}
+	})
+
+	t.Run("Test if showing nearby raises the score", func(t *testing.T) {
+		far := search.Similar(target, catalog, search.SimilarOptions{}, 10)
+		near := search.Similar(target, catalog, search.SimilarOptions{Nearby: map[int32]bool{5: true}}, 10)
+
+		if len(far) != 2 || len(near) != 2 || near[1].Score <= far[1].Score || near[0].Score != far[0].Score {
+			t.Errorf("Expected only Ra.One to score higher once it is nearby, got %v and %v", far, near)
+		}
+	})
+
+	t.Run("Test if booked movies are not recommended again", func(t *testing.T) {
+		ids := similarIDs(search.Similar(target, catalog, search.SimilarOptions{History: []*pb.Movie{catalog[1]}}, 10))
+
+		if fmt.Sprint(ids) != "[5]" {
+			t.Errorf("Expected only Ra.One, got %v", ids)
+		}
+	})
+
+	t.Run("Test if the limit is applied", func(t *testing.T) {
+		if results := search.Similar(target, catalog, search.SimilarOptions{}, 1); len(results) != 1 {
+			t.Errorf("Expected 1 result, got %d", len(results))
+		}
+	})
+}
+
+func TestGetSimilarMovies(t *testing.T) {
+	seats := make([]*pb.SeatMatrix, 0, 4)
+
+	for i := int32(1); i <= 4; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, SeatNumber: fmt.Sprintf("A%d", i), Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	index := search.NewIndex()
+	index.Build(similarCatalog(), "v1")
+
+	mr := miniredis.RunT(t)
+
+	app := api.Config{
+		MovieDB_service: newSeatMapMovieDB(seats),
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		SearchIndex:     index,
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	similar := func(t *testing.T, token string) []int32 {
+		t.Helper()
+
+		response := serve(http.MethodGet, "/v1/movies/1/similar", token, "")
+
+		var results []struct {
+			Movie struct {
+				ID int32 `json:"id"`
+			} `json:"movie"`
+		}
+
+		if err := json.Unmarshal(response.Body.Bytes(), &results); err != nil || response.Code != http.StatusOK {
+			t.Fatalf("Expected similar movies, got %d: %s", response.Code, response.Body.String())
+		}
+
+		ids := make([]int32, len(results))
+
+		for i, result := range results {
+			ids[i] = result.Movie.ID
+		}
+
+		return ids
+	}
+
+	user := testToken(map[string]any{"user_id": 1, "email": "user@example.test", "role": "user"})
+
+	t.Run("Test if unknown movies are not found", func(t *testing.T) {
+		if response := serve(http.MethodGet, "/v1/movies/99/similar", "", ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if bookings in the request email are not the user's history", func(t *testing.T) {
+		serve(http.MethodPost, "/v1/bookings", "", `{"movieId": 2, "movieTimeSlotId": 5, "venueId": 9, "email": "user@example.test", "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}]}`)
+
+		if ids := similar(t, user); fmt.Sprint(ids) != "[2 5]" {
+			t.Errorf("Expected Inception to be recommended still, got %v", ids)
+		}
+	})
+
+	t.Run("Test if bookings at a venue not showing the movie are not recorded", func(t *testing.T) {
+		serve(http.MethodPost, "/v1/bookings", user, `{"movieId": 2, "movieTimeSlotId": 6, "venueId": 8, "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}]}`)
+
+		if ids := similar(t, user); fmt.Sprint(ids) != "[2 5]" {
+			t.Errorf("Expected Inception to be recommended still, got %v", ids)
+		}
+	})
+
+	t.Run("Test if movies the user booked are left out", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/bookings", user, `{"movieId": 2, "movieTimeSlotId": 7, "venueId": 9, "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}]}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected the booking to go through, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if ids := similar(t, user); fmt.Sprint(ids) != "[5]" {
+			t.Errorf("Expected only Ra.One, got %v", ids)
+		}
+
+		if ids := similar(t, ""); fmt.Sprint(ids) != "[2 5]" {
+			t.Errorf("Expected anonymous users to get Inception, got %v", ids)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
+)
+
+func TestTrendingMovies(t *testing.T) {
+	delhi := &pb.Venue{Id: 9, Address: "Connaught Place, New Delhi", Latitude: 28.63, Longitude: 77.21}
+	mumbai := &pb.Venue{Id: 8, Address: "Bandra West, Mumbai", Latitude: 19.06, Longitude: 72.83}
+
+	catalog := testCatalog()
+	catalog[0].Venues = []*pb.Venue{delhi}
+	catalog[1].Venues = []*pb.Venue{mumbai}
+	catalog[2].Venues = []*pb.Venue{delhi, mumbai}
+
+	index := search.NewIndex()
+	index.Build(catalog, "v1")
+
+	seats := make([]*pb.SeatMatrix, 0, 4)
+
+	for i := int32(1); i <= 4; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, SeatNumber: fmt.Sprintf("A%d", i), Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	mr := miniredis.RunT(t)
+
+	app := api.Config{
+		MovieDB_service: newSeatMapMovieDB(seats),
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		SearchIndex:     index,
+		Trending:        api.NewTrendingRanking(),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	trending := func(t *testing.T, query string) []int32 {
+		t.Helper()
+
+		response := serve(http.MethodGet, "/v1/movies/trending"+query, "")
+
+		var decoded struct {
+			Movies []struct {
+				Movie struct {
+					ID int32 `json:"id"`
+				} `json:"movie"`
+			} `json:"movies"`
+		}
+
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil || response.Code != http.StatusOK {
+			t.Fatalf("Expected trending movies, got %d: %s", response.Code, response.Body.String())
+		}
+
+		ids := make([]int32, len(decoded.Movies))
+
+		for i, movie := range decoded.Movies {
+			ids[i] = movie.Movie.ID
+		}
+
+		return ids
+	}
+
+	t.Run("Test if the ranking is not served before it is computed", func(t *testing.T) {
+		if response := serve(http.MethodGet, "/v1/movies/trending", ""); response.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503, got %d", response.Code)
+		}
+	})
+
+	t.Run("Test if movies without bookings are ranked by votes", func(t *testing.T) {
+		if err := app.RefreshTrending(context.Background()); err != nil {
+			t.Fatalf("Error refreshing trending movies: %v", err)
+		}
+
+		if ids := trending(t, ""); fmt.Sprint(ids) != "[2 1 3]" {
+			t.Errorf("Expected Inception, Interstellar then Jawan, got %v", ids)
+		}
+	})
+
+	t.Run("Test if bookings push a movie up", func(t *testing.T) {
+		serve(http.MethodPost, "/v1/bookings", `{"movieId": 3, "movieTimeSlotId": 5, "venueId": 9, "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}, {"seatNumber": "A3"}, {"seatNumber": "A4"}]}`)
+
+		// venue 8 does not show movie 1, the seats count for nothing
+		serve(http.MethodPost, "/v1/bookings", `{"movieId": 1, "movieTimeSlotId": 6, "venueId": 8, "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}, {"seatNumber": "A3"}, {"seatNumber": "A4"}]}`)
+
+		if err := app.RefreshTrending(context.Background()); err != nil {
+			t.Fatalf("Error refreshing trending movies: %v", err)
+		}
+
+		if ids := trending(t, ""); fmt.Sprint(ids) != "[3 2 1]" {
+			t.Errorf("Expected Jawan first and Interstellar unmoved, got %v", ids)
+		}
+
+		if ids := trending(t, "?limit=1"); fmt.Sprint(ids) != "[3]" {
+			t.Errorf("Expected only Jawan, got %v", ids)
+		}
+	})
+
+	t.Run("Test if a city name filters by venue address", func(t *testing.T) {
+		if ids := trending(t, "?city=mumbai"); fmt.Sprint(ids) != "[3 2]" {
+			t.Errorf("Expected the movies showing in Mumbai, got %v", ids)
+		}
+	})
+
+	t.Run("Test if coordinates filter by radius", func(t *testing.T) {
+		if ids := trending(t, "?latitude=28.61&longitude=77.23"); fmt.Sprint(ids) != "[3 1]" {
+			t.Errorf("Expected the movies showing near Delhi, got %v", ids)
+		}
+
+		if ids := trending(t, "?latitude=28.61&longitude=77.23&radius_km=2000"); fmt.Sprint(ids) != "[3 2 1]" {
+			t.Errorf("Expected every movie within 2000km, got %v", ids)
+		}
+
+		if response := serve(http.MethodGet, "/v1/movies/trending?latitude=28.61&longitude=77.23&radius_km=-1", ""); response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a negative radius, got %d", response.Code)
+		}
+	})
+}
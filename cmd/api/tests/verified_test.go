@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// bookingMovieDB books seats on top of the review store
+type bookingMovieDB struct {
+	*reviewStoreMovieDB
+	bookingsMu sync.Mutex
+	booked     map[int32][]*pb.BookedSeats
+}
+
+func (m *bookingMovieDB) BookSeats(ctx context.Context, in *pb.BookSeatsRequest, opts ...grpc.CallOption) (*pb.BookSeatsResponse, error) {
+	m.bookingsMu.Lock()
+	defer m.bookingsMu.Unlock()
+
+	for _, seat := range in.Seats {
+		m.booked[in.MovieTimeSlotId] = append(m.booked[in.MovieTimeSlotId], &pb.BookedSeats{
+			SeatNumber:      seat.SeatNumber,
+			SeatMatrixID:    seat.SeatMatrixID,
+			MovieTimeSlotID: in.MovieTimeSlotId,
+			IsBooked:        true,
+		})
+	}
+
+	return &pb.BookSeatsResponse{Status: 200, Message: "seats booked"}, nil
+}
+
+// GetMovie shows every movie at venue 9, venue 8 has a time slot of no movie
+func (m *bookingMovieDB) GetMovie(ctx context.Context, in *pb.MovieRequest, opts ...grpc.CallOption) (*pb.MovieResponse, error) {
+	id, _ := strconv.Atoi(in.Movieid)
+
+	return &pb.MovieResponse{Status: 200, Movie: &pb.Movie{
+		Id:    int32(id),
+		Title: "Interstellar",
+		Venues: []*pb.Venue{{
+			Id:             9,
+			Name:           "PVR Select City",
+			MovieTimeSlots: []*pb.MovieTimeSlot{{Date: "2026-10-20", StartTime: "18:00", Movieid: int32(id), Venueid: 9}},
+		}, {
+			// a time slot that does not name its movie shows none
+			Id:             8,
+			Name:           "INOX Nehru Place",
+			MovieTimeSlots: []*pb.MovieTimeSlot{{Date: "2026-10-20", StartTime: "21:00", Venueid: 8}},
+		}},
+	}}, nil
+}
+
+func (m *bookingMovieDB) GetBookedSeats(ctx context.Context, in *pb.GetBookedSeatsRequest, opts ...grpc.CallOption) (*pb.GetBookedSeatsResponse, error) {
+	m.bookingsMu.Lock()
+	defer m.bookingsMu.Unlock()
+
+	return &pb.GetBookedSeatsResponse{Status: 200, BookedSeats: m.booked[in.MovieTimeSlotId]}, nil
+}
+
+func TestVerifiedViewers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	seats := make([]*pb.SeatMatrix, 0, 4)
+
+	for i := int32(1); i <= 4; i++ {
+		seats = append(seats, &pb.SeatMatrix{Id: i, SeatNumber: fmt.Sprintf("A%d", i), Row: 1, Column: i, Price: 200, Type: pb.SeatType_NORMAL})
+	}
+
+	movieDB := newSeatMapMovieDB(seats)
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	viewer := testToken(map[string]any{"user_id": 1, "email": "viewer@example.test", "role": "user"})
+	stranger := testToken(map[string]any{"user_id": 2, "email": "stranger@example.test", "role": "user"})
+	admin := testToken(map[string]any{"user_id": 100, "email": "admin@example.test", "role": "admin"})
+
+	review := `{"title": "A slow burn", "comment": "The last twenty minutes make up for a patchy middle act.", "rating": 4}`
+
+	response := serve(http.MethodPost, "/v1/bookings", viewer, `{"movieId": 7, "movieTimeSlotId": 5, "venueId": 9, "email": "tickets@example.test", "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}]}`)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected the booking to go through, got %d: %s", response.Code, response.Body.String())
+	}
+
+	// the email of the request does not make its owner a viewer
+	response = serve(http.MethodPost, "/v1/bookings", "", `{"movieId": 8, "movieTimeSlotId": 6, "venueId": 9, "email": "stranger@example.test", "seats": [{"seatNumber": "A1"}, {"seatNumber": "A2"}]}`)
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected the booking to go through, got %d: %s", response.Code, response.Body.String())
+	}
+
+	t.Run("Test if movies take reviews of verified viewers only when set", func(t *testing.T) {
+		response := serve(http.MethodPut, "/v1/admin/movie/7/review-settings", admin, `{"verifiedOnly": true}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/7/reviews", stranger, review)
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for a user without a booking, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/7/reviews", viewer, review)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("Expected the verified viewer to review, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodGet, "/v1/admin/movie/7/review-settings", admin, "")
+
+		if !strings.Contains(response.Body.String(), `"verifiedOnly":true`) {
+			t.Errorf("Expected the setting to be kept, got %s", response.Body.String())
+		}
+	})
+
+	t.Run("Test if reviews of other movies are not verified", func(t *testing.T) {
+		response := serve(http.MethodPost, "/v1/movies/8/reviews", viewer, `{"title": "Loud", "comment": "Big set pieces and little else.", "rating": 2}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/8/reviews", stranger, `{"title": "Fine", "comment": "Good cast, thin plot.", "rating": 3}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if seats booked at a venue not showing the movie do not verify", func(t *testing.T) {
+		// slot 6 has A1 booked, at venue 8 which does not show movie 7, and an
+		// entry without its venue cannot be tied to the movie at all
+		mr.SAdd("bookings:user:stranger@example.test:movie:7:seats", "6:8:A1", "6:A2")
+
+		response := serve(http.MethodPost, "/v1/movies/7/reviews", stranger, `{"title": "Gripping", "comment": "Kept me on the edge of my seat.", "rating": 5}`)
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("Test if the badge is in the reviews page", func(t *testing.T) {
+		pages := map[string]reviewsPage{}
+
+		for _, movie := range []string{"7", "8"} {
+			response := serve(http.MethodGet, "/v1/movies/"+movie+"/reviews", "", "")
+
+			var page reviewsPage
+
+			if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Error decoding reviews: %v", err)
+			}
+
+			pages[movie] = page
+		}
+
+		if !pages["7"].Verified[1] {
+			t.Errorf("Expected the review of the viewer to be verified, got %v", pages["7"].Verified)
+		}
+
+		if len(pages["8"].Verified) != 0 {
+			t.Errorf("Expected no verified reviews of a movie nobody booked, got %v", pages["8"].Verified)
+		}
+	})
+
+	t.Run("Test if released seats do not verify", func(t *testing.T) {
+		movieDB.bookingsMu.Lock()
+		delete(movieDB.booked, 5)
+		movieDB.bookingsMu.Unlock()
+
+		response := serve(http.MethodDelete, "/v1/movies/7/reviews/1", viewer, "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		response = serve(http.MethodPost, "/v1/movies/7/reviews", viewer, review)
+
+		if response.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 once the booking is gone, got %d: %s", response.Code, response.Body.String())
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// versionedMovieDB records the requests the v1 routes and their legacy
+// aliases send to the backend
+type versionedMovieDB struct {
+	pb.MovieDBServiceClient
+	mu             sync.Mutex
+	reviewRequests []*pb.GetAllMovieReviewsRequest
+	seatRequests   []*pb.GetBookedSeatsRequest
+}
+
+func (v *versionedMovieDB) GetAllMovieReviews(ctx context.Context, in *pb.GetAllMovieReviewsRequest, opts ...grpc.CallOption) (*pb.ReviewListResponse, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.reviewRequests = append(v.reviewRequests, in)
+
+	return &pb.ReviewListResponse{Status: 200, ReviewList: &pb.ReviewList{}}, nil
+}
+
+func (v *versionedMovieDB) GetBookedSeats(ctx context.Context, in *pb.GetBookedSeatsRequest, opts ...grpc.CallOption) (*pb.GetBookedSeatsResponse, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.seatRequests = append(v.seatRequests, in)
+
+	return &pb.GetBookedSeatsResponse{Status: 200, BookedSeats: []*pb.BookedSeats{{SeatNumber: "A1", MovieTimeSlotID: in.MovieTimeSlotId}}}, nil
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	movieDB := &versionedMovieDB{}
+	app := api.Config{MovieDB_service: movieDB}
+	routes := app.Routes()
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+		return response
+	}
+
+	t.Run("Test if v1 reads take query parameters", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/movies/7/reviews?limit=5&offset=10&sortBy=ASCENDING&filterBy=RATING", "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		got := movieDB.reviewRequests[len(movieDB.reviewRequests)-1]
+
+		if got.MovieID != 7 || got.Limit != 5 || got.Offset != 10 || got.SortBy != pb.SortBy_ASCENDING || got.FilterBy != pb.FilterBy_RATING {
+			t.Errorf("Expected the query parameters to reach the backend, got %v", got)
+		}
+
+		if response.Header().Get("Deprecation") != "" {
+			t.Errorf("Expected no Deprecation header on a v1 route")
+		}
+	})
+
+	t.Run("Test if url parameters fill the request", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/showtimes/42/seats", "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if got := movieDB.seatRequests[len(movieDB.seatRequests)-1]; got.MovieTimeSlotId != 42 {
+			t.Errorf("Expected movie time slot 42, got %d", got.MovieTimeSlotId)
+		}
+	})
+
+	t.Run("Test if legacy routes are deprecated aliases", func(t *testing.T) {
+		response := serve(http.MethodPost, "/getAllMovieReview/7", `{"limit": 5}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if !strings.HasPrefix(response.Header().Get("Deprecation"), "@") || response.Header().Get("Sunset") == "" {
+			t.Errorf("Expected Deprecation and Sunset headers, got %v", response.Header())
+		}
+
+		if link := response.Header().Get("Link"); link != `</v1/movies/7/reviews>; rel="successor-version"` {
+			t.Errorf("Expected a link to the v1 route, got %q", link)
+		}
+	})
+
+	t.Run("Test if legacy routes with body parameters have no successor link", func(t *testing.T) {
+		response := serve(http.MethodPost, "/GetBookedSeats", `{"movie_time_slot_id": 42}`)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if response.Header().Get("Sunset") == "" || response.Header().Get("Link") != "" {
+			t.Errorf("Expected a Sunset header and no Link, got %v", response.Header())
+		}
+	})
+	t.Run("Test if the admin routes keep their legacy prefix", func(t *testing.T) {
+		response := serve(http.MethodGet, "/admin/metrics", "")
+
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 without a token, got %d", response.Code)
+		}
+
+		if link := response.Header().Get("Link"); link != `</v1/admin/metrics>; rel="successor-version"` {
+			t.Errorf("Expected a link to the v1 admin route, got %q", link)
+		}
+
+		response = serve(http.MethodGet, "/admin/movie/7/review-settings", "")
+
+		if link := response.Header().Get("Link"); link != `</v1/admin/movie/7/review-settings>; rel="successor-version"` {
+			t.Errorf("Expected a link to the nested v1 admin route, got %q", link)
+		}
+	})
+}
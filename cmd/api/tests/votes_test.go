@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"github.com/kartik7120/booking_broker-service/cmd/api"
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+func TestReviewVotes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	movieDB := newReviewStoreMovieDB()
+
+	seed := []*pb.Review{
+		{MovieID: 7, UserID: 1, Rating: 4, Title: "A patient thriller", Comment: "It takes its time with the setup, but the last act pays off every thread it laid down, and the score keeps the tension up throughout."},
+		{MovieID: 7, UserID: 2, Rating: 5, Title: "", Comment: "Great"},
+		{MovieID: 7, UserID: 3, Rating: 3, Title: "Fine", Comment: "Good cast, thin plot."},
+	}
+
+	for _, review := range seed {
+		movieDB.AddReview(context.Background(), review)
+	}
+
+	app := api.Config{
+		MovieDB_service: movieDB,
+		Auth_Service:    acceptingAuth{},
+		RedisClient:     redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	routes := app.Routes()
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", token)
+
+		response := httptest.NewRecorder()
+		routes.ServeHTTP(response, request)
+
+		return response
+	}
+
+	user := func(id int) string {
+		return testToken(map[string]any{"user_id": id, "role": "user"})
+	}
+
+	vote := func(t *testing.T, token string, reviewID int, vote string) api.ReviewVotes {
+		t.Helper()
+
+		method, body := http.MethodPut, `{"vote": "`+vote+`"}`
+
+		if vote == "" {
+			method, body = http.MethodDelete, ""
+		}
+
+		response := serve(method, fmt.Sprintf("/v1/movies/7/reviews/%d/vote", reviewID), token, body)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var votes api.ReviewVotes
+
+		if err := json.Unmarshal(response.Body.Bytes(), &votes); err != nil {
+			t.Fatalf("Error decoding votes: %v", err)
+		}
+
+		return votes
+	}
+
+	helpfulPage := func(t *testing.T) reviewsPage {
+		t.Helper()
+
+		response := serve(http.MethodGet, "/v1/movies/7/reviews?sort=helpful", "", "")
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		var page reviewsPage
+
+		if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Error decoding reviews: %v", err)
+		}
+
+		return page
+	}
+
+	order := func(page reviewsPage) []int32 {
+		var ids []int32
+
+		for _, review := range page.Reviews {
+			ids = append(ids, review.ReviewID)
+		}
+
+		return ids
+	}
+
+	t.Run("Test if a user has one vote per review", func(t *testing.T) {
+		if got := vote(t, user(10), 2, "helpful"); got.Helpful != 1 || got.Unhelpful != 0 || got.Vote != "helpful" {
+			t.Errorf("Expected one helpful vote, got %+v", got)
+		}
+
+		if got := vote(t, user(10), 2, "helpful"); got.Helpful != 1 {
+			t.Errorf("Expected voting twice to count once, got %+v", got)
+		}
+
+		if got := vote(t, user(10), 2, "unhelpful"); got.Helpful != 0 || got.Unhelpful != 1 {
+			t.Errorf("Expected the vote to be replaced, got %+v", got)
+		}
+
+		if got := vote(t, user(10), 2, ""); got.Helpful != 0 || got.Unhelpful != 0 {
+			t.Errorf("Expected the vote to be taken back, got %+v", got)
+		}
+
+		if got := vote(t, user(10), 2, ""); got.Helpful != 0 || got.Unhelpful != 0 {
+			t.Errorf("Expected taking back a missing vote to change nothing, got %+v", got)
+		}
+	})
+
+	t.Run("Test if invalid votes are rejected", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			target string
+			token  string
+			body   string
+			status int
+		}{
+			{"anonymous", http.MethodPut, "/v1/movies/7/reviews/2/vote", "", `{"vote": "helpful"}`, http.StatusUnauthorized},
+			{"author", http.MethodPut, "/v1/movies/7/reviews/2/vote", user(2), `{"vote": "helpful"}`, http.StatusForbidden},
+			{"unknown vote", http.MethodPut, "/v1/movies/7/reviews/2/vote", user(10), `{"vote": "funny"}`, http.StatusBadRequest},
+			{"unknown review", http.MethodPut, "/v1/movies/7/reviews/99/vote", user(10), `{"vote": "helpful"}`, http.StatusNotFound},
+			{"review of another movie", http.MethodPut, "/v1/movies/8/reviews/2/vote", user(10), `{"vote": "helpful"}`, http.StatusNotFound},
+		}
+
+		for _, test := range tests {
+			if response := serve(test.method, test.target, test.token, test.body); response.Code != test.status {
+				t.Errorf("Expected %d for the %s, got %d: %s", test.status, test.name, response.Code, response.Body.String())
+			}
+		}
+	})
+
+	t.Run("Test if concurrent votes are all counted", func(t *testing.T) {
+		var wg sync.WaitGroup
+
+		for id := 100; id < 120; id++ {
+			wg.Add(1)
+
+			go func(id int) {
+				defer wg.Done()
+
+				serve(http.MethodPut, "/v1/movies/7/reviews/2/vote", user(id), `{"vote": "helpful"}`)
+			}(id)
+		}
+
+		wg.Wait()
+
+		if got := vote(t, user(120), 2, "helpful"); got.Helpful != 21 {
+			t.Errorf("Expected 21 helpful votes, got %+v", got)
+		}
+	})
+
+	t.Run("Test if votes decide the helpful order", func(t *testing.T) {
+		for id := 200; id < 210; id++ {
+			vote(t, user(id), 1, "unhelpful")
+		}
+
+		page := helpfulPage(t)
+
+		if got := order(page); fmt.Sprint(got) != "[2 3 1]" {
+			t.Errorf("Expected the voted up review first and the voted down review last, got %v", got)
+		}
+
+		if page.Votes[2].Helpful != 21 || page.Votes[1].Unhelpful != 10 {
+			t.Errorf("Expected the tallies in the page, got %+v", page.Votes)
+		}
+
+		if _, ok := page.Votes[3]; ok {
+			t.Errorf("Expected no tally for a review nobody voted on")
+		}
+	})
+
+	t.Run("Test if tallies are merged into other orders", func(t *testing.T) {
+		response := serve(http.MethodGet, "/v1/movies/7/reviews?sort=newest", "", "")
+
+		var page reviewsPage
+
+		if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Error decoding reviews: %v", err)
+		}
+
+		if page.Votes[2].Helpful != 21 {
+			t.Errorf("Expected the tallies in the page, got %+v", page.Votes)
+		}
+	})
+
+	t.Run("Test if deleting a review drops its votes", func(t *testing.T) {
+		if response := serve(http.MethodDelete, "/v1/movies/7/reviews/2", user(2), ""); response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+		}
+
+		if mr.Exists("reviews:votes:2") || mr.Exists("reviews:tally:2") {
+			t.Errorf("Expected the votes of the deleted review to be dropped")
+		}
+	})
+}
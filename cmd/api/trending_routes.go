@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// trendingRefreshInterval is how often the trending scores are recomputed
+const trendingRefreshInterval = 15 * time.Minute
+
+// Signals older than their window no longer count, inside the window they decay
+// exponentially with the given half life
+const (
+	bookingWindowHours   = 72
+	bookingHalfLife      = 24 * time.Hour
+	reviewWindow         = 7 * 24 * time.Hour
+	reviewHalfLife       = 48 * time.Hour
+	recentReviewsFetched = 50
+	trendingConcurrency  = 8
+)
+
+// Weights of the trending score
+const (
+	bookingVelocityWeight = 3.0
+	reviewVolumeWeight    = 2.0
+	votesWeight           = 0.5
+	trendingRankingWeight = 1.0
+)
+
+const (
+	defaultTrendingLimit = 20
+	maxTrendingLimit     = 100
+	defaultCityRadiusKm  = 25.0
+)
+
+type TrendingMovie struct {
+	Movie            *pb.Movie `json:"movie"`
+	Score            float64   `json:"score"`
+	RecentBookings   float64   `json:"recentBookings"`
+	RecentReviews    float64   `json:"recentReviews"`
+	AverageRating    float64   `json:"averageRating"`
+	TotalReviewCount int32     `json:"totalReviewCount"`
+}
+
+// TrendingRanking holds the latest computed trending scores, ordered best
+// first
+type TrendingRanking struct {
+	mu         sync.RWMutex
+	movies     []TrendingMovie
+	computedAt time.Time
+}
+
+func NewTrendingRanking() *TrendingRanking {
+	return &TrendingRanking{}
+}
+
+func (t *TrendingRanking) set(movies []TrendingMovie) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.movies = movies
+	t.computedAt = time.Now()
+}
+
+// Snapshot returns the current ranking and when it was computed
+func (t *TrendingRanking) Snapshot() ([]TrendingMovie, time.Time) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.movies, t.computedAt
+}
+
+// decayed is the weight of a signal of the given age, it halves every halfLife
+func decayed(age time.Duration, halfLife time.Duration) float64 {
+	return math.Exp2(-age.Hours() / halfLife.Hours())
+}
+
+// movieReviewSignal returns the decayed volume and the average rating of the
+// reviews posted for movieID within reviewWindow
+func (c *Config) movieReviewSignal(ctx context.Context, movieID int32, now time.Time) (volume float64, averageRating float64, total int32, err error) {
+	response, err := c.MovieDB_service.GetAllMovieReviews(ctx, &pb.GetAllMovieReviewsRequest{
+		MovieID:  movieID,
+		Limit:    recentReviewsFetched,
+		Offset:   0,
+		SortBy:   pb.SortBy_DESCENDING,
+		FilterBy: pb.FilterBy_DATE,
+	})
+
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if response == nil || response.ReviewList == nil {
+		return 0, 0, 0, nil
+	}
+
+	var ratingSum float64
+	var rated int
+
+	for _, review := range response.ReviewList.Reviews {
+		age := now.Sub(time.Unix(int64(review.CreatedAt), 0))
+
+		if age < 0 {
+			age = 0
+		}
+
+		if age > reviewWindow {
+			continue
+		}
+
+		volume += decayed(age, reviewHalfLife)
+		ratingSum += float64(review.Rating)
+		rated++
+	}
+
+	if rated > 0 {
+		averageRating = ratingSum / float64(rated)
+	}
+
+	return volume, averageRating, response.TotalReviewCount, nil
+}
+
+// scoreTrendingMovie combines the signals of a single movie
+func (c *Config) scoreTrendingMovie(ctx context.Context, movie *pb.Movie, now time.Time) TrendingMovie {
+	trending := TrendingMovie{Movie: movie}
+
+	// only bookings made at a venue showing the movie are counted, see
+	// recordBooking
+	counts, err := c.bookingVelocity(ctx, movie.Id, bookingWindowHours)
+
+	if err != nil {
+		log.Error("error getting booking velocity for trending: ", err)
+	}
+
+	for hour, count := range counts {
+		trending.RecentBookings += float64(count) * decayed(time.Duration(hour)*time.Hour, bookingHalfLife)
+	}
+
+	trending.RecentReviews, trending.AverageRating, trending.TotalReviewCount, err = c.movieReviewSignal(ctx, movie.Id, now)
+
+	if err != nil {
+		log.Error("error getting reviews for trending: ", err)
+	}
+
+	trending.Score = bookingVelocityWeight * math.Log1p(trending.RecentBookings)
+
+	// Recent reviews only push a movie up if people liked it, a 1 star review
+	// storm counts for a fifth of a 5 star one
+	if trending.AverageRating > 0 {
+		trending.Score += reviewVolumeWeight * math.Log1p(trending.RecentReviews) * trending.AverageRating / 5
+	}
+
+	trending.Score += votesWeight * math.Log1p(float64(max(movie.Votes, 0)))
+
+	if movie.Ranking > 0 {
+		trending.Score += trendingRankingWeight / float64(movie.Ranking)
+	}
+
+	return trending
+}
+
+// RefreshTrending recomputes the trending score of every movie in the catalog
+func (c *Config) RefreshTrending(ctx context.Context) error {
+	if c.Trending == nil {
+		return fmt.Errorf("trending ranking is not configured")
+	}
+
+	index, err := c.catalogIndex(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	movies := index.Movies()
+	scored := make([]TrendingMovie, len(movies))
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, trendingConcurrency)
+
+	for i, movie := range movies {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, movie *pb.Movie) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			scored[i] = c.scoreTrendingMovie(ctx, movie, now)
+		}(i, movie)
+	}
+
+	wg.Wait()
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	c.Trending.set(scored)
+
+	return nil
+}
+
+// StartTrendingRanker computes the trending scores right away and then keeps
+// recomputing them until ctx is cancelled
+func (c *Config) StartTrendingRanker(ctx context.Context) {
+	refresh := func() {
+		refreshCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+
+		if err := c.RefreshTrending(refreshCtx); err != nil {
+			log.Error("error refreshing trending movies: ", err)
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(trendingRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// distanceKm is the great circle distance between two coordinates
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// venueFilter decides whether a venue belongs to the requested city
+type venueFilter func(venue *pb.Venue) bool
+
+// trendingVenueFilter builds the city filter from the query. A city can either
+// be given by name, matched against the venue address, or by coordinates and
+// an optional radius_km. nil means the global view was requested.
+func trendingVenueFilter(r *http.Request) (venueFilter, error) {
+	if city := strings.TrimSpace(r.URL.Query().Get("city")); city != "" {
+		city = strings.ToLower(city)
+
+		return func(venue *pb.Venue) bool {
+			return strings.Contains(strings.ToLower(venue.Address), city)
+		}, nil
+	}
+
+	latitude, longitude, ok, err := queryCoordinates(r)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	radius := defaultCityRadiusKm
+
+	if raw := r.URL.Query().Get("radius_km"); raw != "" {
+		radius, err = strconv.ParseFloat(raw, 64)
+
+		if err != nil || radius <= 0 {
+			return nil, fmt.Errorf("radius_km must be a positive number")
+		}
+	}
+
+	return func(venue *pb.Venue) bool {
+		return distanceKm(latitude, longitude, float64(venue.Latitude), float64(venue.Longitude)) <= radius
+	}, nil
+}
+
+func (c *Config) GetTrendingMovies(w http.ResponseWriter, r *http.Request) {
+	if c.Trending == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Trending movies are not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, err := queryLimit(r, defaultTrendingLimit, maxTrendingLimit)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	inCity, err := trendingVenueFilter(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	ranking, computedAt := c.Trending.Snapshot()
+
+	if computedAt.IsZero() {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Trending movies are not computed yet"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	movies := []TrendingMovie{}
+
+	for _, trending := range ranking {
+		if len(movies) >= limit {
+			break
+		}
+
+		if inCity != nil {
+			showing := false
+
+			for _, venue := range trending.Movie.Venues {
+				if inCity(venue) {
+					showing = true
+					break
+				}
+			}
+
+			if !showing {
+				continue
+			}
+		}
+
+		movies = append(movies, trending)
+	}
+
+	jsonResponse, err := utils.MarshalJSON(map[string]any{
+		"computedAt": computedAt,
+		"movies":     movies,
+	})
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error marshalling JSON response: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(jsonResponse)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error writing JSON response: %v"}`, err), http.StatusInternalServerError)
+	}
+}
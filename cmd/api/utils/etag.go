@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Cache-Control policies used by the route groups
+const (
+	// CachePublic is used by catalog endpoints that are the same for every
+	// client, CDNs may serve them for a minute and revalidate in the background
+	CachePublic = "public, max-age=60, stale-while-revalidate=300"
+	// CachePublicLong is used by feeds that change at most a few times a day
+	CachePublicLong = "public, max-age=3600"
+	// CacheRevalidate is used by live seat data, clients keep a copy but must
+	// revalidate it with the ETag on every poll
+	CacheRevalidate = "no-cache"
+	// CachePrivate is used by responses personalised for the signed in user
+	CachePrivate = "private, max-age=60"
+	// CacheNoStore is used by auth, booking, payment and admin endpoints
+	CacheNoStore = "no-store"
+)
+
+// StrongETag returns a strong entity tag for the response body
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETagMatches reports whether the If-None-Match header matches the entity
+// tag, If-None-Match uses the weak comparison so W/ prefixes are ignored
+func ETagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CacheControl sets the Cache-Control policy of a route group, error responses
+// are never cached
+func CacheControl(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", policy)
+
+			if policy != CacheNoStore {
+				w = &cacheControlWriter{ResponseWriter: w}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type cacheControlWriter struct {
+	http.ResponseWriter
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest {
+		w.Header().Set("Cache-Control", CacheNoStore)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// ETag buffers successful responses and tags them with a strong ETag computed
+// from the body, unless the handler already set one from a cached version.
+// Requests whose If-None-Match matches the tag get a 304 Not Modified without
+// a body. It is only mounted on read endpoints, some of which are POST routes
+// that take their filters in the body
+func ETag(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffered := &bufferedWriter{ResponseWriter: w}
+
+		next.ServeHTTP(buffered, r)
+
+		status := buffered.status
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		etag := w.Header().Get("ETag")
+
+		if etag == "" {
+			etag = StrongETag(buffered.body.Bytes())
+			w.Header().Set("ETag", etag)
+		}
+
+		if ETagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(buffered.body.Bytes())
+	})
+}
+
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(b)
+}
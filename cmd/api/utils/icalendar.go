@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type CalendarEvent struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	URL         string
+}
+
+// escapeICSText escapes a TEXT value as described in RFC 5545 section 3.3.11
+func escapeICSText(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+
+	return replacer.Replace(s)
+}
+
+// foldICSLine splits content lines longer than 75 octets, continuation lines
+// start with a single space. Lines are never split inside a UTF-8 sequence.
+func foldICSLine(line string) string {
+	const limit = 75
+
+	if len(line) <= limit {
+		return line + "\r\n"
+	}
+
+	var b strings.Builder
+	width := 0
+
+	for _, r := range line {
+		size := len(string(r))
+
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+
+		b.WriteRune(r)
+		width += size
+	}
+
+	b.WriteString("\r\n")
+
+	return b.String()
+}
+
+// BuildICalendar renders events as an iCalendar (RFC 5545) document made of
+// all day events
+func BuildICalendar(name string, events []CalendarEvent, now time.Time) string {
+	var b strings.Builder
+
+	write := func(format string, args ...any) {
+		b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+	}
+
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//booking broker service//releases calendar//EN")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:%s", escapeICSText(name))
+
+	for _, event := range events {
+		write("BEGIN:VEVENT")
+		write("UID:%s", event.UID)
+		write("DTSTAMP:%s", stamp)
+		write("DTSTART;VALUE=DATE:%s", event.Date.Format("20060102"))
+		write("DTEND;VALUE=DATE:%s", event.Date.AddDate(0, 0, 1).Format("20060102"))
+		write("SUMMARY:%s", escapeICSText(event.Summary))
+
+		if event.Description != "" {
+			write("DESCRIPTION:%s", escapeICSText(event.Description))
+		}
+
+		if event.URL != "" {
+			write("URL:%s", event.URL)
+		}
+
+		write("TRANSP:TRANSPARENT")
+		write("END:VEVENT")
+	}
+
+	write("END:VCALENDAR")
+
+	return b.String()
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"os"
@@ -207,3 +208,62 @@ func SendOTPMailTemplate(email, otp string) SendMailStruct {
 		Subject:  "Your OTP Code",
 	}
 }
+
+func SendTicketMailTemplate(email, name, bookingID, movieTitle, startsAt string, movieTimeSlotID int32, seats []string) SendMailStruct {
+	if name == "" {
+		name = "User"
+	}
+
+	seatList := strings.Join(seats, ", ")
+
+	showing := fmt.Sprintf("Showtime %d", movieTimeSlotID)
+
+	if movieTitle != "" {
+		showing = movieTitle
+	}
+
+	if startsAt != "" {
+		showing += " at " + startsAt
+	}
+
+	return SendMailStruct{
+		To:       email,
+		Name:     name,
+		Text:     fmt.Sprintf("Your booking %s is confirmed. %s, seats %s.", bookingID, showing, seatList),
+		Html:     fmt.Sprintf("<p>Your booking <strong>%s</strong> is confirmed.</p><p><strong>%s</strong>, seats <strong>%s</strong>.</p>", html.EscapeString(bookingID), html.EscapeString(showing), html.EscapeString(seatList)),
+		Category: "ticket",
+		Subject:  "Your tickets",
+	}
+}
+
+func SendRetryCheckoutMailTemplate(email, name, link string, seats []string) SendMailStruct {
+	if name == "" {
+		name = "User"
+	}
+
+	seatList := strings.Join(seats, ", ")
+
+	return SendMailStruct{
+		To:       email,
+		Name:     name,
+		Text:     fmt.Sprintf("Your payment did not go through. Seats %s are still free, book them again at %s", seatList, link),
+		Html:     fmt.Sprintf("<p>Your payment did not go through.</p><p>Seats <strong>%s</strong> are still free, <a href=\"%s\">book them again</a>.</p>", html.EscapeString(seatList), html.EscapeString(link)),
+		Category: "checkout-retry",
+		Subject:  "Your seats are still free",
+	}
+}
+
+func SendRefundOwedMailTemplate(email, name, bookingID, reason string) SendMailStruct {
+	if name == "" {
+		name = "User"
+	}
+
+	return SendMailStruct{
+		To:       email,
+		Name:     name,
+		Text:     fmt.Sprintf("We received your payment for booking %s but could not book your seats. %s. Your payment will be refunded.", bookingID, reason),
+		Html:     fmt.Sprintf("<p>We received your payment for booking <strong>%s</strong> but could not book your seats.</p><p>%s.</p><p>Your payment will be refunded.</p>", html.EscapeString(bookingID), html.EscapeString(reason)),
+		Category: "refund",
+		Subject:  "Your seats could not be booked",
+	}
+}
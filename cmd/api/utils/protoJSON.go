@@ -0,0 +1,534 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The JSON contract of the broker: protobuf messages are encoded with
+// protojson, so field names are the camelCase proto JSON names, enums are
+// their value names and every field is present. Timestamps are RFC 3339
+// strings. Request bodies are decoded the same way.
+var (
+	protoMarshal   = protojson.MarshalOptions{EmitUnpopulated: true}
+	protoUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// unixTimestampFields are proto fields that hold unix seconds, they are sent
+// as RFC 3339 strings
+var unixTimestampFields = map[protoreflect.FullName]bool{
+	"moviedb_service.Review.createdAt": true,
+}
+
+// IsUnixTimestampField reports whether the proto field holds unix seconds that
+// are sent as an RFC 3339 string
+func IsUnixTimestampField(name protoreflect.FullName) bool {
+	return unixTimestampFields[name]
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	protoMessageType  = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	protoEnumType     = reflect.TypeOf((*protoreflect.Enum)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// MarshalJSON encodes v following the JSON contract. Proto messages may appear
+// anywhere in v, inside structs, slices and maps.
+func MarshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := encodeValue(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a request body into v. Proto messages accept the
+// camelCase and the original proto field names and enums by name or number.
+// Other values accept camelCase keys and, for older clients, snake_case keys.
+func UnmarshalJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var tree any
+
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+
+	if m, ok := v.(proto.Message); ok {
+		if object, ok := tree.(map[string]any); ok {
+			protoFieldKeys(m.ProtoReflect().Descriptor(), object)
+		}
+
+		normalised, err := json.Marshal(tree)
+
+		if err != nil {
+			return err
+		}
+
+		return protoUnmarshal.Unmarshal(normalised, m)
+	}
+
+	normalised, err := json.Marshal(camelCaseKeys(tree))
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(normalised, v)
+}
+
+// CamelCase converts a snake_case name to camelCase
+func CamelCase(name string) string {
+	if !strings.Contains(name, "_") {
+		return name
+	}
+
+	var b strings.Builder
+
+	upper := false
+
+	for i, r := range name {
+		if r == '_' {
+			upper = i > 0
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func camelCaseKeys(tree any) any {
+	switch value := tree.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(value))
+
+		for key, child := range value {
+			converted[CamelCase(key)] = camelCaseKeys(child)
+		}
+
+		return converted
+	case []any:
+		for i, child := range value {
+			value[i] = camelCaseKeys(child)
+		}
+
+		return value
+	default:
+		return tree
+	}
+}
+
+// protoFieldKeys renames the snake_case keys of tree that are not fields of md
+// to the camelCase field they name. Map fields keep their keys.
+func protoFieldKeys(md protoreflect.MessageDescriptor, tree map[string]any) {
+	fields := md.Fields()
+
+	for key, value := range tree {
+		field := fields.ByJSONName(key)
+
+		if field == nil {
+			field = fields.ByName(protoreflect.Name(key))
+		}
+
+		if field == nil {
+			camel := CamelCase(key)
+
+			if field = fields.ByJSONName(camel); field == nil {
+				field = fields.ByName(protoreflect.Name(camel))
+			}
+
+			if field == nil {
+				continue
+			}
+
+			delete(tree, key)
+			tree[camel] = value
+		}
+
+		if field.Message() == nil || field.IsMap() {
+			continue
+		}
+
+		switch child := value.(type) {
+		case map[string]any:
+			protoFieldKeys(field.Message(), child)
+		case []any:
+			for _, item := range child {
+				if itemTree, ok := item.(map[string]any); ok {
+					protoFieldKeys(field.Message(), itemTree)
+				}
+			}
+		}
+	}
+}
+
+// EnumValue is an enum in a request body, sent either by name or by number
+type EnumValue string
+
+func (e *EnumValue) UnmarshalJSON(data []byte) error {
+	var name string
+
+	if err := json.Unmarshal(data, &name); err == nil {
+		*e = EnumValue(name)
+		return nil
+	}
+
+	var number int32
+
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("enum must be a name or a number: %w", err)
+	}
+
+	*e = EnumValue(strconv.Itoa(int(number)))
+
+	return nil
+}
+
+// Parse resolves the enum against the generated <Enum>_value map, empty values
+// resolve to the zero value
+func (e EnumValue) Parse(values map[string]int32) (int32, error) {
+	if e == "" {
+		return 0, nil
+	}
+
+	if number, err := strconv.Atoi(string(e)); err == nil {
+		return int32(number), nil
+	}
+
+	if number, ok := values[strings.ToUpper(string(e))]; ok {
+		return number, nil
+	}
+
+	return 0, fmt.Errorf("unknown enum value %q", e)
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	if v.Type().Implements(protoMessageType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		return encodeProto(buf, v.Interface().(proto.Message))
+	}
+
+	if v.Kind() != reflect.Pointer && v.Type().Implements(protoEnumType) {
+		enum := v.Interface().(protoreflect.Enum)
+
+		if value := enum.Descriptor().Values().ByNumber(enum.Number()); value != nil {
+			buf.WriteString(strconv.Quote(string(value.Name())))
+		} else {
+			buf.WriteString(strconv.Itoa(int(enum.Number())))
+		}
+
+		return nil
+	}
+
+	if v.Type() == timeType {
+		buf.WriteString(strconv.Quote(v.Interface().(time.Time).UTC().Format(time.RFC3339)))
+		return nil
+	}
+
+	if v.Type().Implements(jsonMarshalerType) {
+		return writeJSON(buf, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		return encodeValue(buf, v.Elem())
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return writeJSON(buf, v.Interface())
+		}
+
+		fallthrough
+	case reflect.Array:
+		buf.WriteByte('[')
+
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("{}")
+			return nil
+		}
+
+		type entry struct {
+			name  string
+			value reflect.Value
+		}
+
+		entries := make([]entry, 0, v.Len())
+
+		for iter := v.MapRange(); iter.Next(); {
+			entries = append(entries, entry{name: fmt.Sprint(iter.Key().Interface()), value: iter.Value()})
+		}
+
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+		buf.WriteByte('{')
+
+		for i, e := range entries {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			buf.WriteString(strconv.Quote(e.name))
+			buf.WriteByte(':')
+
+			if err := encodeValue(buf, e.value); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('}')
+
+		return nil
+	default:
+		return writeJSON(buf, v.Interface())
+	}
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+
+	first := true
+
+	var encodeFields func(v reflect.Value) error
+
+	encodeFields = func(v reflect.Value) error {
+		t := v.Type()
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+
+			if !field.IsExported() {
+				continue
+			}
+
+			tag := field.Tag.Get("json")
+
+			if tag == "-" {
+				continue
+			}
+
+			name, options, _ := strings.Cut(tag, ",")
+			value := v.Field(i)
+
+			if field.Anonymous && name == "" && value.Kind() == reflect.Struct {
+				if err := encodeFields(value); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if strings.Contains(options, "omitempty") && isEmptyValue(value) {
+				continue
+			}
+
+			if name == "" {
+				name = strings.ToLower(field.Name[:1]) + field.Name[1:]
+			}
+
+			if !first {
+				buf.WriteByte(',')
+			}
+
+			first = false
+
+			buf.WriteString(strconv.Quote(name))
+			buf.WriteByte(':')
+
+			if err := encodeValue(buf, value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := encodeFields(v); err != nil {
+		return err
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, v any) error {
+	encoded, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	buf.Write(encoded)
+
+	return nil
+}
+
+func encodeProto(buf *bytes.Buffer, m proto.Message) error {
+	encoded, err := protoMarshal.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	if !hasUnixTimestamps(m.ProtoReflect().Descriptor()) {
+		return json.Compact(buf, encoded)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var tree map[string]any
+
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+
+	formatUnixTimestamps(m.ProtoReflect().Descriptor(), tree)
+
+	return writeJSON(buf, tree)
+}
+
+var timestampMessages sync.Map
+
+// hasUnixTimestamps reports whether md or a message below it has a field in
+// unixTimestampFields
+func hasUnixTimestamps(md protoreflect.MessageDescriptor) bool {
+	if cached, ok := timestampMessages.Load(md.FullName()); ok {
+		return cached.(bool)
+	}
+
+	found := findUnixTimestamps(md, map[protoreflect.FullName]bool{})
+	timestampMessages.Store(md.FullName(), found)
+
+	return found
+}
+
+// findUnixTimestamps walks the messages below md, visited holds the messages
+// already walked so recursive messages are walked once
+func findUnixTimestamps(md protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) bool {
+	if cached, ok := timestampMessages.Load(md.FullName()); ok {
+		return cached.(bool)
+	}
+
+	if visited[md.FullName()] {
+		return false
+	}
+
+	visited[md.FullName()] = true
+
+	fields := md.Fields()
+
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+
+		if unixTimestampFields[field.FullName()] {
+			return true
+		}
+
+		if field.Message() != nil && !field.IsMap() && findUnixTimestamps(field.Message(), visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatUnixTimestamps(md protoreflect.MessageDescriptor, tree map[string]any) {
+	fields := md.Fields()
+
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		value, ok := tree[field.JSONName()]
+
+		if !ok {
+			continue
+		}
+
+		if unixTimestampFields[field.FullName()] {
+			if number, ok := value.(json.Number); ok {
+				seconds, _ := number.Int64()
+				tree[field.JSONName()] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+			}
+
+			continue
+		}
+
+		if field.Message() == nil || field.IsMap() || !hasUnixTimestamps(field.Message()) {
+			continue
+		}
+
+		switch child := value.(type) {
+		case map[string]any:
+			formatUnixTimestamps(field.Message(), child)
+		case []any:
+			for _, item := range child {
+				if itemTree, ok := item.(map[string]any); ok {
+					formatUnixTimestamps(field.Message(), itemTree)
+				}
+			}
+		}
+	}
+}
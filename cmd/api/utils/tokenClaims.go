@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type TokenClaims struct {
+	UserID int32
+	Email  string
+	Role   string
+}
+
+// ParseTokenClaims reads the claims out of the payload of a JWT. The signature
+// is NOT verified here, the token must already have been validated by the auth
+// service before the claims are trusted.
+func ParseTokenClaims(token string) (TokenClaims, error) {
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return TokenClaims{}, errors.New("token is not a valid jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("error decoding token payload: %w", err)
+	}
+
+	raw := make(map[string]any)
+
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return TokenClaims{}, fmt.Errorf("error unmarshalling token payload: %w", err)
+	}
+
+	var claims TokenClaims
+
+	for _, key := range []string{"user_id", "userId", "userID", "id", "sub"} {
+		if id, ok := claimInt32(raw[key]); ok {
+			claims.UserID = id
+			break
+		}
+	}
+
+	if email, ok := raw["email"].(string); ok {
+		claims.Email = email
+	}
+
+	switch role := raw["role"].(type) {
+	case string:
+		claims.Role = strings.ToLower(role)
+	case float64:
+		// Role is the auth service enum, ADMIN = 0 and USER = 1
+		if role == 0 {
+			claims.Role = "admin"
+		} else {
+			claims.Role = "user"
+		}
+	}
+
+	return claims, nil
+}
+
+func claimInt32(value any) (int32, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int32(v), v > 0
+	case string:
+		id, err := strconv.ParseInt(v, 10, 32)
+		return int32(id), err == nil && id > 0
+	}
+
+	return 0, false
+}
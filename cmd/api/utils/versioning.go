@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Deprecated marks a legacy route as an alias of a /v1 route. Responses carry
+// the Deprecation (RFC 9745) and Sunset (RFC 8594) headers and a Link to the
+// successor. Url parameters in successor, such as {id}, are filled in from the
+// request, the Link is left out when the legacy route sends them in the body.
+func Deprecated(successor string, deprecatedAt, sunset time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			link := successor
+
+			if routeContext := chi.RouteContext(r.Context()); routeContext != nil {
+				for i, key := range routeContext.URLParams.Keys {
+					link = strings.ReplaceAll(link, "{"+key+"}", routeContext.URLParams.Values[i])
+				}
+			}
+
+			if strings.Contains(link, "{") {
+				link = ""
+			}
+
+			deprecate(w, link, deprecatedAt, sunset)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DeprecatedPrefix marks every route below a legacy prefix as an alias of the
+// same path below prefix, e.g. /admin/metrics of /v1/admin/metrics. The Link
+// to the successor is built from the request path.
+func DeprecatedPrefix(prefix string, deprecatedAt, sunset time.Time) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deprecate(w, prefix+r.URL.Path, deprecatedAt, sunset)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deprecate sets the deprecation headers, link is left out when it is empty
+func deprecate(w http.ResponseWriter, link string, deprecatedAt, sunset time.Time) {
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+	w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+
+	if link != "" {
+		w.Header().Add("Link", "<"+link+`>; rel="successor-version"`)
+	}
+}
+
+// BindParams lets the body based handlers serve resource oriented routes. The
+// query parameters and the url parameters are merged into the JSON request
+// body, urlParams maps a url parameter to the body field it fills. Values in
+// the body win over query parameters, url parameters win over both.
+func BindParams(urlParams map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := map[string]any{}
+
+			bodyBytes, err := io.ReadAll(r.Body)
+			r.Body.Close()
+
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				http.Error(w, "error reading request body", http.StatusBadRequest)
+				return
+			}
+
+			if len(bytes.TrimSpace(bodyBytes)) > 0 {
+				decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
+				decoder.UseNumber()
+
+				if err := decoder.Decode(&body); err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					http.Error(w, "error unmarshalling request body: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			for key, values := range r.URL.Query() {
+				if _, ok := body[key]; ok {
+					continue
+				}
+
+				if len(values) == 1 {
+					body[key] = paramValue(values[0])
+					continue
+				}
+
+				list := make([]any, len(values))
+
+				for i, value := range values {
+					list[i] = paramValue(value)
+				}
+
+				body[key] = list
+			}
+
+			for param, field := range urlParams {
+				if value := chi.URLParam(r, param); value != "" {
+					body[field] = paramValue(value)
+				}
+			}
+
+			bodyBytes, err = json.Marshal(body)
+
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				http.Error(w, "error marshalling request body: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			r.ContentLength = int64(len(bodyBytes))
+			r.Header.Set("Content-Type", "application/json")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// paramValue types a query or url parameter, numbers and booleans are sent as
+// JSON numbers and booleans so they decode into numeric and boolean fields
+func paramValue(value string) any {
+	if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+		return json.Number(value)
+	}
+
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+
+	return value
+}
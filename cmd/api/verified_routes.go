@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+)
+
+// A review is by a verified viewer when its author booked a showing of the
+// movie through the broker and MovieDB still has the seats booked. The check
+// runs once, when the review is posted, and its outcome is kept in Redis.
+
+// maxVerifiedShowings bounds how many booked showings of a movie are checked
+// with MovieDB, the most recent time slots go first
+const maxVerifiedShowings = 10
+
+// verifiedReviewsKey holds the ids of the reviews of a movie written by
+// verified viewers
+func verifiedReviewsKey(movieID int32) string {
+	return fmt.Sprintf("reviews:verified:%d", movieID)
+}
+
+// reviewSettingsKey holds the review settings of a movie
+func reviewSettingsKey(movieID int32) string {
+	return fmt.Sprintf("reviews:settings:%d", movieID)
+}
+
+type ReviewSettings struct {
+	// VerifiedOnly lets only verified viewers review the movie
+	VerifiedOnly bool `json:"verifiedOnly"`
+}
+
+// verifiedViewer reports whether user has a confirmed booking for one of the
+// showings of movieID. Bookings are found in the trail the broker keeps for
+// the signed in user, their venue must still show the movie and MovieDB must
+// still have their seats booked.
+func (c *Config) verifiedViewer(ctx context.Context, user *AuthUser, movieID int32) (bool, error) {
+	if c.RedisClient == nil || user.Email == "" {
+		return false, nil
+	}
+
+	members, err := c.RedisClient.SMembers(ctx, userBookedSeatsKey(user.Email, movieID)).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	seats := map[int32]map[string]bool{}
+	venues := map[int32]int32{}
+
+	for _, member := range members {
+		parts := strings.SplitN(member, ":", 3)
+
+		// entries without the venue of the showing cannot be tied to the movie
+		if len(parts) != 3 || parts[2] == "" {
+			continue
+		}
+
+		slotID, err := strconv.ParseInt(parts[0], 10, 32)
+
+		if err != nil {
+			continue
+		}
+
+		venueID, err := strconv.ParseInt(parts[1], 10, 32)
+
+		if err != nil {
+			continue
+		}
+
+		if seats[int32(slotID)] == nil {
+			seats[int32(slotID)] = map[string]bool{}
+		}
+
+		seats[int32(slotID)][parts[2]] = true
+		venues[int32(slotID)] = int32(venueID)
+	}
+
+	slotIDs := make([]int32, 0, len(seats))
+
+	for slotID := range seats {
+		slotIDs = append(slotIDs, slotID)
+	}
+
+	sort.Slice(slotIDs, func(i, j int) bool { return slotIDs[i] > slotIDs[j] })
+
+	if len(slotIDs) > maxVerifiedShowings {
+		slotIDs = slotIDs[:maxVerifiedShowings]
+	}
+
+	var lastErr error
+
+	showing := map[int32]bool{}
+
+	for _, slotID := range slotIDs {
+		venueID := venues[slotID]
+
+		shows, checked := showing[venueID]
+
+		if !checked {
+			shows, err = c.venueShowsMovie(ctx, movieID, venueID)
+
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			showing[venueID] = shows
+		}
+
+		if !shows {
+			continue
+		}
+
+		response, err := c.MovieDB_service.GetBookedSeats(ctx, &pb.GetBookedSeatsRequest{
+			MovieTimeSlotId: slotID,
+		})
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, booked := range response.GetBookedSeats() {
+			if seats[slotID][booked.SeatNumber] {
+				return true, nil
+			}
+		}
+	}
+
+	if lastErr != nil && len(slotIDs) > 0 {
+		return false, fmt.Errorf("error confirming bookings: %w", lastErr)
+	}
+
+	return false, nil
+}
+
+// movieReviewSettings returns the review settings of a movie, movies without
+// settings take anyone's review
+func (c *Config) movieReviewSettings(ctx context.Context, movieID int32) (ReviewSettings, error) {
+	var settings ReviewSettings
+
+	if c.RedisClient == nil {
+		return settings, nil
+	}
+
+	values, err := c.RedisClient.HGetAll(ctx, reviewSettingsKey(movieID)).Result()
+
+	if err != nil {
+		return settings, err
+	}
+
+	settings.VerifiedOnly = values["verifiedOnly"] == "1"
+
+	return settings, nil
+}
+
+// markVerifiedReview records that a review is by a verified viewer
+func (c *Config) markVerifiedReview(ctx context.Context, movieID int32, reviewID int32) {
+	if c.RedisClient == nil || reviewID <= 0 {
+		return
+	}
+
+	if err := c.RedisClient.SAdd(ctx, verifiedReviewsKey(movieID), reviewID).Err(); err != nil {
+		log.Error("error recording verified review: ", err)
+	}
+}
+
+// verifiedReviews returns which of the reviews of a movie are by verified
+// viewers
+func (c *Config) verifiedReviews(ctx context.Context, movieID int32, reviews []*pb.Review) map[int32]bool {
+	verified := map[int32]bool{}
+
+	if c.RedisClient == nil || len(reviews) == 0 {
+		return verified
+	}
+
+	members := make([]any, len(reviews))
+
+	for i, review := range reviews {
+		members[i] = review.ReviewID
+	}
+
+	found, err := c.RedisClient.SMIsMember(ctx, verifiedReviewsKey(movieID), members...).Result()
+
+	if err != nil {
+		log.Error("error reading verified reviews: ", err)
+		return verified
+	}
+
+	for i, ok := range found {
+		if ok {
+			verified[reviews[i].ReviewID] = true
+		}
+	}
+
+	return verified
+}
+
+func (c *Config) AdminGetReviewSettings(w http.ResponseWriter, r *http.Request) {
+	movieID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := c.movieReviewSettings(r.Context(), movieID)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error reading review settings: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func (c *Config) AdminUpdateReviewSettings(w http.ResponseWriter, r *http.Request) {
+	movieID, err := urlParamInt32(r, "id")
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	var requestBody ReviewSettings
+
+	if err := decodeAdminBody(r, &requestBody); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Review settings are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	verifiedOnly := 0
+
+	if requestBody.VerifiedOnly {
+		verifiedOnly = 1
+	}
+
+	if err := c.RedisClient.HSet(r.Context(), reviewSettingsKey(movieID), "verifiedOnly", verifiedOnly).Err(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error saving review settings: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, requestBody)
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	redis "github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/utils"
+)
+
+// Votes a review can get
+const (
+	voteHelpful   = "helpful"
+	voteUnhelpful = "unhelpful"
+)
+
+// Weights of the votes in the helpfulness score. A review voted helpful by
+// most of its readers outranks any review nobody voted on, a review most
+// readers found unhelpful sinks below them.
+const (
+	helpfulVoteWeight = 10
+	// wilsonZ is the z-score of the 95% confidence interval, a few votes
+	// count for less than many votes with the same share
+	wilsonZ = 1.96
+)
+
+// castVoteScript records the vote of a user on a review and keeps the tallies
+// in step. KEYS are the votes and the tallies of the review, ARGV the user and
+// the vote, an empty vote takes the vote of the user back. It returns the
+// helpful and unhelpful tallies.
+var castVoteScript = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[1], ARGV[1])
+
+if previous ~= ARGV[2] then
+	if previous then
+		redis.call('HINCRBY', KEYS[2], previous, -1)
+	end
+
+	if ARGV[2] == '' then
+		redis.call('HDEL', KEYS[1], ARGV[1])
+	else
+		redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+		redis.call('HINCRBY', KEYS[2], ARGV[2], 1)
+	end
+end
+
+return {
+	tonumber(redis.call('HGET', KEYS[2], 'helpful') or 0),
+	tonumber(redis.call('HGET', KEYS[2], 'unhelpful') or 0),
+}
+`)
+
+// reviewVotesKey maps the users who voted on a review to their vote, it is how
+// the broker allows one vote per user per review
+func reviewVotesKey(reviewID int32) string {
+	return fmt.Sprintf("reviews:votes:%d", reviewID)
+}
+
+// reviewTallyKey holds the helpful and unhelpful counters of a review
+func reviewTallyKey(reviewID int32) string {
+	return fmt.Sprintf("reviews:tally:%d", reviewID)
+}
+
+type ReviewVoteRequest struct {
+	// Vote is helpful or unhelpful
+	Vote string `json:"vote" validate:"required,oneof=helpful unhelpful"`
+}
+
+type ReviewVotes struct {
+	ReviewID  int32 `json:"reviewId"`
+	Helpful   int64 `json:"helpful"`
+	Unhelpful int64 `json:"unhelpful"`
+	// Vote is the vote of the signed in user, empty when the user has not
+	// voted
+	Vote string `json:"vote,omitempty"`
+}
+
+// reviewVotes reads the tallies of the reviews, reviews nobody voted on are
+// left out. Without Redis there are no votes.
+func (c *Config) reviewVotes(ctx context.Context, reviews []*pb.Review) map[int32]ReviewVotes {
+	votes := map[int32]ReviewVotes{}
+
+	if c.RedisClient == nil || len(reviews) == 0 {
+		return votes
+	}
+
+	pipe := c.RedisClient.Pipeline()
+	tallies := make([]*redis.SliceCmd, len(reviews))
+
+	for i, review := range reviews {
+		tallies[i] = pipe.HMGet(ctx, reviewTallyKey(review.ReviewID), voteHelpful, voteUnhelpful)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Error("error reading review votes: ", err)
+		return votes
+	}
+
+	for i, review := range reviews {
+		values := tallies[i].Val()
+
+		if len(values) != 2 || (values[0] == nil && values[1] == nil) {
+			continue
+		}
+
+		tally := ReviewVotes{ReviewID: review.ReviewID}
+
+		if raw, ok := values[0].(string); ok {
+			tally.Helpful, _ = strconv.ParseInt(raw, 10, 64)
+		}
+
+		if raw, ok := values[1].(string); ok {
+			tally.Unhelpful, _ = strconv.ParseInt(raw, 10, 64)
+		}
+
+		if tally.Helpful > 0 || tally.Unhelpful > 0 {
+			votes[review.ReviewID] = tally
+		}
+	}
+
+	return votes
+}
+
+// wilsonLowerBound is the lower bound of the share of positive votes that the
+// votes so far are confident of
+func wilsonLowerBound(positive int64, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	n := float64(total)
+	p := float64(positive) / n
+	z2 := wilsonZ * wilsonZ
+
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// voteHelpfulness scores the votes on a review, positive when readers found it
+// helpful and negative when they did not
+func voteHelpfulness(votes ReviewVotes) float64 {
+	total := votes.Helpful + votes.Unhelpful
+
+	return helpfulVoteWeight * (wilsonLowerBound(votes.Helpful, total) - wilsonLowerBound(votes.Unhelpful, total))
+}
+
+// voteOnReview records or, with an empty vote, takes back the vote of the
+// signed in user
+func (c *Config) voteOnReview(w http.ResponseWriter, r *http.Request, vote string) {
+	user, ok := UserFromContext(r.Context())
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if c.RedisClient == nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Review votes are not configured"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	movieID, reviewID, err := reviewPathIDs(r)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := c.MovieDB_service.GetReview(r.Context(), &pb.ReviewRequest{
+		MovieID:  movieID,
+		ReviewID: reviewID,
+	})
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error getting movie review: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	review := response.GetReview()
+
+	if review == nil || (review.MovieID != 0 && review.MovieID != movieID) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "No movie review found"}`, http.StatusNotFound)
+		return
+	}
+
+	if vote != "" && review.UserID == user.UserID {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Authors may not vote on their own review"}`, http.StatusForbidden)
+		return
+	}
+
+	tallies, err := castVoteScript.Run(r.Context(), c.RedisClient,
+		[]string{reviewVotesKey(reviewID), reviewTallyKey(reviewID)},
+		user.UserID, vote,
+	).Int64Slice()
+
+	if err != nil || len(tallies) != 2 {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, fmt.Sprintf(`{"error": "Error recording vote: %v"}`, err), http.StatusInternalServerError)
+		return
+	}
+
+	// the vote may move the review in the helpful order
+	if err := c.RedisClient.Del(r.Context(), helpfulRankingKey(movieID)).Err(); err != nil {
+		log.Error("error dropping the helpful ranking: ", err)
+	}
+
+	writeJSON(w, http.StatusOK, ReviewVotes{
+		ReviewID:  reviewID,
+		Helpful:   tallies[0],
+		Unhelpful: tallies[1],
+		Vote:      vote,
+	})
+}
+
+// VoteOnReview votes a review helpful or unhelpful, a user has one vote per
+// review and voting again replaces it
+func (c *Config) VoteOnReview(w http.ResponseWriter, r *http.Request) {
+	var requestBody ReviewVoteRequest
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	err = utils.UnmarshalJSON(bodyBytes, &requestBody)
+
+	if err != nil {
+		http.Error(w, "Error unmarshalling JSON from request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Vote != voteHelpful && requestBody.Vote != voteUnhelpful {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "vote must be helpful or unhelpful"}`, http.StatusBadRequest)
+		return
+	}
+
+	c.voteOnReview(w, r, requestBody.Vote)
+}
+
+// RetractReviewVote takes back the vote of the signed in user on a review
+func (c *Config) RetractReviewVote(w http.ResponseWriter, r *http.Request) {
+	c.voteOnReview(w, r, "")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,6 +12,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/kartik7120/booking_broker-service/cmd/api"
+	"github.com/kartik7120/booking_broker-service/cmd/api/cache"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -18,7 +20,9 @@ import (
 
 	at "github.com/kartik7120/booking_broker-service/cmd/api/authService"
 	pb "github.com/kartik7120/booking_broker-service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_broker-service/cmd/api/moderation"
 	"github.com/kartik7120/booking_broker-service/cmd/api/payment_service"
+	"github.com/kartik7120/booking_broker-service/cmd/api/search"
 )
 
 func main() {
@@ -40,9 +44,24 @@ func main() {
 		},
 	)
 
+	reviewWords := moderation.DefaultWords
+
+	if path := os.Getenv("REVIEW_WORD_LIST"); path != "" {
+		reviewWords, err = loadWordList(path)
+
+		if err != nil {
+			log.Fatal("Error loading review word list", err)
+			os.Exit(1)
+			return
+		}
+	}
+
 	app := api.Config{
-		Validator:   validator.New(),
-		RedisClient: redisClient,
+		Validator:    validator.New(),
+		RedisClient:  redisClient,
+		SearchIndex:  search.NewIndex(),
+		Trending:     api.NewTrendingRanking(),
+		ReviewFilter: moderation.NewFilter(reviewWords),
 	}
 
 	srv := &http.Server{
@@ -95,10 +114,28 @@ func main() {
 		return
 	}
 
-	app.MovieDB_service = client
+	coalescingClient := cache.NewCoalescingClient(client)
+	expvar.Publish("moviedb_coalescing", coalescingClient.Metrics())
+
+	app.MovieDB_service = cache.NewMovieDBCache(coalescingClient, redisClient, cache.DefaultTTLs)
 	app.Payment_service = paymentClient
+	app.PaymentWebhookSecret = os.Getenv("PAYMENT_WEBHOOK_SECRET")
+
+	// payment webhooks book seats and are refused without their secret
+	if app.PaymentWebhookSecret == "" {
+		log.Warn("PAYMENT_WEBHOOK_SECRET is not set, payment webhooks are refused")
+	}
+
+	app.CheckoutRetryURL = os.Getenv("CHECKOUT_RETRY_URL")
 	app.Auth_Service = at.NewAuthServiceClient(conn3)
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	go app.StartSearchIndexer(backgroundCtx)
+	go app.StartTrendingRanker(backgroundCtx)
+	go app.StartCheckoutSweeper(backgroundCtx)
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error starting server: %v", err)
@@ -124,3 +161,16 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
+// loadWordList reads the word list reviews are moderated with
+func loadWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return moderation.ParseWordList(file)
+}